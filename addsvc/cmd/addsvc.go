@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -12,56 +16,91 @@ import (
 )
 
 func main() {
+	// startup aborts on an invalid configuration
+	err := config.Load("addsvc", config.NewAddsvcTree(), flag.CommandLine, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 	logger := pkg.GetLogger()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(); err != nil {
+	// run blocks until the interrupt signal, or a server failure
+	if err := run(ctx); err != nil {
 		log.Fatal(err)
 	}
 
-	// Listen for the interrupt signal.
-	<-ctx.Done()
-
 	logger.Log("service", "exiting")
 }
 
-func run() error {
+func run(ctx context.Context) error {
 	logger := pkg.GetLogger()
 	c := config.GetAddSvcConfig()
+	lifecycle := pkg.NewLifecycle(logger)
+	// undoes what was started if run fails before the servers run
+	defer lifecycle.Abort()
+	lifecycle.Close("tracer", pkg.CloseTracers)
+	// limits, breakers, timeouts and the log level follow the runtime
+	// configuration from now on
+	stopRuntime, err := pkg.WatchRuntimeConfig(logger)
+	if err != nil {
+		return err
+	}
+	lifecycle.Close("runtime config", stopRuntime)
 
+	health := addsvc.NewHealth(logger)
+	// not serving anymore as soon as the shutdown starts
+	lifecycle.OnShutdown(health.Shutdown)
+	grpcServer, err := addsvc.NewGrpcServer(health, logger)
+	if err != nil {
+		return err
+	}
+	httpHandler, err := addsvc.NewHttpHandler(logger)
+	if err != nil {
+		return err
+	}
+
+	if err := lifecycle.HTTP("debug", fmt.Sprintf(":%d", c.DebugPort), pkg.DebugHandler(health)); err != nil {
+		return err
+	}
+	if err := lifecycle.GRPC("gRPC", fmt.Sprintf(":%d", c.GrpcPort), grpcServer); err != nil {
+		return err
+	}
+	if err := lifecycle.HTTP("HTTP", fmt.Sprintf(":%d", c.HttpPort), httpHandler); err != nil {
+		return err
+	}
+
+	// registered once listening, deregistered first on shutdown
 	if c.IsNeedDiscovery {
-		client, err := pkg.NewKitDiscoverClient()
+		registry, err := pkg.NewRegistry(logger)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		status := client.Register(c.Name, pkg.ServiceInstance{
+		err = lifecycle.Register(registry, c.Name, pkg.ServiceInstance{
 			InstanceId:   c.HostName,
 			InstanceHost: c.Host,
 			InstancePort: c.GrpcPort,
-		}, make(map[string]string))
-		logger.Log("consul discovery register ", status)
-		defer client.Deregister(c.Name)
-	}
-
-	go func() {
-		if err := pkg.StartDebugServer(c.DebugPort, logger); err != nil {
-			logger.Log(err.Error())
-		}
-	}()
-
-	go func() {
-		if err := addsvc.GrpcServe(logger); err != nil {
-			logger.Log(err.Error())
+		})
+		if err != nil {
+			return err
 		}
-	}()
-
-	go func() {
-		if err := addsvc.HttpServe(logger); err != nil {
-			logger.Log(err.Error())
+		// the HTTP server as well, for the gateway routes calling addsvc over
+		// HTTP, checked at the readiness endpoint
+		err = lifecycle.Register(registry, pkg.RegisteredName(c.Name, pkg.ProtocolHTTP), pkg.ServiceInstance{
+			InstanceId:   c.HostName + "-" + pkg.ProtocolHTTP,
+			InstanceHost: c.Host,
+			InstancePort: c.HttpPort,
+			HTTPCheck:    fmt.Sprintf("http://%s:%d/readyz", c.Host, c.DebugPort),
+		})
+		if err != nil {
+			return err
 		}
-	}()
+	}
 
-	return nil
+	health.Start()
+	return lifecycle.Run(ctx)
 }
@@ -2,22 +2,15 @@ package endpoints
 
 import (
 	"context"
-	"time"
 
-	"golang.org/x/time/rate"
-
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/ratelimit"
-	"github.com/go-kit/kit/tracing/opentracing"
-	"github.com/go-kit/kit/tracing/zipkin"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
 	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
 
 	addservices "github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
 // Set collects all of the endpoints that compose an add service. It's meant to
@@ -29,55 +22,74 @@ type Set struct {
 	HealthCheckEndpoint endpoint.Endpoint
 }
 
-// Concat implements services.Service
-func (Set) Concat(ctx context.Context, a string, b string) (string, error) {
-	panic("unimplemented")
+// Sum implements services.Service, so a Set made by a client can be used as
+// the Service it calls. The errors of the service come back either as the
+// error of the endpoint, from a client, or as that of the response.
+func (s Set) Sum(ctx context.Context, a, b int) (int, error) {
+	resp, err := s.SumEndpoint(ctx, SumRequest{A: a, B: b})
+	if err != nil {
+		return 0, err
+	}
+	response := resp.(SumResponse)
+	return response.V, response.Err
 }
 
-// HealthCheck implements services.Service
-func (Set) HealthCheck(ctx context.Context) bool {
-	panic("unimplemented")
+// Concat implements services.Service, see Sum.
+func (s Set) Concat(ctx context.Context, a, b string) (string, error) {
+	resp, err := s.ConcatEndpoint(ctx, ConcatRequest{A: a, B: b})
+	if err != nil {
+		return "", err
+	}
+	response := resp.(ConcatResponse)
+	return response.V, response.Err
 }
 
-// Sum implements services.Service
-func (Set) Sum(ctx context.Context, a int, b int) (int, error) {
-	panic("unimplemented")
+// HealthCheck implements services.Service. It reports a Set without a
+// health check endpoint, or whose endpoint fails, as unhealthy.
+func (s Set) HealthCheck(ctx context.Context) bool {
+	if s.HealthCheckEndpoint == nil {
+		return false
+	}
+	resp, err := s.HealthCheckEndpoint(ctx, HealthRequest{})
+	if err != nil {
+		return false
+	}
+	return resp.(HealthResponse).Status
 }
 
 // New returns a Set that wraps the provided server, and wires in all of the
-// expected endpoint middlewares via the various parameters.
-func NewEndpoints(svc addservices.Service, logger log.Logger, duration metrics.Histogram, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer) Set {
+// expected endpoint middlewares via the various parameters. The metrics are
+// expected to be labelled by transport already.
+func NewEndpoints(svc addservices.Service, logger log.Logger, m middleware.EndpointMetrics, tracer trace.Tracer) Set {
 	var sumEndpoint endpoint.Endpoint
 	{
 		sumEndpoint = MakeSumEndpoint(svc)
-		// Sum is limited to 1 request per second with burst of 1 request.
-		// Note, rate is defined as a time interval between requests.
-		sumEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 1))(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(sumEndpoint)
-		sumEndpoint = opentracing.TraceServer(otTracer, "Sum")(sumEndpoint)
-		if zipkinTracer != nil {
-			sumEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Sum")(sumEndpoint)
-		}
-		// sumEndpoint = LoggingMiddleware(log.With(logger, "method", "Sum"))(sumEndpoint)
-		// sumEndpoint = InstrumentingMiddleware(duration.With("method", "Sum"))(sumEndpoint)
+		// Sum is limited to 1 request per second with burst of 1 request,
+		// unless the runtime configuration says otherwise for addsvc.Sum.
+		sumEndpoint = pkg.RuntimeTimeout("addsvc.Sum", 0)(sumEndpoint)
+		sumEndpoint = pkg.RuntimeLimiter("addsvc.Sum", pkg.LimitSettings{RPS: 1, Burst: 1})(sumEndpoint)
+		sumEndpoint = pkg.RuntimeBreaker("addsvc.Sum", gobreaker.Settings{Name: "addsvc.Sum"})(sumEndpoint)
+		sumEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Sum"))(sumEndpoint)
+		sumEndpoint = middleware.TraceEndpoint(tracer, "Sum")(sumEndpoint)
+		sumEndpoint = middleware.InstrumentingMiddleware(m, "Sum")(sumEndpoint)
 	}
 	var concatEndpoint endpoint.Endpoint
 	{
 		concatEndpoint = MakeConcatEndpoint(svc)
-		// Concat is limited to 1 request per second with burst of 100 requests.
-		// Note, rate is defined as a number of requests per second.
-		concatEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(1), 100))(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(concatEndpoint)
-		concatEndpoint = opentracing.TraceServer(otTracer, "Concat")(concatEndpoint)
-		if zipkinTracer != nil {
-			concatEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Concat")(concatEndpoint)
-		}
-		// concatEndpoint = LoggingMiddleware(log.With(logger, "method", "Concat"))(concatEndpoint)
-		// concatEndpoint = InstrumentingMiddleware(duration.With("method", "Concat"))(concatEndpoint)
+		// Concat is limited to 1 request per second with burst of 100
+		// requests, unless the runtime configuration says otherwise for
+		// addsvc.Concat.
+		concatEndpoint = pkg.RuntimeTimeout("addsvc.Concat", 0)(concatEndpoint)
+		concatEndpoint = pkg.RuntimeLimiter("addsvc.Concat", pkg.LimitSettings{RPS: 1, Burst: 100})(concatEndpoint)
+		concatEndpoint = pkg.RuntimeBreaker("addsvc.Concat", gobreaker.Settings{Name: "addsvc.Concat"})(concatEndpoint)
+		concatEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Concat"))(concatEndpoint)
+		concatEndpoint = middleware.TraceEndpoint(tracer, "Concat")(concatEndpoint)
+		concatEndpoint = middleware.InstrumentingMiddleware(m, "Concat")(concatEndpoint)
 	}
 	var healthCheckEndpoint endpoint.Endpoint
 	{
 		healthCheckEndpoint = MakeHealthCheckEndpoint(svc)
+		healthCheckEndpoint = middleware.InstrumentingMiddleware(m, "HealthCheck")(healthCheckEndpoint)
 	}
 	return Set{
 		SumEndpoint:         sumEndpoint,
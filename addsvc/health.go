@@ -1,23 +1,14 @@
 package addsvc
 
 import (
-	"context"
+	"github.com/go-kit/kit/log"
 
-	"google.golang.org/grpc/health/grpc_health_v1"
+	pb "github.com/pascallin/go-kit-application/pb/addsvc"
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
-type HealthChecker struct{}
-
-func NewHealthChecker() *HealthChecker {
-	return &HealthChecker{}
-}
-
-func (s *HealthChecker) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
-	return &grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
-	}, nil
-}
-
-func (h *HealthChecker) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
-	return nil
+// NewHealth returns the health of addsvc. It has no dependencies, it serves
+// for as long as it runs.
+func NewHealth(logger log.Logger) *pkg.Health {
+	return pkg.NewHealth(logger, pb.Add_ServiceDesc.ServiceName)
 }
@@ -1,29 +1,24 @@
 package metrics
 
 import (
-	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/metrics/prometheus"
-	stdprometheus "github.com/prometheus/client_golang/prometheus"
-
 	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/middleware"
 )
 
 var (
-	_requestDurationMetrics metrics.Histogram
+	_endpointMetrics *middleware.EndpointMetrics
 )
 
-func GetEndpointMetrics() (duration metrics.Histogram) {
-	if _requestDurationMetrics != nil {
-		return _requestDurationMetrics
+// GetEndpointMetrics returns the RED metrics of the addsvc endpoints, their
+// duration histogram bucketed after the metrics configuration.
+func GetEndpointMetrics() middleware.EndpointMetrics {
+	if _endpointMetrics != nil {
+		return *_endpointMetrics
 	}
 	c := config.GetAddSvcConfig()
 	// Endpoint-level metrics.
-	_requestDurationMetrics = prometheus.NewSummaryFrom(stdprometheus.SummaryOpts{
-		Namespace: "example",
-		Subsystem: c.Name,
-		Name:      "request_duration_seconds",
-		Help:      "Request duration in seconds.",
-	}, []string{"method", "success"})
+	m := middleware.NewEndpointMetrics(c.Name, config.GetMetricsConfig().DurationBuckets)
+	_endpointMetrics = &m
 
-	return _requestDurationMetrics
+	return m
 }
@@ -4,13 +4,17 @@ import (
 	"context"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/pascallin/go-kit-application/middleware"
 )
 
 // Middleware describes a service (as opposed to endpoint) middleware.
 type Middleware func(Service) Service
 
 // LoggingMiddleware takes a logger as a dependency
-// and returns a service Middleware.
+// and returns a service Middleware. Each line carries the request ID, trace ID
+// and user of the context.
 func LoggingMiddleware(logger log.Logger) Middleware {
 	return func(next Service) Service {
 		return loggingMiddleware{logger, next}
@@ -24,21 +28,31 @@ type loggingMiddleware struct {
 
 func (mw loggingMiddleware) Sum(ctx context.Context, a, b int) (v int, err error) {
 	defer func() {
-		mw.logger.Log("method", "Sum", "a", a, "b", b, "v", v, "err", err)
+		callLogger(ctx, mw.logger, err).Log("method", "Sum", "a", a, "b", b, "v", v, "err", err)
 	}()
 	return mw.next.Sum(ctx, a, b)
 }
 
 func (mw loggingMiddleware) Concat(ctx context.Context, a, b string) (v string, err error) {
 	defer func() {
-		mw.logger.Log("method", "Concat", "a", a, "b", b, "v", v, "err", err)
+		callLogger(ctx, mw.logger, err).Log("method", "Concat", "a", a, "b", b, "v", v, "err", err)
 	}()
 	return mw.next.Concat(ctx, a, b)
 }
 
 func (mw loggingMiddleware) HealthCheck(ctx context.Context) (v bool) {
 	defer func() {
-		mw.logger.Log("method", "HealthCheck", "v", v)
+		level.Debug(middleware.ContextLogger(ctx, mw.logger)).Log("method", "HealthCheck", "v", v)
 	}()
 	return mw.next.HealthCheck(ctx)
 }
+
+// callLogger returns the logger of a call, at the debug level since the
+// endpoints log the requests already, or at the warn level if it failed.
+func callLogger(ctx context.Context, logger log.Logger, err error) log.Logger {
+	logger = middleware.ContextLogger(ctx, logger)
+	if err != nil {
+		return level.Warn(logger)
+	}
+	return level.Debug(logger)
+}
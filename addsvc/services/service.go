@@ -2,10 +2,11 @@ package services
 
 import (
 	"context"
-	"errors"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
 // Service describes a service that adds things together.
@@ -28,16 +29,15 @@ func NewService(logger log.Logger, ints, chars metrics.Counter) Service {
 
 var (
 	// ErrTwoZeroes is an arbitrary business rule for the Add method.
-	ErrTwoZeroes = errors.New("can't sum two zeroes")
+	ErrTwoZeroes = pkg.NewError(pkg.KindInvalidArgument, "two_zeroes", "can't sum two zeroes")
 
-	// ErrIntOverflow protects the Add method. We've decided that this error
-	// indicates a misbehaving service and should count against e.g. circuit
-	// breakers. So, we return it directly in endpoints, to illustrate the
-	// difference. In a real service, this probably wouldn't be the case.
-	ErrIntOverflow = errors.New("integer overflow")
+	// ErrIntOverflow protects the Add method. The numbers of the request are
+	// to blame, so like the other errors here it is a client error, which the
+	// circuit breakers do not count.
+	ErrIntOverflow = pkg.NewError(pkg.KindInvalidArgument, "int_overflow", "integer overflow")
 
 	// ErrMaxSizeExceeded protects the Concat method.
-	ErrMaxSizeExceeded = errors.New("result exceeds maximum size")
+	ErrMaxSizeExceeded = pkg.NewError(pkg.KindInvalidArgument, "max_size_exceeded", "result exceeds maximum size")
 )
 
 // NewBasicService returns a naïve, stateless implementation of Service.
@@ -1,8 +1,6 @@
 package addsvc
 
 import (
-	"fmt"
-	"net"
 	"net/http"
 
 	"github.com/go-kit/kit/log"
@@ -15,66 +13,51 @@ import (
 	"github.com/pascallin/go-kit-application/addsvc/services"
 	"github.com/pascallin/go-kit-application/addsvc/transports"
 	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/middleware"
 	pb "github.com/pascallin/go-kit-application/pb/addsvc"
 	"github.com/pascallin/go-kit-application/pkg"
 )
 
-func GrpcServe(logger log.Logger) error {
+// NewGrpcServer builds the addsvc gRPC server, with the health service.
+func NewGrpcServer(health *pkg.Health, logger log.Logger) (*grpc.Server, error) {
 	c := config.GetAddSvcConfig()
 
-	zipkinTracer, tracer, err := pkg.InitTracer(c.Name)
+	tracer, err := pkg.InitTracer(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ints, chars := metrics.GetServiceMetrics()
-	duration := metrics.GetEndpointMetrics()
+	red := metrics.GetEndpointMetrics().With("transport", "grpc")
 	var (
 		service    = services.NewService(logger, ints, chars)
-		endpoints  = endpoints.NewEndpoints(service, logger, duration, tracer, zipkinTracer)
-		grpcServer = transports.NewGRPCServer(endpoints, tracer, zipkinTracer, logger)
+		endpoints  = endpoints.NewEndpoints(service, logger, red, tracer)
+		grpcServer = transports.NewGRPCServer(endpoints, tracer, logger)
 	)
 
-	// The gRPC listener mounts the Go kit gRPC server we created.
-	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.GrpcPort))
-	if err != nil {
-		logger.Log("transport", "gRPC", "during", "Listen", "err", err)
-		return err
-	}
-	logger.Log("transport", "gRPC", "addr", c.GrpcPort)
-
-	baseServer := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
+	baseServer := grpc.NewServer(grpc.ChainUnaryInterceptor(middleware.GRPCRequestID, kitgrpc.Interceptor))
 	// register service
 	pb.RegisterAddServer(baseServer, grpcServer)
 	// heath check register
-	grpc_health_v1.RegisterHealthServer(baseServer, NewHealthChecker())
+	grpc_health_v1.RegisterHealthServer(baseServer, health.GRPCServer())
 
-	return baseServer.Serve(grpcListener)
+	return baseServer, nil
 }
 
-func HttpServe(logger log.Logger) error {
+// NewHttpHandler builds the addsvc HTTP handler.
+func NewHttpHandler(logger log.Logger) (http.Handler, error) {
 	c := config.GetAddSvcConfig()
 
-	zipkinTracer, tracer, err := pkg.InitTracer(c.Name)
+	tracer, err := pkg.InitTracer(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ints, chars := metrics.GetServiceMetrics()
-	duration := metrics.GetEndpointMetrics()
+	red := metrics.GetEndpointMetrics().With("transport", "http")
 	var (
-		service     = services.NewService(logger, ints, chars)
-		endpoints   = endpoints.NewEndpoints(service, logger, duration, tracer, zipkinTracer)
-		httpHandler = transports.NewHTTPHandler(endpoints, tracer, zipkinTracer, logger)
+		service   = services.NewService(logger, ints, chars)
+		endpoints = endpoints.NewEndpoints(service, logger, red, tracer)
 	)
-
-	// The HTTP listener mounts the Go kit HTTP handler we created.
-	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.HttpPort))
-	if err != nil {
-		logger.Log("transport", "HTTP", "during", "Listen", "err", err)
-		return err
-	}
-
-	logger.Log("transport", "HTTP", "addr", fmt.Sprintf(":%d", c.HttpPort))
-	return http.Serve(httpListener, httpHandler)
+	return transports.NewHTTPHandler(endpoints, tracer, logger), nil
 }
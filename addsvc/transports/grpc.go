@@ -5,23 +5,20 @@ import (
 	"errors"
 	"time"
 
-	"github.com/go-kit/kit/circuitbreaker"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
-	"github.com/go-kit/kit/tracing/opentracing"
-	"github.com/go-kit/kit/tracing/zipkin"
-	"github.com/go-kit/kit/transport"
 	grpctransport "github.com/go-kit/kit/transport/grpc"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
 	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 
 	addendpoints "github.com/pascallin/go-kit-application/addsvc/endpoints"
 	"github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/middleware"
 	pb "github.com/pascallin/go-kit-application/pb/addsvc"
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
 type grpcServer struct {
@@ -31,22 +28,13 @@ type grpcServer struct {
 }
 
 // NewGRPCServer makes a set of endpoints available as a gRPC AddServer.
-func NewGRPCServer(endpoints addendpoints.Set, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, logger log.Logger) pb.AddServer {
+func NewGRPCServer(endpoints addendpoints.Set, tracer trace.Tracer, logger log.Logger) pb.AddServer {
+	// The server span is named after the gRPC method path, which the Go kit
+	// gRPC Interceptor puts in the context, so a single option serves both
+	// methods.
 	options := []grpctransport.ServerOption{
-		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
-	}
-
-	if zipkinTracer != nil {
-		// Zipkin GRPC Server Trace can either be instantiated per gRPC method with a
-		// provided operation name or a global tracing service can be instantiated
-		// without an operation name and fed to each Go kit gRPC server as a
-		// ServerOption.
-		// In the latter case, the operation name will be the endpoint's grpc method
-		// path if used in combination with the Go kit gRPC Interceptor.
-		//
-		// In this example, we demonstrate a global Zipkin tracing service with
-		// Go kit gRPC Interceptor.
-		options = append(options, zipkin.GRPCServerTrace(zipkinTracer))
+		grpctransport.ServerErrorHandler(middleware.NewLogErrorHandler(logger)),
+		middleware.GRPCServerTrace(tracer),
 	}
 
 	return &grpcServer{
@@ -54,13 +42,13 @@ func NewGRPCServer(endpoints addendpoints.Set, otTracer stdopentracing.Tracer, z
 			endpoints.SumEndpoint,
 			decodeGRPCSumRequest,
 			encodeGRPCSumResponse,
-			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "Sum", logger)))...,
+			options...,
 		),
 		concat: grpctransport.NewServer(
 			endpoints.ConcatEndpoint,
 			decodeGRPCConcatRequest,
 			encodeGRPCConcatResponse,
-			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "Concat", logger)))...,
+			options...,
 		),
 	}
 }
@@ -68,7 +56,7 @@ func NewGRPCServer(endpoints addendpoints.Set, otTracer stdopentracing.Tracer, z
 func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumReply, error) {
 	_, rep, err := s.sum.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 
 	return rep.(*pb.SumReply), nil
@@ -77,7 +65,7 @@ func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumReply,
 func (s *grpcServer) Concat(ctx context.Context, req *pb.ConcatRequest) (*pb.ConcatReply, error) {
 	_, rep, err := s.concat.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 	return rep.(*pb.ConcatReply), nil
 }
@@ -101,7 +89,7 @@ func decodeGRPCConcatRequest(_ context.Context, grpcReq interface{}) (interface{
 // gRPC sum reply to a user-domain sum response. Primarily useful in a client.
 func decodeGRPCSumResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
 	reply := grpcReply.(*pb.SumReply)
-	return addendpoints.SumResponse{V: int(reply.V), Err: str2err(reply.Err)}, nil
+	return addendpoints.SumResponse{V: int(reply.V)}, nil
 }
 
 // decodeGRPCConcatResponse is a transport/grpc.DecodeResponseFunc that converts
@@ -109,22 +97,29 @@ func decodeGRPCSumResponse(_ context.Context, grpcReply interface{}) (interface{
 // client.
 func decodeGRPCConcatResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
 	reply := grpcReply.(*pb.ConcatReply)
-	return addendpoints.ConcatResponse{V: reply.V, Err: str2err(reply.Err)}, nil
+	return addendpoints.ConcatResponse{V: reply.V}, nil
 }
 
 // encodeGRPCSumResponse is a transport/grpc.EncodeResponseFunc that converts a
-// user-domain sum response to a gRPC sum reply. Primarily useful in a server.
+// user-domain sum response to a gRPC sum reply, or its error to a status
+// error. Primarily useful in a server.
 func encodeGRPCSumResponse(_ context.Context, response interface{}) (interface{}, error) {
 	resp := response.(addendpoints.SumResponse)
-	return &pb.SumReply{V: int64(resp.V), Err: err2str(resp.Err)}, nil
+	if resp.Err != nil {
+		return nil, pkg.GRPCError(resp.Err)
+	}
+	return &pb.SumReply{V: int64(resp.V)}, nil
 }
 
 // encodeGRPCConcatResponse is a transport/grpc.EncodeResponseFunc that converts
-// a user-domain concat response to a gRPC concat reply. Primarily useful in a
-// server.
+// a user-domain concat response to a gRPC concat reply, or its error to a
+// status error. Primarily useful in a server.
 func encodeGRPCConcatResponse(_ context.Context, response interface{}) (interface{}, error) {
 	resp := response.(addendpoints.ConcatResponse)
-	return &pb.ConcatReply{V: resp.V, Err: err2str(resp.Err)}, nil
+	if resp.Err != nil {
+		return nil, pkg.GRPCError(resp.Err)
+	}
+	return &pb.ConcatReply{V: resp.V}, nil
 }
 
 // encodeGRPCSumRequest is a transport/grpc.EncodeRequestFunc that converts a
@@ -142,50 +137,57 @@ func encodeGRPCConcatRequest(_ context.Context, request interface{}) (interface{
 	return &pb.ConcatRequest{A: req.A, B: req.B}, nil
 }
 
-// These annoying helper functions are required to translate Go error types to
-// and from strings, which is the type we use in our IDLs to represent errors.
-// There is special casing to treat empty strings as nil errors.
+// encodeGRPCHealthRequest is a transport/grpc.EncodeRequestFunc that converts
+// a user-domain health request to a gRPC health check request of the Add
+// service. Primarily useful in a client.
+func encodeGRPCHealthRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return &grpc_health_v1.HealthCheckRequest{Service: pb.Add_ServiceDesc.ServiceName}, nil
+}
 
-func str2err(s string) error {
-	if s == "" {
-		return nil
-	}
-	return errors.New(s)
+// decodeGRPCHealthResponse is a transport/grpc.DecodeResponseFunc that
+// converts a gRPC health check response to a user-domain health response,
+// healthy if serving. Primarily useful in a client.
+func decodeGRPCHealthResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*grpc_health_v1.HealthCheckResponse)
+	return addendpoints.HealthResponse{Status: reply.Status == grpc_health_v1.HealthCheckResponse_SERVING}, nil
 }
 
-func err2str(err error) string {
-	if err == nil {
-		return ""
+// clientErrorMiddleware is an endpoint middleware turning the status errors
+// made by pkg.GRPCError back into the errors they were made from, so
+// errors.Is matches the errors of the service across the network. Primarily
+// useful in a client.
+func clientErrorMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := next(ctx, request)
+		if err != nil {
+			return nil, pkg.ErrorFromGRPC(err)
+		}
+		return response, nil
 	}
-	return err.Error()
 }
 
 // NewGRPCClient returns an AddService backed by a gRPC server at the other end
 // of the conn. The caller is responsible for constructing the conn, and
 // eventually closing the underlying transport. We bake-in certain middlewares,
 // implementing the client library pattern.
-func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, logger log.Logger) services.Service {
+func NewGRPCClient(conn *grpc.ClientConn, tracer trace.Tracer, logger log.Logger) services.Service {
 	// We construct a single ratelimiter middleware, to limit the total outgoing
 	// QPS from this client to all methods on the remote instance. We also
 	// construct per-endpoint circuitbreaker middlewares to demonstrate how
 	// that's done, although they could easily be combined into a single breaker
 	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
-
-	// global client middlewares
-	var options []grpctransport.ClientOption
-
-	if zipkinTracer != nil {
-		// Zipkin GRPC Client Trace can either be instantiated per gRPC method with a
-		// provided operation name or a global tracing client can be instantiated
-		// without an operation name and fed to each Go kit client as ClientOption.
-		// In the latter case, the operation name will be the endpoint's grpc method
-		// path.
-		//
-		// In this example, we demonstrace a global tracing client.
-		options = append(options, zipkin.GRPCClientTrace(zipkinTracer))
+	// Their settings follow the runtime configuration, addsvc.client for the
+	// limiter and addsvc.client.<method> for the breakers and timeouts.
+	limiter := pkg.RuntimeLimiter("addsvc.client", pkg.LimitSettings{RPS: 1, Burst: 100})
 
+	// global client middlewares, the token, the user authenticated at the
+	// gateway and the request ID are passed on, and each call is traced as a
+	// client span named after the gRPC method path
+	options := []grpctransport.ClientOption{
+		grpctransport.ClientBefore(kitjwt.ContextToGRPC(), middleware.ClaimsToGRPC, middleware.RequestIDToGRPC),
+		middleware.GRPCClientTrace(tracer),
 	}
+
 	// Each individual endpoint is an grpc/transport.Client (which implements
 	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
 	// made your own client library, you'd do this work there, so your server
@@ -199,14 +201,16 @@ func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkin
 			encodeGRPCSumRequest,
 			decodeGRPCSumResponse,
 			pb.SumReply{},
-			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
+			options...,
 		).Endpoint()
-		sumEndpoint = opentracing.TraceClient(otTracer, "Sum")(sumEndpoint)
+		sumEndpoint = clientErrorMiddleware(sumEndpoint)
+		sumEndpoint = pkg.RuntimeTimeout("addsvc.client.Sum", 0)(sumEndpoint)
 		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Sum",
-			Timeout: 30 * time.Second,
-		}))(sumEndpoint)
+		sumEndpoint = pkg.RuntimeBreaker("addsvc.client.Sum", gobreaker.Settings{
+			Name:         "addsvc.Sum@" + conn.Target(),
+			Timeout:      30 * time.Second,
+			IsSuccessful: isSuccessful,
+		})(sumEndpoint)
 	}
 
 	// The Concat endpoint is the same thing, with slightly different
@@ -220,21 +224,48 @@ func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkin
 			encodeGRPCConcatRequest,
 			decodeGRPCConcatResponse,
 			pb.ConcatReply{},
-			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
+			options...,
 		).Endpoint()
-		concatEndpoint = opentracing.TraceClient(otTracer, "Concat")(concatEndpoint)
+		concatEndpoint = clientErrorMiddleware(concatEndpoint)
+		concatEndpoint = pkg.RuntimeTimeout("addsvc.client.Concat", 0)(concatEndpoint)
 		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Concat",
-			Timeout: 10 * time.Second,
-		}))(concatEndpoint)
+		concatEndpoint = pkg.RuntimeBreaker("addsvc.client.Concat", gobreaker.Settings{
+			Name:         "addsvc.Concat@" + conn.Target(),
+			Timeout:      10 * time.Second,
+			IsSuccessful: isSuccessful,
+		})(concatEndpoint)
+	}
+
+	// The health check calls the gRPC health service of the remote instance
+	// about the Add service. It is neither limited nor broken, so it tells
+	// how the instance is rather than how this client is doing.
+	var healthCheckEndpoint endpoint.Endpoint
+	{
+		healthCheckEndpoint = grpctransport.NewClient(
+			conn,
+			grpc_health_v1.Health_ServiceDesc.ServiceName,
+			"Check",
+			encodeGRPCHealthRequest,
+			decodeGRPCHealthResponse,
+			grpc_health_v1.HealthCheckResponse{},
+			options...,
+		).Endpoint()
+		healthCheckEndpoint = pkg.RuntimeTimeout("addsvc.client.HealthCheck", 0)(healthCheckEndpoint)
 	}
 
 	// Returning the endpoint.Set as a service.Service relies on the
 	// endpoint.Set implementing the Service methods. That's just a simple bit
 	// of glue code.
 	return addendpoints.Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:         sumEndpoint,
+		ConcatEndpoint:      concatEndpoint,
+		HealthCheckEndpoint: healthCheckEndpoint,
 	}
 }
+
+// isSuccessful tells the breakers which errors are not the fault of the
+// instance, the rejected requests, but for ErrIntOverflow which we decided
+// indicates a misbehaving service.
+func isSuccessful(err error) bool {
+	return !pkg.IsServerError(err) && !errors.Is(err, services.ErrIntOverflow)
+}
@@ -0,0 +1,121 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	addendpoints "github.com/pascallin/go-kit-application/addsvc/endpoints"
+	"github.com/pascallin/go-kit-application/addsvc/services"
+	pb "github.com/pascallin/go-kit-application/pb/addsvc"
+)
+
+// newTestEndpoints returns the endpoints of the basic service, without the
+// limiters of NewEndpoints.
+func newTestEndpoints() addendpoints.Set {
+	svc := services.NewBasicService()
+	return addendpoints.Set{
+		SumEndpoint:         addendpoints.MakeSumEndpoint(svc),
+		ConcatEndpoint:      addendpoints.MakeConcatEndpoint(svc),
+		HealthCheckEndpoint: addendpoints.MakeHealthCheckEndpoint(svc),
+	}
+}
+
+func newTestGRPCClient(t *testing.T) (services.Service, *health.Server) {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterAddServer(server, NewGRPCServer(newTestEndpoints(), tracer, logger))
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewGRPCClient(conn, tracer, logger), healthServer
+}
+
+func TestSetService(t *testing.T) {
+	client, _ := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	for name, svc := range map[string]services.Service{
+		"grpc client":     client,
+		"local endpoints": newTestEndpoints(),
+	} {
+		for _, tc := range []struct {
+			name string
+			call func(services.Service) (interface{}, error)
+			want interface{}
+			err  error
+		}{
+			{"sum", func(s services.Service) (interface{}, error) { return s.Sum(ctx, 1, 2) }, 3, nil},
+			{"sum of two zeroes", func(s services.Service) (interface{}, error) { return s.Sum(ctx, 0, 0) }, 0, services.ErrTwoZeroes},
+			{"sum overflow", func(s services.Service) (interface{}, error) { return s.Sum(ctx, 1<<31-1, 1) }, 0, services.ErrIntOverflow},
+			{"concat", func(s services.Service) (interface{}, error) { return s.Concat(ctx, "a", "b") }, "ab", nil},
+			{"concat too long", func(s services.Service) (interface{}, error) { return s.Concat(ctx, "abcdef", "ghijkl") }, "", services.ErrMaxSizeExceeded},
+		} {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				v, err := tc.call(svc)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				if v != tc.want {
+					t.Fatalf("expected %v, got %v", tc.want, v)
+				}
+			})
+		}
+	}
+}
+
+func TestSetHealthCheck(t *testing.T) {
+	client, healthServer := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name   string
+		status grpc_health_v1.HealthCheckResponse_ServingStatus
+		want   bool
+	}{
+		{"serving", grpc_health_v1.HealthCheckResponse_SERVING, true},
+		{"not serving", grpc_health_v1.HealthCheckResponse_NOT_SERVING, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			healthServer.SetServingStatus(pb.Add_ServiceDesc.ServiceName, tc.status)
+			if ok := client.HealthCheck(ctx); ok != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, ok)
+			}
+		})
+	}
+
+	t.Run("failing endpoint", func(t *testing.T) {
+		set := addendpoints.Set{HealthCheckEndpoint: func(context.Context, interface{}) (interface{}, error) {
+			return nil, errors.New("unreachable")
+		}}
+		if set.HealthCheck(ctx) {
+			t.Fatal("expected a Set whose health check fails to be unhealthy")
+		}
+	})
+
+	t.Run("without endpoint", func(t *testing.T) {
+		if (addendpoints.Set{}).HealthCheck(ctx) {
+			t.Fatal("expected a Set without health check endpoint to be unhealthy")
+		}
+	})
+}
@@ -4,39 +4,34 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/tracing/opentracing"
-	"github.com/go-kit/kit/tracing/zipkin"
-	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
 
 	addendpoints "github.com/pascallin/go-kit-application/addsvc/endpoints"
-	addservices "github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
 // NewHTTPHandler returns an HTTP handler that makes a set of endpoints
 // available on predefined paths.
-func NewHTTPHandler(endpoints addendpoints.Set, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, logger log.Logger) http.Handler {
+func NewHTTPHandler(endpoints addendpoints.Set, tracer trace.Tracer, logger log.Logger) http.Handler {
+	// The server span is named after the method and path of the request, so a
+	// single option serves all the endpoints.
 	options := []httptransport.ServerOption{
-		httptransport.ServerErrorEncoder(errorEncoder),
-		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
-	}
-
-	if zipkinTracer != nil {
-		// Zipkin HTTP Server Trace can either be instantiated per endpoint with a
-		// provided operation name or a global tracing service can be instantiated
-		// without an operation name and fed to each Go kit endpoint as ServerOption.
-		// In the latter case, the operation name will be the endpoint's http method.
-		// We demonstrate a global tracing service here.
-		options = append(options, zipkin.HTTPServerTrace(zipkinTracer))
+		httptransport.ServerErrorEncoder(middleware.ErrorEncoder),
+		httptransport.ServerErrorHandler(middleware.NewLogErrorHandler(logger)),
+		middleware.HTTPServerTrace(tracer),
 	}
 
 	m := http.NewServeMux()
@@ -50,46 +45,109 @@ func NewHTTPHandler(endpoints addendpoints.Set, otTracer stdopentracing.Tracer,
 		endpoints.SumEndpoint,
 		DecodeHTTPSumRequest,
 		EncodeHTTPGenericResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Sum", logger)))...,
+		options...,
 	))
 	m.Handle("/concat", httptransport.NewServer(
 		endpoints.ConcatEndpoint,
 		DecodeHTTPConcatRequest,
 		EncodeHTTPGenericResponse,
-		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Concat", logger)))...,
+		options...,
 	))
-	return m
+	return middleware.RequestID(m)
 }
 
-func copyURL(base *url.URL, path string) *url.URL {
-	next := *base
-	next.Path = path
-	return &next
-}
+// NewHTTPClient returns an AddService backed by an HTTP server living at the
+// remote instance. We expect instance to come from a service discovery system,
+// so likely of the form "host:port". We bake-in certain middlewares,
+// implementing the client library pattern, the same as NewGRPCClient.
+func NewHTTPClient(instance string, tracer trace.Tracer, logger log.Logger) (services.Service, error) {
+	// Quickly sanitize the instance string.
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	u, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
 
-func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	w.WriteHeader(err2code(err))
-	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
-}
+	// As in NewGRPCClient, a single limiter for all the methods of the remote
+	// instance and a breaker per method, following the runtime configuration
+	// of addsvc.client and addsvc.client.<method>.
+	limiter := pkg.RuntimeLimiter("addsvc.client", pkg.LimitSettings{RPS: 1, Burst: 100})
+
+	// global client middlewares, the token and the request ID are passed on,
+	// and each call is traced as a client span named after the method and
+	// path of the request
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(kitjwt.ContextToHTTP(), middleware.RequestIDToHTTP),
+		middleware.HTTPClientTrace(tracer),
+	}
 
-func err2code(err error) int {
-	switch err {
-	case addservices.ErrTwoZeroes, addservices.ErrMaxSizeExceeded, addservices.ErrIntOverflow:
-		return http.StatusBadRequest
+	// Each individual endpoint is an http/transport.Client (which implements
+	// endpoint.Endpoint) that gets wrapped with various middlewares, the
+	// errors of the service being decoded from the problem details responses
+	// by the decoders.
+	var sumEndpoint endpoint.Endpoint
+	{
+		sumEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(u, "/sum"),
+			EncodeHTTPGenericRequest,
+			DecodeHTTPSumResponse,
+			options...,
+		).Endpoint()
+		sumEndpoint = pkg.RuntimeTimeout("addsvc.client.Sum", 0)(sumEndpoint)
+		sumEndpoint = limiter(sumEndpoint)
+		sumEndpoint = pkg.RuntimeBreaker("addsvc.client.Sum", gobreaker.Settings{
+			Name:         "addsvc.Sum@" + u.Host,
+			Timeout:      30 * time.Second,
+			IsSuccessful: isSuccessful,
+		})(sumEndpoint)
 	}
-	return http.StatusInternalServerError
-}
 
-func errorDecoder(r *http.Response) error {
-	var w errorWrapper
-	if err := json.NewDecoder(r.Body).Decode(&w); err != nil {
-		return err
+	var concatEndpoint endpoint.Endpoint
+	{
+		concatEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(u, "/concat"),
+			EncodeHTTPGenericRequest,
+			DecodeHTTPConcatResponse,
+			options...,
+		).Endpoint()
+		concatEndpoint = pkg.RuntimeTimeout("addsvc.client.Concat", 0)(concatEndpoint)
+		concatEndpoint = limiter(concatEndpoint)
+		concatEndpoint = pkg.RuntimeBreaker("addsvc.client.Concat", gobreaker.Settings{
+			Name:         "addsvc.Concat@" + u.Host,
+			Timeout:      10 * time.Second,
+			IsSuccessful: isSuccessful,
+		})(concatEndpoint)
 	}
-	return errors.New(w.Error)
+
+	// The health check asks /health of the remote instance, neither limited
+	// nor broken, as in NewGRPCClient.
+	var healthCheckEndpoint endpoint.Endpoint
+	{
+		healthCheckEndpoint = httptransport.NewClient(
+			http.MethodGet,
+			copyURL(u, "/health"),
+			encodeHTTPHealthRequest,
+			DecodeHTTPHealthResponse,
+			options...,
+		).Endpoint()
+		healthCheckEndpoint = pkg.RuntimeTimeout("addsvc.client.HealthCheck", 0)(healthCheckEndpoint)
+	}
+
+	return addendpoints.Set{
+		SumEndpoint:         sumEndpoint,
+		ConcatEndpoint:      concatEndpoint,
+		HealthCheckEndpoint: healthCheckEndpoint,
+	}, nil
 }
 
-type errorWrapper struct {
-	Error string `json:"error"`
+func copyURL(base *url.URL, path string) *url.URL {
+	next := *base
+	next.Path = path
+	return &next
 }
 
 // decodeHTTPSumRequest is a transport/http.DecodeRequestFunc that decodes a
@@ -121,7 +179,7 @@ func DecodeHealthRequest(_ context.Context, req *http.Request) (request interfac
 // client.
 func DecodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		return nil, middleware.DecodeProblem(r)
 	}
 	var resp addendpoints.SumResponse
 	err := json.NewDecoder(r.Body).Decode(&resp)
@@ -135,13 +193,31 @@ func DecodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, er
 // a client.
 func DecodeHTTPConcatResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		return nil, middleware.DecodeProblem(r)
 	}
 	var resp addendpoints.ConcatResponse
 	err := json.NewDecoder(r.Body).Decode(&resp)
 	return resp, err
 }
 
+// DecodeHTTPHealthResponse is a transport/http.DecodeResponseFunc that decodes
+// a JSON-encoded health response from the HTTP response body, the non-200
+// responses being errors. Primarily useful in a client.
+func DecodeHTTPHealthResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		return nil, middleware.DecodeProblem(r)
+	}
+	var resp addendpoints.HealthResponse
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	return resp, err
+}
+
+// encodeHTTPHealthRequest is a transport/http.EncodeRequestFunc for the health
+// requests, which have no body. Primarily useful in a client.
+func encodeHTTPHealthRequest(_ context.Context, _ *http.Request, _ interface{}) error {
+	return nil
+}
+
 // encodeHTTPGenericRequest is a transport/http.EncodeRequestFunc that
 // JSON-encodes any request to the request body. Primarily useful in a client.
 func EncodeHTTPGenericRequest(_ context.Context, r *http.Request, request interface{}) error {
@@ -157,7 +233,7 @@ func EncodeHTTPGenericRequest(_ context.Context, r *http.Request, request interf
 // the response as JSON to the response writer. Primarily useful in a server.
 func EncodeHTTPGenericResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if f, ok := response.(endpoint.Failer); ok && f.Failed() != nil {
-		errorEncoder(ctx, f.Failed(), w)
+		middleware.ErrorEncoder(ctx, f.Failed(), w)
 		return nil
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -0,0 +1,59 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/middleware"
+)
+
+func TestHTTPClient(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	var requestID string
+	handler := NewHTTPHandler(newTestEndpoints(), tracer, logger)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(middleware.RequestIDHeader)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(server.Listener.Addr().String(), tracer, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := middleware.ContextWithRequestID(context.Background(), "req-42")
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+		want interface{}
+		err  error
+	}{
+		{"sum", func() (interface{}, error) { return client.Sum(ctx, 1, 2) }, 3, nil},
+		{"sum of two zeroes", func() (interface{}, error) { return client.Sum(ctx, 0, 0) }, 0, services.ErrTwoZeroes},
+		{"concat", func() (interface{}, error) { return client.Concat(ctx, "a", "b") }, "ab", nil},
+		{"health check", func() (interface{}, error) { return client.HealthCheck(ctx), nil }, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.call()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if v != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, v)
+			}
+			if requestID != "req-42" {
+				t.Fatalf("request ID %q forwarded", requestID)
+			}
+		})
+	}
+}
@@ -3,15 +3,27 @@ package config
 import "time"
 
 type GatewayConfig struct {
-	HttpPort     int
-	RetryMax     int
-	RetryTimeout time.Duration
+	HttpPort int `yaml:"http_port" env:"GATEWAY_HTTP_PORT" envDefault:"9090" validate:"min=1,max=65535"`
+	// RetryMax and RetryTimeout apply to the calls the gateway makes on its
+	// own, the routes have theirs in the route table
+	RetryMax     int           `yaml:"retry_max" env:"GATEWAY_RETRY_MAX" envDefault:"3" validate:"min=1"`
+	RetryTimeout time.Duration `yaml:"retry_timeout" env:"GATEWAY_RETRY_TIMEOUT" envDefault:"500ms" validate:"min=1ms"`
+	// Routes is the route table file, YAML or JSON by extension
+	Routes string `yaml:"routes" env:"GATEWAY_ROUTES" envDefault:"gateway/routes.yaml" validate:"required"`
+	// TrustedProxies are the comma separated networks of the load balancers
+	// in front of the gateway, whose X-Forwarded-For is trusted. None by
+	// default, the gateway being the edge.
+	TrustedProxies string `yaml:"trusted_proxies" env:"GATEWAY_TRUSTED_PROXIES"`
 }
 
-func GetGatewayConfig() GatewayConfig {
-	return GatewayConfig{
-		HttpPort:     9090,
-		RetryMax:     3,
-		RetryTimeout: 500 * time.Microsecond,
+func (c *GatewayConfig) validate(errs *ValidationError, path string) {
+	if _, err := ParseNetworks(c.TrustedProxies); err != nil {
+		errs.add("%s: trusted_proxies: %v", path, err)
 	}
 }
+
+func GetGatewayConfig() GatewayConfig {
+	cfg := GatewayConfig{}
+	section(&cfg)
+	return cfg
+}
@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+type GatewayAuthConfig struct {
+	// Mode is how the gateway validates bearer tokens, "local" against the
+	// usersvc public keys, or "remote" by asking usersvc, which also catches
+	// revoked tokens
+	Mode string `yaml:"mode" env:"GATEWAY_AUTH_MODE" envDefault:"local" validate:"oneof=local remote"`
+	// JWKSRefresh is how long the usersvc public keys are cached
+	JWKSRefresh time.Duration `yaml:"jwks_refresh" env:"GATEWAY_JWKS_REFRESH" envDefault:"5m" validate:"min=1s"`
+	// VerdictTTL is how long a remote validation result is cached
+	VerdictTTL time.Duration `yaml:"verdict_ttl" env:"GATEWAY_VERDICT_TTL" envDefault:"30s" validate:"min=0s"`
+	// VerdictCacheSize bounds the number of cached validation results
+	VerdictCacheSize int `yaml:"verdict_cache_size" env:"GATEWAY_VERDICT_CACHE_SIZE" envDefault:"10000" validate:"min=1"`
+}
+
+func GetGatewayAuthConfig() GatewayAuthConfig {
+	cfg := GatewayAuthConfig{}
+	section(&cfg)
+	return cfg
+}
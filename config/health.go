@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+type HealthConfig struct {
+	// Interval is how often the dependencies are checked in the background
+	Interval time.Duration `yaml:"interval" env:"HEALTH_INTERVAL" envDefault:"10s" validate:"min=100ms"`
+	// Timeout bounds each check, a hanging dependency is a failing one
+	Timeout time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" envDefault:"2s" validate:"min=1ms"`
+}
+
+func GetHealthConfig() HealthConfig {
+	cfg := HealthConfig{}
+	section(&cfg)
+	return cfg
+}
@@ -1,20 +1,12 @@
 package config
 
-import (
-	"fmt"
-
-	"github.com/caarlos0/env/v6"
-)
-
 type InfraConfig struct {
-	ZIPKIN_URL string `env:"ZIPKIN_URL"`
-	CONSUL_URL string `env:"CONSUL_URL"`
+	ZIPKIN_URL string `yaml:"zipkin_url" env:"ZIPKIN_URL"`
+	CONSUL_URL string `yaml:"consul_url" env:"CONSUL_URL"`
 }
 
 func GetInfraConfig() InfraConfig {
 	cfg := InfraConfig{}
-	if err := env.Parse(&cfg); err != nil {
-		fmt.Printf("%+v\n", err)
-	}
+	section(&cfg)
 	return cfg
 }
@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+type LifecycleConfig struct {
+	// DrainTimeout is how long in-flight requests get to finish on shutdown,
+	// before the servers are stopped hard
+	DrainTimeout time.Duration `yaml:"drain_timeout" env:"SHUTDOWN_DRAIN_TIMEOUT" envDefault:"15s" validate:"min=0s"`
+	// CloseTimeout bounds closing the connections and flushing the tracer
+	CloseTimeout time.Duration `yaml:"close_timeout" env:"SHUTDOWN_CLOSE_TIMEOUT" envDefault:"5s" validate:"min=0s"`
+}
+
+func GetLifecycleConfig() LifecycleConfig {
+	cfg := LifecycleConfig{}
+	section(&cfg)
+	return cfg
+}
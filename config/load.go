@@ -0,0 +1,348 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPrinted is returned by Load when -print-config was given: the effective
+// configuration was printed and the binary should exit.
+var ErrPrinted = errors.New("config: printed")
+
+var (
+	mu      sync.RWMutex
+	current interface{}
+)
+
+// Load loads the configuration tree of the binary name into cfg, a pointer to
+// one of the trees such as *UsersvcTree, then validates it. A value comes
+// from, the latter winning:
+//
+//  1. the envDefault tag of its field, or the tree constructor
+//  2. the YAML file, -config or configs/<name>.yaml when it exists
+//  3. the profile YAML file, configs/<name>.<profile>.yaml, for -profile or APP_PROFILE
+//  4. the environment variable of the env tag, .env included
+//  5. the flag named after its YAML path, such as -service.http_port
+//
+// Load adds its flags to fs, then parses args. Once loaded, the Get*Config
+// functions return the sections of the tree.
+func Load(name string, cfg interface{}, fs *flag.FlagSet, args []string) error {
+	var (
+		file        = fs.String("config", "", "YAML configuration file (default configs/"+name+".yaml)")
+		profile     = fs.String("profile", os.Getenv("APP_PROFILE"), "configuration profile, overlaying configs/"+name+".<profile>.yaml (default APP_PROFILE)")
+		printConfig = fs.Bool("print-config", false, "print the effective configuration, secrets redacted, then exit")
+	)
+	leaves := fields(reflect.ValueOf(cfg).Elem(), "")
+	flags := make([]*flagValue, len(leaves))
+	for i, f := range leaves {
+		flags[i] = &flagValue{bool: f.value.Kind() == reflect.Bool}
+		usage := f.path
+		if f.env != "" {
+			usage = "env " + f.env
+		}
+		fs.Var(flags[i], f.path, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := applyDefaults(leaves); err != nil {
+		return err
+	}
+	sources := []string{"defaults"}
+	path, required := *file, true
+	if path == "" {
+		path, required = filepath.Join("configs", name+".yaml"), false
+	}
+	found, err := loadFile(path, required, cfg)
+	if err != nil {
+		return err
+	}
+	if found {
+		sources = append(sources, path)
+	}
+	if *profile != "" {
+		overlay := strings.TrimSuffix(path, filepath.Ext(path)) + "." + *profile + ".yaml"
+		if _, err := loadFile(overlay, true, cfg); err != nil {
+			return err
+		}
+		sources = append(sources, overlay)
+	}
+	if err := applyEnv(leaves); err != nil {
+		return err
+	}
+	sources = append(sources, "env")
+	for i, f := range leaves {
+		if !flags[i].set {
+			continue
+		}
+		if err := setValue(f.value, flags[i].raw); err != nil {
+			return fmt.Errorf("config: flag -%s: %w", f.path, err)
+		}
+	}
+	sources = append(sources, "flags")
+	complete(cfg)
+
+	if *printConfig {
+		fmt.Fprintf(os.Stdout, "# sources: %s\n", strings.Join(sources, ", "))
+		if err := Print(os.Stdout, cfg); err != nil {
+			return err
+		}
+		if err := Validate(cfg); err != nil {
+			return err
+		}
+		return ErrPrinted
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = cfg
+	return nil
+}
+
+// loadFile decodes a YAML file over cfg, unknown keys being errors. A missing
+// file is only an error when required.
+func loadFile(path string, required bool, cfg interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// section copies the section of the type out points to out of the loaded
+// tree. Without a loaded tree, or outside of it, the section gets its
+// defaults and the environment.
+func section(out interface{}) {
+	target := reflect.ValueOf(out).Elem()
+	if tree := loaded(); tree != nil {
+		v := reflect.ValueOf(tree).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).Type() == target.Type() {
+				target.Set(v.Field(i))
+				return
+			}
+		}
+	}
+	fromEnv(out)
+}
+
+// fromEnv fills the section out points to with its defaults and the
+// environment. Load reports the values which do not parse, here they are
+// skipped, leaving the fields at their default or zero value.
+func fromEnv(out interface{}) {
+	leaves := fields(reflect.ValueOf(out).Elem(), "")
+	_ = applyDefaults(leaves)
+	_ = applyEnv(leaves)
+	complete(out)
+}
+
+// loaded returns the tree given to Load, nil before.
+func loaded() interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// completer is implemented by the sections with defaults depending on other
+// fields, filled once every source was applied.
+type completer interface {
+	complete()
+}
+
+func complete(cfg interface{}) {
+	walkSections(reflect.ValueOf(cfg), "", func(v reflect.Value, path string) {
+		if c, ok := v.Interface().(completer); ok {
+			c.complete()
+		}
+	})
+}
+
+// walkSections calls fn with a pointer to every struct in the tree at v, v
+// included, and its YAML path.
+func walkSections(v reflect.Value, path string, fn func(v reflect.Value, path string)) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || v.Type() == durationType {
+		return
+	}
+	fn(v.Addr(), path)
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		walkSections(v.Field(i), keyOf(sf, path), fn)
+	}
+}
+
+// keyOf is the YAML path of a field, under the path of its struct.
+func keyOf(sf reflect.StructField, prefix string) string {
+	key := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		key = strings.ToLower(sf.Name)
+	}
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	return key
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a leaf of a configuration tree.
+type field struct {
+	// path is the dotted YAML path, which is also the flag name
+	path     string
+	env      string
+	def      string
+	hasDef   bool
+	validate string
+	secret   bool
+	value    reflect.Value
+}
+
+func fields(v reflect.Value, prefix string) []field {
+	var leaves []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("yaml") == "-" {
+			continue
+		}
+		key := keyOf(sf, prefix)
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			leaves = append(leaves, fields(v.Field(i), key)...)
+			continue
+		}
+		def, hasDef := sf.Tag.Lookup("envDefault")
+		leaves = append(leaves, field{
+			path:     key,
+			env:      sf.Tag.Get("env"),
+			def:      def,
+			hasDef:   hasDef,
+			validate: sf.Tag.Get("validate"),
+			secret:   sf.Tag.Get("secret") == "true",
+			value:    v.Field(i),
+		})
+	}
+	return leaves
+}
+
+// applyDefaults sets the leaves with a default to it. A default which does
+// not parse leaves its field as it is, the first one being returned once the
+// others are set.
+func applyDefaults(leaves []field) error {
+	var first error
+	for _, f := range leaves {
+		if !f.hasDef {
+			continue
+		}
+		if err := setValue(f.value, f.def); err != nil && first == nil {
+			first = fmt.Errorf("config: default of %s: %w", f.path, err)
+		}
+	}
+	return first
+}
+
+// applyEnv sets the leaves to their environment variable, those set. As for
+// applyDefaults, a variable which does not parse is skipped and returned.
+func applyEnv(leaves []field) error {
+	var first error
+	for _, f := range leaves {
+		if f.env == "" {
+			continue
+		}
+		// empty variables, as in .env.example, are unset ones
+		raw := os.Getenv(f.env)
+		if raw == "" {
+			continue
+		}
+		if err := setValue(f.value, raw); err != nil && first == nil {
+			first = fmt.Errorf("config: %s: %w", f.env, err)
+		}
+	}
+	return first
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue holds a flag until the other sources were applied.
+type flagValue struct {
+	raw  string
+	set  bool
+	bool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.raw
+}
+
+func (f *flagValue) Set(raw string) error {
+	f.raw, f.set = raw, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.bool }
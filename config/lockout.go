@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+type LockoutConfig struct {
+	// Threshold is the number of failed logins after which a username is locked
+	Threshold int `yaml:"threshold" env:"LOGIN_LOCKOUT_THRESHOLD" envDefault:"5" validate:"min=1"`
+	// IPThreshold is the number of failed logins after which a client IP is throttled
+	IPThreshold int `yaml:"ip_threshold" env:"LOGIN_IP_THRESHOLD" envDefault:"50" validate:"min=1"`
+	// Window is how long failed logins are remembered after the last one,
+	// and so how long a lockout lasts
+	Window      time.Duration `yaml:"window" env:"LOGIN_LOCKOUT_WINDOW" envDefault:"15m" validate:"min=1s"`
+	BackoffBase time.Duration `yaml:"backoff_base" env:"LOGIN_BACKOFF_BASE" envDefault:"1s" validate:"min=0s"`
+	BackoffMax  time.Duration `yaml:"backoff_max" env:"LOGIN_BACKOFF_MAX" envDefault:"1m" validate:"min=0s"`
+}
+
+func (c *LockoutConfig) validate(errs *ValidationError, path string) {
+	if c.BackoffBase > c.BackoffMax {
+		errs.add("%s: backoff_base %s is more than backoff_max %s", path, c.BackoffBase, c.BackoffMax)
+	}
+}
+
+func GetLockoutConfig() LockoutConfig {
+	cfg := LockoutConfig{}
+	section(&cfg)
+	return cfg
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MetricsConfig struct {
+	// Buckets are the comma separated upper bounds, in seconds, of the
+	// buckets of the request duration histograms
+	Buckets string `yaml:"buckets" env:"METRICS_BUCKETS" envDefault:"0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10"`
+	// DurationBuckets are the parsed Buckets, nil when they do not parse,
+	// which Load reports
+	DurationBuckets []float64 `yaml:"-"`
+}
+
+func (c *MetricsConfig) complete() {
+	c.DurationBuckets, _ = ParseBuckets(c.Buckets)
+}
+
+func (c *MetricsConfig) validate(errs *ValidationError, path string) {
+	if _, err := ParseBuckets(c.Buckets); err != nil {
+		errs.add("%s: %v", path, err)
+	}
+}
+
+// ParseBuckets parses comma separated, increasing, bucket upper bounds.
+func ParseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || bound <= 0 {
+			return nil, fmt.Errorf("bucket %q is not a positive number", field)
+		}
+		buckets = append(buckets, bound)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("buckets are required")
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		return nil, fmt.Errorf("buckets %q are not increasing", s)
+	}
+	return buckets, nil
+}
+
+func GetMetricsConfig() MetricsConfig {
+	cfg := MetricsConfig{}
+	section(&cfg)
+	return cfg
+}
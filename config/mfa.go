@@ -0,0 +1,14 @@
+package config
+
+type MFAConfig struct {
+	// Issuer names the account in authenticator apps
+	Issuer string `yaml:"issuer" env:"MFA_ISSUER" envDefault:"go-kit-application" validate:"required"`
+	// Skew is how many 30 seconds steps a TOTP code may be off by, either way
+	Skew int `yaml:"skew" env:"MFA_SKEW" envDefault:"1" validate:"min=0,max=10"`
+}
+
+func GetMFAConfig() MFAConfig {
+	cfg := MFAConfig{}
+	section(&cfg)
+	return cfg
+}
@@ -1,20 +1,13 @@
 package config
 
-import (
-	"fmt"
-
-	"github.com/caarlos0/env/v6"
-)
-
 type MongoConfig struct {
-	URI      string `env:"MONGODB_URI"`
-	DATABASE string `env:"MONGODB_DATABASE"`
+	// URI may hold the credentials
+	URI      string `yaml:"uri" env:"MONGODB_URI" validate:"required" secret:"true"`
+	DATABASE string `yaml:"database" env:"MONGODB_DATABASE" validate:"required"`
 }
 
 func GetMongoConfig() MongoConfig {
 	cfg := MongoConfig{}
-	if err := env.Parse(&cfg); err != nil {
-		fmt.Printf("%+v\n", err)
-	}
+	section(&cfg)
 	return cfg
 }
@@ -0,0 +1,38 @@
+package config
+
+import "time"
+
+type NotifierConfig struct {
+	// Notifier is how account emails are delivered: log or smtp
+	Notifier     string `yaml:"notifier" env:"NOTIFIER" envDefault:"log" validate:"oneof=log smtp"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST" envDefault:"localhost"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT" envDefault:"587" validate:"min=1,max=65535"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom     string `yaml:"smtp_from" env:"SMTP_FROM" envDefault:"no-reply@localhost"`
+}
+
+func (c *NotifierConfig) validate(errs *ValidationError, path string) {
+	if c.Notifier == "smtp" && (c.SMTPHost == "" || c.SMTPFrom == "") {
+		errs.add("%s: smtp_host and smtp_from are required by the smtp notifier", path)
+	}
+}
+
+func GetNotifierConfig() NotifierConfig {
+	cfg := NotifierConfig{}
+	section(&cfg)
+	return cfg
+}
+
+type AccountConfig struct {
+	// AccountURL is the front end base URL the emailed links point to
+	AccountURL     string        `yaml:"account_url" env:"ACCOUNT_URL" envDefault:"http://localhost:3000" validate:"required"`
+	ResetTokenTTL  time.Duration `yaml:"reset_token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" envDefault:"1h" validate:"min=1m"`
+	VerifyTokenTTL time.Duration `yaml:"verify_token_ttl" env:"EMAIL_VERIFY_TOKEN_TTL" envDefault:"48h" validate:"min=1m"`
+}
+
+func GetAccountConfig() AccountConfig {
+	cfg := AccountConfig{}
+	section(&cfg)
+	return cfg
+}
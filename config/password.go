@@ -0,0 +1,39 @@
+package config
+
+// bcryptMaxLength is the longest password, in bytes, bcrypt hashes.
+const bcryptMaxLength = 72
+
+type PasswordConfig struct {
+	// Algorithm is the hash algorithm used for new passwords: bcrypt, scrypt or argon2id
+	Algorithm string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM" envDefault:"bcrypt" validate:"oneof=bcrypt scrypt argon2id"`
+
+	MinLength int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" envDefault:"8" validate:"min=1"`
+	// MaxLength is in bytes and bounds the hashing cost, bcrypt refuses
+	// passwords longer than 72 bytes
+	MaxLength     int  `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" envDefault:"72" validate:"min=1,max=1024"`
+	RequireLower  bool `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER" envDefault:"true"`
+	RequireUpper  bool `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER" envDefault:"true"`
+	RequireDigit  bool `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT" envDefault:"true"`
+	RequireSymbol bool `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" envDefault:"false"`
+	// DisallowUsername rejects passwords containing the username
+	DisallowUsername bool `yaml:"disallow_username" env:"PASSWORD_DISALLOW_USERNAME" envDefault:"true"`
+	// DisallowCommon rejects passwords from the bundled common password list
+	DisallowCommon bool `yaml:"disallow_common" env:"PASSWORD_DISALLOW_COMMON" envDefault:"true"`
+	// History is how many previous passwords cannot be used again
+	History int `yaml:"history" env:"PASSWORD_HISTORY" envDefault:"5" validate:"min=0"`
+}
+
+func (c *PasswordConfig) validate(errs *ValidationError, path string) {
+	if c.MinLength > c.MaxLength {
+		errs.add("%s: min_length %d is more than max_length %d", path, c.MinLength, c.MaxLength)
+	}
+	if c.Algorithm == "bcrypt" && c.MaxLength > bcryptMaxLength {
+		errs.add("%s: max_length %d is more than the %d bytes bcrypt accepts", path, c.MaxLength, bcryptMaxLength)
+	}
+}
+
+func GetPasswordConfig() PasswordConfig {
+	cfg := PasswordConfig{}
+	section(&cfg)
+	return cfg
+}
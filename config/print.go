@@ -0,0 +1,29 @@
+package config
+
+import (
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the secrets in printed configurations.
+const Redacted = "[redacted]"
+
+// Print writes cfg, a pointer to a tree or a section, as YAML, the fields
+// tagged secret redacted when set.
+func Print(w io.Writer, cfg interface{}) error {
+	redacted := reflect.New(reflect.TypeOf(cfg).Elem())
+	redacted.Elem().Set(reflect.ValueOf(cfg).Elem())
+	for _, f := range fields(redacted.Elem(), "") {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(Redacted)
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(redacted.Interface()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -1,22 +1,14 @@
 package config
 
-import (
-	"fmt"
-
-	"github.com/caarlos0/env/v6"
-)
-
 type RedisConfig struct {
-	Host     string `env:"REDIS_HOST"`
-	Port     string `env:"REDIS_PORT"`
-	Password string `env:"REDIS_PASSWORD"`
-	Database string `env:"REDIS_DB"`
+	Host     string `yaml:"host" env:"REDIS_HOST" validate:"required"`
+	Port     string `yaml:"port" env:"REDIS_PORT" validate:"required"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"REDIS_DB"`
 }
 
 func GetRedisConfig() RedisConfig {
 	cfg := RedisConfig{}
-	if err := env.Parse(&cfg); err != nil {
-		fmt.Printf("%+v\n", err)
-	}
+	section(&cfg)
 	return cfg
 }
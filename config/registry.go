@@ -0,0 +1,27 @@
+package config
+
+type RegistryConfig struct {
+	// Backend is where services register and are discovered: consul, static
+	// or file
+	Backend string `yaml:"backend" env:"REGISTRY" envDefault:"consul" validate:"oneof=consul static file"`
+	// Static lists the instances of each service for the static backend, as
+	// addsvc=host:port,host:port;usersvc=host:port
+	Static string `yaml:"static" env:"REGISTRY_STATIC"`
+	// File is the JSON file of the file backend, watched for changes
+	File string `yaml:"file" env:"REGISTRY_FILE" envDefault:"registry.json"`
+}
+
+func (c *RegistryConfig) validate(errs *ValidationError, path string) {
+	if c.Backend == "static" && c.Static == "" {
+		errs.add("%s: static is required by the static backend", path)
+	}
+	if c.Backend == "file" && c.File == "" {
+		errs.add("%s: file is required by the file backend", path)
+	}
+}
+
+func GetRegistryConfig() RegistryConfig {
+	cfg := RegistryConfig{}
+	section(&cfg)
+	return cfg
+}
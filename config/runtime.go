@@ -0,0 +1,32 @@
+package config
+
+import "time"
+
+type RuntimeConfig struct {
+	// Source is where the runtime configuration, the limits, breakers,
+	// timeouts and log level applied without restart, is read from and
+	// watched: file, or consul KV
+	Source string `yaml:"source" env:"RUNTIME_CONFIG_SOURCE" envDefault:"file" validate:"oneof=file consul"`
+	// File is the YAML file of the file source, the code defaults apply while
+	// it does not exist
+	File string `yaml:"file" env:"RUNTIME_CONFIG_FILE"`
+	// ConsulKey is the KV key of the consul source, holding the same YAML
+	ConsulKey string `yaml:"consul_key" env:"RUNTIME_CONFIG_KEY"`
+	// ConsulWait bounds the blocking queries on the key
+	ConsulWait time.Duration `yaml:"consul_wait" env:"RUNTIME_CONFIG_CONSUL_WAIT" envDefault:"5m" validate:"min=1s"`
+}
+
+func (c *RuntimeConfig) validate(errs *ValidationError, path string) {
+	if c.Source == "file" && c.File == "" {
+		errs.add("%s: file is required by the file source", path)
+	}
+	if c.Source == "consul" && c.ConsulKey == "" {
+		errs.add("%s: consul_key is required by the consul source", path)
+	}
+}
+
+func GetRuntimeConfig() RuntimeConfig {
+	cfg := RuntimeConfig{}
+	section(&cfg)
+	return cfg
+}
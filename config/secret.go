@@ -1,19 +1,25 @@
 package config
 
-import (
-	"fmt"
-
-	"github.com/caarlos0/env/v6"
-)
+import "time"
 
 type AppSecret struct {
-	JwtSecret string `env:"JWT_SECRET"`
+	// JwtKeysDir holds the PEM private keys tokens are signed with, the last
+	// one in file name order signs. Keys are generated in memory when empty,
+	// which registered instances may not do.
+	JwtKeysDir string `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	// JwtAlgorithm of generated keys: RS256, ES256 or EdDSA
+	JwtAlgorithm string `yaml:"algorithm" env:"JWT_ALGORITHM" envDefault:"ES256" validate:"oneof=RS256 ES256 EdDSA"`
+	// JwtKeyRotation is how often keys are reloaded, or generated
+	JwtKeyRotation time.Duration `yaml:"key_rotation" env:"JWT_KEY_ROTATION" envDefault:"168h" validate:"min=1m"`
+	// JwtKeyOverlap is how long a retired key still verifies tokens, it
+	// should not be shorter than RefreshTokenTTL
+	JwtKeyOverlap   time.Duration `yaml:"key_overlap" env:"JWT_KEY_OVERLAP" envDefault:"720h" validate:"min=0s"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" envDefault:"1h" validate:"min=1s"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" envDefault:"720h" validate:"min=1s"`
 }
 
 func GetAppSecretConfig() AppSecret {
 	cfg := AppSecret{}
-	if err := env.Parse(&cfg); err != nil {
-		fmt.Printf("%+v\n", err)
-	}
+	section(&cfg)
 	return cfg
 }
@@ -12,35 +12,59 @@ func init() {
 }
 
 type ServiceConfig struct {
-	Host            string
-	HostName        string
-	Name            string
-	DebugPort       int
-	HttpPort        int
-	GrpcPort        int
-	IsNeedDiscovery bool
+	// Host is the address the service registers with, reachable by the
+	// gateway
+	Host string `yaml:"host" env:"SERVICE_HOST"`
+	// HostName is the instance ID in the registry, <name>-<hostname> when
+	// empty
+	HostName  string `yaml:"instance_id" env:"SERVICE_INSTANCE_ID" validate:"required"`
+	Name      string `yaml:"name" env:"SERVICE_NAME" validate:"required"`
+	DebugPort int    `yaml:"debug_port" env:"SERVICE_DEBUG_PORT" validate:"min=1,max=65535"`
+	HttpPort  int    `yaml:"http_port" env:"SERVICE_HTTP_PORT" validate:"min=1,max=65535"`
+	GrpcPort  int    `yaml:"grpc_port" env:"SERVICE_GRPC_PORT" validate:"min=1,max=65535"`
+	// IsNeedDiscovery registers the service in the registry, for the gateway
+	// to find it
+	IsNeedDiscovery bool `yaml:"register" env:"SERVICE_REGISTER" envDefault:"false"`
+	// TrustedProxies are the comma separated networks of the proxies, the
+	// gateway, whose X-Forwarded-For is trusted for the client address. Only
+	// loopback by default, a gateway on another host must be added
+	TrustedProxies string `yaml:"trusted_proxies" env:"SERVICE_TRUSTED_PROXIES" envDefault:"127.0.0.0/8,::1/128"`
+}
+
+func (c *ServiceConfig) complete() {
+	if c.HostName != "" || c.Name == "" {
+		return
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	c.HostName = c.Name + "-" + hostname
+}
+
+func (c *ServiceConfig) validate(errs *ValidationError, path string) {
+	if c.DebugPort == c.HttpPort || c.DebugPort == c.GrpcPort || c.HttpPort == c.GrpcPort {
+		errs.add("%s: debug_port, http_port and grpc_port must differ", path)
+	}
+	if _, err := ParseNetworks(c.TrustedProxies); err != nil {
+		errs.add("%s: trusted_proxies: %v", path, err)
+	}
 }
 
 func GetAddSvcConfig() ServiceConfig {
-	return ServiceConfig{
-		Host:            os.Getenv("SERVICE_HOST"),
-		HostName:        "addsvc-test-1",
-		Name:            "addsvc",
-		DebugPort:       9081,
-		HttpPort:        9082,
-		GrpcPort:        9083,
-		IsNeedDiscovery: false,
+	if tree, ok := loaded().(*AddsvcTree); ok {
+		return tree.Service
 	}
+	cfg := NewAddsvcTree().Service
+	fromEnv(&cfg)
+	return cfg
 }
 
 func GetUserSvcConfig() ServiceConfig {
-	return ServiceConfig{
-		Host:            os.Getenv("SERVICE_HOST"),
-		HostName:        "usersvc-test-1",
-		Name:            "usersvc",
-		DebugPort:       9091,
-		HttpPort:        9092,
-		GrpcPort:        9093,
-		IsNeedDiscovery: false,
+	if tree, ok := loaded().(*UsersvcTree); ok {
+		return tree.Service
 	}
+	cfg := NewUsersvcTree().Service
+	fromEnv(&cfg)
+	return cfg
 }
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Propagators are the trace context formats TracingConfig.Propagators
+// accepts, named after OTEL_PROPAGATORS.
+var Propagators = []string{"tracecontext", "baggage", "b3", "b3multi"}
+
+type TracingConfig struct {
+	// Exporter is where spans are sent: otlp-grpc, otlp-http, zipkin, stdout,
+	// or none to only propagate the trace context
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" envDefault:"none" validate:"oneof=none otlp-grpc otlp-http zipkin stdout"`
+	// Endpoint is the collector, host:port for OTLP, the spans URL for
+	// zipkin. When empty, OTLP follows OTEL_EXPORTER_OTLP_ENDPOINT and zipkin
+	// infra.zipkin_url
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	// Insecure sends OTLP without TLS
+	Insecure bool `yaml:"insecure" env:"TRACING_INSECURE" envDefault:"true"`
+	// SampleRatio is the share of traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" envDefault:"1" validate:"min=0,max=1"`
+	// ParentBased follows the sampling decision of the caller, the ratio only
+	// applying to the traces starting here
+	ParentBased bool `yaml:"parent_based" env:"TRACING_PARENT_BASED" envDefault:"true"`
+	// Propagators are the comma separated formats the trace context is read
+	// from and written in: tracecontext, baggage, b3 or b3multi
+	Propagators string `yaml:"propagators" env:"TRACING_PROPAGATORS" envDefault:"tracecontext,baggage,b3multi"`
+	// Attributes are added to the resource describing the service, as
+	// key=value,key=value
+	Attributes string `yaml:"attributes" env:"TRACING_ATTRIBUTES"`
+}
+
+func (c *TracingConfig) validate(errs *ValidationError, path string) {
+	for _, name := range strings.Split(c.Propagators, ",") {
+		if !contains(Propagators, strings.TrimSpace(name)) {
+			errs.add("%s: unknown propagator %q, expected one of %s", path, name, strings.Join(Propagators, ", "))
+		}
+	}
+	if _, err := ParseAttributes(c.Attributes); err != nil {
+		errs.add("%s: %v", path, err)
+	}
+}
+
+// ParseAttributes parses key=value,key=value pairs.
+func ParseAttributes(s string) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("attribute %q is not key=value", pair)
+		}
+		attributes[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return attributes, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func GetTracingConfig() TracingConfig {
+	cfg := TracingConfig{}
+	section(&cfg)
+	return cfg
+}
@@ -0,0 +1,76 @@
+package config
+
+// AddsvcTree is the configuration of the addsvc binary.
+type AddsvcTree struct {
+	Service   ServiceConfig   `yaml:"service"`
+	Registry  RegistryConfig  `yaml:"registry"`
+	Health    HealthConfig    `yaml:"health"`
+	Lifecycle LifecycleConfig `yaml:"lifecycle"`
+	Infra     InfraConfig     `yaml:"infra"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Runtime   RuntimeConfig   `yaml:"runtime"`
+}
+
+func NewAddsvcTree() *AddsvcTree {
+	return &AddsvcTree{
+		Service: ServiceConfig{Name: "addsvc", DebugPort: 9081, HttpPort: 9082, GrpcPort: 9083},
+		Runtime: runtimeOf("addsvc"),
+	}
+}
+
+// UsersvcTree is the configuration of the usersvc binary.
+type UsersvcTree struct {
+	Service   ServiceConfig   `yaml:"service"`
+	Registry  RegistryConfig  `yaml:"registry"`
+	Health    HealthConfig    `yaml:"health"`
+	Lifecycle LifecycleConfig `yaml:"lifecycle"`
+	Infra     InfraConfig     `yaml:"infra"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	Redis     RedisConfig     `yaml:"redis"`
+	JWT       AppSecret       `yaml:"jwt"`
+	Password  PasswordConfig  `yaml:"password"`
+	Lockout   LockoutConfig   `yaml:"lockout"`
+	MFA       MFAConfig       `yaml:"mfa"`
+	Notifier  NotifierConfig  `yaml:"notifier"`
+	Account   AccountConfig   `yaml:"account"`
+	Runtime   RuntimeConfig   `yaml:"runtime"`
+}
+
+// validate requires the signing keys of the registered instances to come
+// from a directory, every instance behind the gateway has to verify the
+// tokens the others signed.
+func (t *UsersvcTree) validate(errs *ValidationError, path string) {
+	if t.Service.IsNeedDiscovery && t.JWT.JwtKeysDir == "" {
+		errs.add("jwt.keys_dir (JWT_KEYS_DIR): is required when service.register is set")
+	}
+}
+
+func NewUsersvcTree() *UsersvcTree {
+	return &UsersvcTree{
+		Service: ServiceConfig{Name: "usersvc", DebugPort: 9091, HttpPort: 9092, GrpcPort: 9093},
+		Runtime: runtimeOf("usersvc"),
+	}
+}
+
+// GatewayTree is the configuration of the gateway binary.
+type GatewayTree struct {
+	Gateway   GatewayConfig     `yaml:"gateway"`
+	Auth      GatewayAuthConfig `yaml:"auth"`
+	Registry  RegistryConfig    `yaml:"registry"`
+	Health    HealthConfig      `yaml:"health"`
+	Lifecycle LifecycleConfig   `yaml:"lifecycle"`
+	Infra     InfraConfig       `yaml:"infra"`
+	Tracing   TracingConfig     `yaml:"tracing"`
+	Runtime   RuntimeConfig     `yaml:"runtime"`
+}
+
+func NewGatewayTree() *GatewayTree {
+	return &GatewayTree{Runtime: runtimeOf("gateway")}
+}
+
+func runtimeOf(name string) RuntimeConfig {
+	return RuntimeConfig{File: "configs/runtime/" + name + ".yaml", ConsulKey: "go-kit-application/" + name + "/runtime"}
+}
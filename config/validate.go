@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError lists everything wrong with a configuration, so all of it
+// can be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// validator is implemented by the sections with rules spanning several
+// fields, path being the YAML path of the section.
+type validator interface {
+	validate(errs *ValidationError, path string)
+}
+
+// Validate checks cfg, a pointer to a tree or a section, against the validate
+// tags of its fields, comma separated rules among
+//
+//	required        not the zero value
+//	min=1, max=5s   bounds of numbers and durations
+//	oneof=a b c     one of the space separated values
+//
+// then against the rules of its sections.
+func Validate(cfg interface{}) error {
+	errs := &ValidationError{}
+	for _, f := range fields(reflect.ValueOf(cfg).Elem(), "") {
+		name := f.path
+		if f.env != "" {
+			name += " (" + f.env + ")"
+		}
+		for _, rule := range strings.Split(f.validate, ",") {
+			if rule == "" {
+				continue
+			}
+			if problem := check(f.value, rule); problem != "" {
+				errs.add("%s: %s", name, problem)
+			}
+		}
+	}
+	walkSections(reflect.ValueOf(cfg), "", func(v reflect.Value, path string) {
+		if s, ok := v.Interface().(validator); ok {
+			s.validate(errs, path)
+		}
+	})
+	if len(errs.Problems) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func check(v reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(arg) {
+			if value == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(strings.Fields(arg), ", "))
+	case "min", "max":
+		n, bound, err := numbers(v, arg)
+		if err != nil {
+			return fmt.Sprintf("bad rule %q: %v", rule, err)
+		}
+		if name == "min" && n < bound {
+			return fmt.Sprintf("%s is less than %s", display(v), arg)
+		}
+		if name == "max" && n > bound {
+			return fmt.Sprintf("%s is more than %s", display(v), arg)
+		}
+	default:
+		return fmt.Sprintf("unknown rule %q", rule)
+	}
+	return ""
+}
+
+// numbers returns the value and the bound of a min or max rule, durations
+// bounds being durations.
+func numbers(v reflect.Value, arg string) (float64, float64, error) {
+	if v.Type() == durationType {
+		bound, err := time.ParseDuration(arg)
+		return float64(v.Int()), float64(bound), err
+	}
+	bound, err := strconv.ParseFloat(arg, 64)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		return float64(v.Int()), bound, err
+	case reflect.Float64:
+		return v.Float(), bound, err
+	}
+	return 0, 0, fmt.Errorf("not a number but %s", v.Type())
+}
+
+func display(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,25 @@
+package conn
+
+import (
+	"context"
+	"fmt"
+)
+
+// Close closes the connections opened so far, on shutdown. All of them are
+// closed even if some fail.
+func Close(ctx context.Context) error {
+	var errs []error
+	if err := CloseMongo(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("mongo: %w", err))
+	}
+	if err := CloseRedis(); err != nil {
+		errs = append(errs, fmt.Errorf("redis: %w", err))
+	}
+	if err := CloseMysql(); err != nil {
+		errs = append(errs, fmt.Errorf("mysql: %w", err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("close connections: %v", errs)
+	}
+	return nil
+}
@@ -2,10 +2,13 @@ package conn
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/go-kit/kit/metrics"
 	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -26,13 +29,40 @@ type Mongo struct {
 var (
 	mgOnce sync.Once
 	_mongo *Mongo
+	// mgMonitor observes the commands of the client, see SetMongoMonitor
+	mgMonitor *event.CommandMonitor
 )
 
+// SetMongoMonitor sets the command monitor of the client GetMongo connects,
+// it has to be called before GetMongo is.
+func SetMongoMonitor(monitor *event.CommandMonitor) {
+	mgMonitor = monitor
+}
+
+// NewMongoMonitor returns a command monitor observing the duration of the
+// commands in duration, labelled by command and outcome, success or failure.
+func NewMongoMonitor(duration metrics.Histogram) *event.CommandMonitor {
+	observe := func(e event.CommandFinishedEvent, outcome string) {
+		duration.With("command", e.CommandName, "outcome", outcome).Observe(time.Duration(e.DurationNanos).Seconds())
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observe(e.CommandFinishedEvent, "success")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observe(e.CommandFinishedEvent, "failure")
+		},
+	}
+}
+
 func GetMongo(ctx context.Context) (*Mongo, error) {
 	mgOnce.Do(func() {
 		connectionURI := config.GetMongoConfig().URI
 
 		opts := options.Client().ApplyURI(connectionURI).SetConnectTimeout(connectTimeout)
+		if mgMonitor != nil {
+			opts.SetMonitor(mgMonitor)
+		}
 		client, err := mongo.Connect(ctx, opts)
 		if err != nil {
 			log.Error("GetMongo err", err)
@@ -63,3 +93,19 @@ func Ping() string {
 
 	return "ok"
 }
+
+// CloseMongo disconnects from MongoDB, if connected.
+func CloseMongo(ctx context.Context) error {
+	if _mongo == nil {
+		return nil
+	}
+	return _mongo.Client.Disconnect(ctx)
+}
+
+// PingMongo checks MongoDB answers, as a health check.
+func PingMongo(ctx context.Context) error {
+	if _mongo == nil {
+		return errors.New("mongo: not connected")
+	}
+	return _mongo.Client.Ping(ctx, readpref.Primary())
+}
@@ -1,6 +1,8 @@
 package conn
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -54,3 +56,28 @@ func openMysql() (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// CloseMysql closes the MySQL connection pool, if opened.
+func CloseMysql() error {
+	if mysqlSingleInstance == nil {
+		return nil
+	}
+	sqlDB, err := mysqlSingleInstance.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// PingMysql checks MySQL answers, as a health check.
+func PingMysql(ctx context.Context) error {
+	db := GetMysqlDB()
+	if db == nil {
+		return errors.New("mysql: not connected")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -1,6 +1,8 @@
 package conn
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
@@ -11,6 +13,9 @@ import (
 	"github.com/pascallin/go-kit-application/config"
 )
 
+// ErrRedisNotConnected is returned when the Redis client could not be made.
+var ErrRedisNotConnected = errors.New("redis: not connected")
+
 var (
 	ronce               sync.Once
 	redisSingleInstance *redis.Client
@@ -45,3 +50,20 @@ func initRedis() (*redis.Client, error) {
 
 	return rdb, nil
 }
+
+// CloseRedis closes the Redis client, if opened.
+func CloseRedis() error {
+	if redisSingleInstance == nil {
+		return nil
+	}
+	return redisSingleInstance.Close()
+}
+
+// PingRedis checks Redis answers, as a health check.
+func PingRedis(ctx context.Context) error {
+	rdb := GetRedis()
+	if rdb == nil {
+		return ErrRedisNotConnected
+	}
+	return rdb.Ping(ctx).Err()
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/log"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+func newTestTokens(t *testing.T, algorithm string) (*services.KeySet, *services.TokenManager) {
+	keys, err := services.NewKeySet("", algorithm, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, services.NewTokenManager(services.NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+}
+
+func issue(t *testing.T, tokens *services.TokenManager, identity model.Identity) model.TokenPair {
+	pair, err := tokens.Issue(context.Background(), identity, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys, tokens := newTestTokens(t, algorithm)
+			fetches := 0
+			verifier := NewJWKSVerifier(func(context.Context) (model.JWKS, error) {
+				fetches++
+				return keys.JWKS(), nil
+			}, time.Hour, log.NewNopLogger())
+
+			pair := issue(t, tokens, model.Identity{Username: "pascal", Roles: []string{model.RoleUser}})
+			claims, err := verifier.Verify(context.Background(), pair.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Username != "pascal" {
+				t.Fatalf("expected pascal, got %s", claims.Username)
+			}
+			if _, err := verifier.Verify(context.Background(), pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected refresh tokens to be rejected, got %v", err)
+			}
+			if _, err := verifier.Verify(context.Background(), pair.AccessToken+"x"); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected a tampered token to be rejected, got %v", err)
+			}
+			if fetches != 1 {
+				t.Fatalf("expected the keys to be fetched once, got %d", fetches)
+			}
+		})
+	}
+}
+
+func TestJWKSVerifierUnknownKey(t *testing.T) {
+	keys, _ := newTestTokens(t, "ES256")
+	_, otherTokens := newTestTokens(t, "ES256")
+	fetches := 0
+	verifier := NewJWKSVerifier(func(context.Context) (model.JWKS, error) {
+		fetches++
+		return keys.JWKS(), nil
+	}, time.Hour, log.NewNopLogger())
+
+	forged := issue(t, otherTokens, model.Identity{Username: "pascal"})
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(context.Background(), forged.AccessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected unknown keys not to refetch more than once in a while, got %d fetches", fetches)
+	}
+}
+
+func TestJWKSVerifierUnavailable(t *testing.T) {
+	_, tokens := newTestTokens(t, "ES256")
+	verifier := NewJWKSVerifier(func(context.Context) (model.JWKS, error) {
+		return model.JWKS{}, errors.New("connection refused")
+	}, time.Hour, log.NewNopLogger())
+
+	pair := issue(t, tokens, model.Identity{Username: "pascal"})
+	if _, err := verifier.Verify(context.Background(), pair.AccessToken); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+// TestJWKSVerifierSlowFetch checks that a slow fetch of the keys neither
+// holds up the tokens signed by a cached key, nor is repeated by the requests
+// waiting for it.
+func TestJWKSVerifierSlowFetch(t *testing.T) {
+	keys, tokens := newTestTokens(t, "ES256")
+	var fetches int32
+	release := make(chan struct{})
+	verifier := NewJWKSVerifier(func(context.Context) (model.JWKS, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return keys.JWKS(), nil
+	}, time.Millisecond, log.NewNopLogger())
+	pair := issue(t, tokens, model.Identity{Username: "pascal"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := verifier.Verify(context.Background(), pair.AccessToken); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("expected the waiting requests to share one fetch, got %d", n)
+	}
+
+	// the keys are stale, and fetched again without waiting for them
+	release = make(chan struct{})
+	defer close(release)
+	time.Sleep(2 * time.Millisecond)
+	verifier.mu.Lock()
+	verifier.triedAt = time.Time{}
+	verifier.mu.Unlock()
+	done := make(chan error)
+	go func() {
+		_, err := verifier.Verify(context.Background(), pair.AccessToken)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the cached key to be used while the keys are fetched")
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&fetches) != 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the stale keys to be fetched again")
+		}
+	}
+}
+
+func TestRemoteVerifier(t *testing.T) {
+	calls := 0
+	verdicts := map[string]error{
+		"valid":   nil,
+		"revoked": services.ErrTokenRevoked,
+		"down":    errors.New("connection refused"),
+	}
+	verifier := NewRemoteVerifier(func(_ context.Context, token string) (*model.CustomerClaims, error) {
+		calls++
+		if err := verdicts[token]; err != nil {
+			return nil, err
+		}
+		return &model.CustomerClaims{Username: "pascal"}, nil
+	}, time.Minute, 10)
+
+	for _, tc := range []struct {
+		token string
+		err   error
+		calls int
+	}{
+		{"valid", nil, 1},
+		{"valid", nil, 1},
+		{"revoked", ErrInvalidToken, 2},
+		{"revoked", ErrInvalidToken, 2},
+		{"down", ErrUnavailable, 3},
+		{"down", ErrUnavailable, 4},
+	} {
+		_, err := verifier.Verify(context.Background(), tc.token)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected %v, got %v", tc.token, tc.err, err)
+		}
+		if calls != tc.calls {
+			t.Fatalf("%s: expected %d calls to usersvc, got %d", tc.token, tc.calls, calls)
+		}
+	}
+}
+
+type fakeVerifier map[string]*model.CustomerClaims
+
+func (f fakeVerifier) Verify(_ context.Context, token string) (*model.CustomerClaims, error) {
+	if token == "down" {
+		return nil, ErrUnavailable
+	}
+	claims, ok := f[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier := fakeVerifier{
+		"user":  {Username: "user"},
+		"adder": {Username: "adder", Permissions: []string{model.PermAddsvcUse}},
+	}
+	rules := Rules{
+		{Prefix: "/addsvc", Permission: model.PermAddsvcUse},
+		{Prefix: "/addsvc/health", Public: true},
+		{Prefix: "/usersvc/me"},
+	}
+	var seen *model.CustomerClaims
+	handler := Middleware(verifier, rules, log.NewNopLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = middleware.ClaimsFromContext(r.Context())
+		if claims, ok := middleware.ClaimsFromContext(r.Context()); ok && r.Context().Value(kitjwt.JWTContextKey) != claims.Username {
+			t.Errorf("expected the token in the context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		token string
+		code  int
+		user  string
+	}{
+		{"public route", "/addsvc/health", "", http.StatusOK, ""},
+		{"missing token", "/addsvc/sum", "", http.StatusUnauthorized, ""},
+		{"invalid token", "/addsvc/sum", "forged", http.StatusUnauthorized, ""},
+		{"missing permission", "/addsvc/sum", "user", http.StatusForbidden, ""},
+		{"with permission", "/addsvc/sum", "adder", http.StatusOK, "adder"},
+		{"authentication only", "/usersvc/me", "user", http.StatusOK, "user"},
+		{"unmatched routes are protected", "/other", "", http.StatusUnauthorized, ""},
+		{"usersvc unavailable", "/usersvc/me", "down", http.StatusServiceUnavailable, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = nil
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.code {
+				t.Fatalf("expected %d, got %d", tc.code, w.Code)
+			}
+			if tc.user != "" && (seen == nil || seen.Username != tc.user) {
+				t.Fatalf("expected the claims of %s in the context, got %+v", tc.user, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+// minJWKSRefresh is the least time between two fetches of the keys, so tokens
+// with made up key IDs cannot make the gateway hammer usersvc.
+const minJWKSRefresh = 10 * time.Second
+
+var errUnsupportedJWK = errors.New("unsupported JWK")
+
+// JWKSVerifier validates tokens locally, against the public keys of usersvc.
+// The keys are cached and fetched again after refresh, in the background, or
+// as soon as a token signed by an unknown key shows up, which happens after a
+// key rotation. Revoked tokens cannot be told apart locally, they are
+// accepted until they expire.
+type JWKSVerifier struct {
+	fetch   func(ctx context.Context) (model.JWKS, error)
+	refresh time.Duration
+	logger  log.Logger
+	// fetches collapses the concurrent fetches of the keys into one
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// triedAt is when the keys were last fetched, whether they were or not
+	triedAt time.Time
+}
+
+func NewJWKSVerifier(fetch func(ctx context.Context) (model.JWKS, error), refresh time.Duration, logger log.Logger) *JWKSVerifier {
+	return &JWKSVerifier{fetch: fetch, refresh: refresh, logger: logger}
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (*model.CustomerClaims, error) {
+	claims := &model.CustomerClaims{}
+	var keyErr error
+	parser := jwt.NewParser(jwt.WithValidMethods(services.AllowedAlgorithms))
+	parsed, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		keyErr = err
+		return key, err
+	})
+	if errors.Is(keyErr, ErrUnavailable) {
+		return nil, ErrUnavailable
+	}
+	if err != nil || !parsed.Valid || claims.TokenType != model.AccessToken || claims.Id == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// key returns the public key kid. Stale keys are still returned while they
+// are fetched again, the requests only wait for keys they do not have.
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	fetched := v.keys != nil
+	age, tried := time.Since(v.fetchedAt), time.Since(v.triedAt)
+	v.mu.Unlock()
+
+	if ok {
+		// when usersvc is down, keep verifying with the keys we have
+		if age >= v.refresh && tried >= minJWKSRefresh {
+			v.fetches.DoChan("jwks", v.update)
+		}
+		return key, nil
+	}
+	if fetched && age < minJWKSRefresh {
+		return nil, ErrInvalidToken
+	}
+
+	select {
+	case result := <-v.fetches.DoChan("jwks", v.update):
+		if result.Err != nil {
+			return nil, ErrUnavailable
+		}
+	case <-ctx.Done():
+		return nil, ErrUnavailable
+	}
+	v.mu.Lock()
+	key, ok = v.keys[kid]
+	v.mu.Unlock()
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+// update fetches the keys, once for all the requests waiting for them.
+func (v *JWKSVerifier) update() (interface{}, error) {
+	v.mu.Lock()
+	v.triedAt = time.Now()
+	v.mu.Unlock()
+
+	// shared by several requests, the fetch is not canceled with any of them
+	jwks, err := v.fetch(context.Background())
+	if err != nil {
+		v.logger.Log("during", "fetch JWKS", "err", err)
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		pub, err := publicKey(jwk)
+		if err != nil {
+			v.logger.Log("during", "parse JWK", "kid", jwk.Kid, "err", err)
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+
+	v.mu.Lock()
+	v.keys, v.fetchedAt = keys, time.Now()
+	v.mu.Unlock()
+	return nil, nil
+}
+
+// publicKey decodes the public key of a JWK, as encoded by services.KeySet.
+func publicKey(jwk model.JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Crv != elliptic.P256().Params().Name {
+			return nil, errUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errUnsupportedJWK
+		}
+		return pub, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errUnsupportedJWK
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errUnsupportedJWK
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+
+	"github.com/pascallin/go-kit-application/middleware"
+)
+
+// Rule is the access policy of the requests whose path starts with Prefix.
+type Rule struct {
+	Prefix string
+	// Public routes are passed through without looking at the token, the
+	// service behind does its own checks if any
+	Public bool
+	// Permission is required from the token of protected routes, an empty
+	// permission only requires a valid token
+	Permission string
+}
+
+// Rules are matched by longest prefix. Paths no rule matches are protected.
+type Rules []Rule
+
+func (rules Rules) match(path string) Rule {
+	matched := Rule{}
+	for _, rule := range rules {
+		if strings.HasPrefix(path, rule.Prefix) && len(rule.Prefix) >= len(matched.Prefix) {
+			matched = rule
+		}
+	}
+	return matched
+}
+
+// Middleware authenticates the requests to protected routes with their bearer
+// token. The token and its claims are stored in the request context, under
+// kitjwt.JWTContextKey and kitjwt.JWTClaimsContextKey, from where the gRPC
+// clients forward them to the services.
+func Middleware(verifier Verifier, rules Rules, logger log.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := rules.match(r.URL.Path)
+			if rule.Public {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				middleware.ErrorEncoder(r.Context(), middleware.ErrUnauthenticated, w)
+				return
+			}
+			claims, err := verifier.Verify(r.Context(), token)
+			if errors.Is(err, ErrUnavailable) {
+				level.Error(middleware.ContextLogger(r.Context(), logger)).Log("path", r.URL.Path, "err", err)
+				middleware.ErrorEncoder(r.Context(), err, w)
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				middleware.ErrorEncoder(r.Context(), middleware.ErrUnauthenticated, w)
+				return
+			}
+			if rule.Permission != "" && !claims.HasPermission(rule.Permission) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				middleware.ErrorEncoder(r.Context(), middleware.ErrForbidden, w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), kitjwt.JWTContextKey, token)
+			ctx = context.WithValue(ctx, kitjwt.JWTClaimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
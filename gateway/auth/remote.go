@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+type verdict struct {
+	claims  *model.CustomerClaims
+	expires time.Time
+}
+
+// RemoteVerifier validates tokens by asking usersvc, so revoked tokens are
+// rejected too. Verdicts are cached for ttl, and never past the expiry of the
+// token, so a revocation takes at most ttl to reach the gateway.
+type RemoteVerifier struct {
+	claims  middleware.ClaimsParser
+	ttl     time.Duration
+	maxSize int
+
+	mu       sync.Mutex
+	verdicts map[[sha256.Size]byte]verdict
+}
+
+func NewRemoteVerifier(claims middleware.ClaimsParser, ttl time.Duration, maxSize int) *RemoteVerifier {
+	return &RemoteVerifier{
+		claims:   claims,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		verdicts: make(map[[sha256.Size]byte]verdict),
+	}
+}
+
+func (v *RemoteVerifier) Verify(ctx context.Context, token string) (*model.CustomerClaims, error) {
+	// tokens are only kept hashed, a memory dump does not leak them
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	v.mu.Lock()
+	cached, ok := v.verdicts[key]
+	v.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		if cached.claims == nil {
+			return nil, ErrInvalidToken
+		}
+		return cached.claims, nil
+	}
+
+	claims, err := v.claims(ctx, token)
+	switch {
+	case err == nil:
+		expires := now.Add(v.ttl)
+		if exp := time.Unix(claims.ExpiresAt, 0); claims.ExpiresAt != 0 && exp.Before(expires) {
+			expires = exp
+		}
+		v.store(key, verdict{claims: claims, expires: expires}, now)
+		return claims, nil
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrTokenRevoked):
+		v.store(key, verdict{expires: now.Add(v.ttl)}, now)
+		return nil, ErrInvalidToken
+	}
+	// usersvc could not answer, which says nothing of the token
+	return nil, ErrUnavailable
+}
+
+func (v *RemoteVerifier) store(key [sha256.Size]byte, result verdict, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.verdicts) >= v.maxSize {
+		for k, cached := range v.verdicts {
+			if !now.Before(cached.expires) {
+				delete(v.verdicts, k)
+			}
+		}
+		// still full of live verdicts, start over rather than grow unbounded
+		if len(v.verdicts) >= v.maxSize {
+			v.verdicts = make(map[[sha256.Size]byte]verdict)
+		}
+	}
+	v.verdicts[key] = result
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens which are malformed, expired,
+	// not signed by usersvc, revoked or of another type than access tokens.
+	// It is the error of usersvc, the clients see the same code either way.
+	ErrInvalidToken = services.ErrInvalidToken
+	// ErrUnavailable is returned when a token cannot be checked, because
+	// usersvc cannot be reached.
+	ErrUnavailable = pkg.NewRetryableError(pkg.KindUnavailable, "token_validation_unavailable", "token validation unavailable")
+	ErrUnknownMode = pkg.NewError(pkg.KindInvalidArgument, "unknown_auth_mode", "unknown gateway auth mode")
+)
+
+// Verifier validates access tokens and returns their claims.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*model.CustomerClaims, error)
+}
+
+// NewVerifierFromConfig returns the Verifier selected by GATEWAY_AUTH_MODE,
+// backed by users.
+func NewVerifierFromConfig(users services.IAuthService, logger log.Logger) (Verifier, error) {
+	c := config.GetGatewayAuthConfig()
+	switch c.Mode {
+	case "local":
+		return NewJWKSVerifier(users.JWKS, c.JWKSRefresh, logger), nil
+	case "remote":
+		return NewRemoteVerifier(users.Claims, c.VerdictTTL, c.VerdictCacheSize), nil
+	}
+	return nil, ErrUnknownMode
+}
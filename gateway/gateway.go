@@ -2,57 +2,139 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/gorilla/mux"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
 
 	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/gateway/auth"
+	"github.com/pascallin/go-kit-application/gateway/route"
 	"github.com/pascallin/go-kit-application/gateway/svc"
+	"github.com/pascallin/go-kit-application/middleware"
 	"github.com/pascallin/go-kit-application/pkg"
 )
 
+var dryRun = flag.Bool("dry-run", false, "validate and print the resolved route table, then exit")
+
 func main() {
+	// startup aborts on an invalid configuration, the route table is
+	// -gateway.routes
+	err := config.Load("gateway", config.NewGatewayTree(), flag.CommandLine, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 	logger := pkg.GetLogger()
+
+	table, err := loadRoutes(config.GetGatewayConfig().Routes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		if err := table.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(ctx); err != nil {
+	// run blocks until the interrupt signal, or a server failure
+	if err := run(ctx, table); err != nil {
 		log.Fatal(err)
 	}
 
-	// Listen for the interrupt signal.
-	<-ctx.Done()
-
 	logger.Log("gateway", "exiting")
 }
 
-func run(ctx context.Context) error {
+// loadRoutes loads the route table and validates it, the gateway does not
+// start with a broken one.
+func loadRoutes(path string) (route.Table, error) {
+	table, err := route.Load(path)
+	if err != nil {
+		return route.Table{}, err
+	}
+	if err := table.Validate(svc.Upstreams()); err != nil {
+		return route.Table{}, err
+	}
+	return table, nil
+}
+
+func run(ctx context.Context, table route.Table) error {
+	cfg := config.GetGatewayConfig()
 	logger := pkg.GetLogger()
+	lifecycle := pkg.NewLifecycle(logger)
+	// undoes what was started if run fails before the servers run
+	defer lifecycle.Abort()
+	lifecycle.Close("tracer", pkg.CloseTracers)
+	// limits, breakers, timeouts and the log level follow the runtime
+	// configuration from now on
+	stopRuntime, err := pkg.WatchRuntimeConfig(logger)
+	if err != nil {
+		return err
+	}
+	lifecycle.Close("runtime config", stopRuntime)
+
 	r := mux.NewRouter()
 
-	tracer := stdopentracing.GlobalTracer() // no-op
-	zipkinTracer, _ := stdzipkin.NewTracer(nil, stdzipkin.WithNoopTracer(true))
-	discoveryClient, err := pkg.NewKitDiscoverClient()
+	// the gateway starts the traces of the requests it routes
+	tracer, err := pkg.InitTracer(config.ServiceConfig{Name: "gateway"})
+	if err != nil {
+		return err
+	}
+	registry, err := pkg.NewRegistry(logger)
 	if err != nil {
 		return err
 	}
 
-	svc.RegisterAddsvc(ctx, r, tracer, zipkinTracer, discoveryClient.Client)
+	if err := svc.Register(r, table, registry, tracer, logger); err != nil {
+		return err
+	}
 
-	httpAddr := fmt.Sprintf(":%d", config.GetGatewayConfig().HttpPort)
-	// HTTP transport.
-	go func() {
-		logger.Log("transport", "HTTP", "addr", httpAddr)
-		if err := http.ListenAndServe(httpAddr, r); err != nil {
-			logger.Log(err.Error())
-		}
-	}()
+	// the gateway needs usersvc to check tokens, whether it routes to it or not
+	retry := route.Retry{Max: cfg.RetryMax, Timeout: route.Duration(cfg.RetryTimeout)}
+	instancer, err := registry.Instancer("usersvc")
+	if err != nil {
+		return err
+	}
+	balance := svc.NewBalancer(instancer, retry.Timeout, retry, logger)
+	users := svc.NewUsersvcClient(balance, tracer, logger)
 
-	return nil
+	verifier, err := auth.NewVerifierFromConfig(users.AuthService, logger)
+	if err != nil {
+		return err
+	}
+	r.Use(auth.Middleware(verifier, table.Rules(), logger))
+
+	// open breakers only degrade the gateway, the other upstreams still serve
+	health := pkg.NewHealth(logger)
+	health.Add(pkg.HealthCheck{Name: "breakers", Check: pkg.BreakersCheck})
+	// the health endpoints are served out of the router, unauthenticated
+	handler := http.NewServeMux()
+	handler.Handle("/livez", health.Handler())
+	handler.Handle("/readyz", health.Handler())
+	// the client address is resolved once, here, what the client sent as
+	// X-Forwarded-For is trusted from the load balancers in front only
+	proxies, err := config.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	handler.Handle("/", middleware.RequestID(middleware.TrustedProxies(proxies).ForwardedFor(r)))
+
+	lifecycle.OnShutdown(health.Shutdown)
+	if err := lifecycle.HTTP("HTTP", fmt.Sprintf(":%d", cfg.HttpPort), handler); err != nil {
+		return err
+	}
+	health.Start()
+	return lifecycle.Run(ctx)
 }
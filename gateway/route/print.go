@@ -0,0 +1,41 @@
+package route
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Print writes the resolved route table, defaults filled in, one route per
+// line followed by its access rules.
+func (t Table) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tSERVICE\tPROTOCOL\tTIMEOUT\tRETRY\tRATE LIMIT\tAUTH")
+	for _, route := range t.Routes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d in %s\t%s\t%s\n",
+			route.Prefix, route.Service, route.Protocol, route.Timeout,
+			route.Retry.Max, route.Retry.Timeout, rateLimit(route.RateLimit),
+			access(route.Auth.Public, route.Auth.Permission))
+		for _, path := range route.Auth.Paths {
+			fmt.Fprintf(tw, "  %s\t\t\t\t\t\t%s\n", path.Prefix, access(path.Public, path.Permission))
+		}
+	}
+	return tw.Flush()
+}
+
+func rateLimit(limit RateLimit) string {
+	if limit.RPS <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s burst %d", limit.RPS, limit.Burst)
+}
+
+func access(public bool, permission string) string {
+	switch {
+	case public:
+		return "public"
+	case permission != "":
+		return "token with " + permission
+	}
+	return "token"
+}
@@ -0,0 +1,170 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pascallin/go-kit-application/gateway/auth"
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+const (
+	ProtocolGRPC = pkg.ProtocolGRPC
+	ProtocolHTTP = pkg.ProtocolHTTP
+)
+
+// Defaults of the optional route settings.
+const (
+	DefaultProtocol     = ProtocolGRPC
+	DefaultTimeout      = 5 * time.Second
+	DefaultRetryMax     = 3
+	DefaultRetryTimeout = 10 * time.Second
+)
+
+// Duration is a time.Duration written as a string such as "500ms", in YAML as
+// in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+type Retry struct {
+	// Max is how many instances are tried at most
+	Max int `json:"max" yaml:"max"`
+	// Timeout bounds the time of all the tries together
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+type RateLimit struct {
+	// RPS is the requests per second allowed on the route, zero is unlimited
+	RPS   float64 `json:"rps" yaml:"rps"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// Auth is the access policy of a route, Paths override it for the requests
+// under their own prefix.
+type Auth struct {
+	Public     bool       `json:"public" yaml:"public"`
+	Permission string     `json:"permission" yaml:"permission"`
+	Paths      []PathAuth `json:"paths" yaml:"paths"`
+}
+
+type PathAuth struct {
+	Prefix     string `json:"prefix" yaml:"prefix"`
+	Public     bool   `json:"public" yaml:"public"`
+	Permission string `json:"permission" yaml:"permission"`
+}
+
+// Route exposes an upstream service, as found in Consul, under a path prefix
+// of the gateway.
+type Route struct {
+	Prefix  string `json:"prefix" yaml:"prefix"`
+	Service string `json:"service" yaml:"service"`
+	// Protocol is the transport from the gateway to the service
+	Protocol string `json:"protocol" yaml:"protocol"`
+	// Timeout bounds each call to an instance
+	Timeout   Duration  `json:"timeout" yaml:"timeout"`
+	Retry     Retry     `json:"retry" yaml:"retry"`
+	Auth      Auth      `json:"auth" yaml:"auth"`
+	RateLimit RateLimit `json:"rate_limit" yaml:"rate_limit"`
+}
+
+type Table struct {
+	Routes []Route `json:"routes" yaml:"routes"`
+}
+
+// Load reads the route table from a YAML or JSON file, chosen by extension,
+// and fills in the defaults.
+func Load(path string) (Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Table{}, err
+	}
+	table, err := Parse(data, filepath.Ext(path))
+	if err != nil {
+		return Table{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// Parse decodes a route table in the format of the file extension ext, and
+// fills in the defaults. Unknown fields are errors, a typo must not silently
+// drop a setting.
+func Parse(data []byte, ext string) (Table, error) {
+	table := Table{}
+	switch strings.ToLower(ext) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&table); err != nil {
+			return Table{}, err
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&table); err != nil {
+			return Table{}, err
+		}
+	default:
+		return Table{}, fmt.Errorf("unsupported route table format %q", ext)
+	}
+	table.setDefaults()
+	return table, nil
+}
+
+func (t *Table) setDefaults() {
+	for i := range t.Routes {
+		route := &t.Routes[i]
+		if route.Protocol == "" {
+			route.Protocol = DefaultProtocol
+		}
+		if route.Timeout == 0 {
+			route.Timeout = Duration(DefaultTimeout)
+		}
+		if route.Retry.Max == 0 {
+			route.Retry.Max = DefaultRetryMax
+		}
+		if route.Retry.Timeout == 0 {
+			route.Retry.Timeout = Duration(DefaultRetryTimeout)
+		}
+		if route.RateLimit.RPS > 0 && route.RateLimit.Burst == 0 {
+			route.RateLimit.Burst = int(route.RateLimit.RPS)
+			if route.RateLimit.Burst < 1 {
+				route.RateLimit.Burst = 1
+			}
+		}
+	}
+}
+
+// Rules are the access policies of all the routes, for auth.Middleware.
+func (t Table) Rules() auth.Rules {
+	rules := auth.Rules{}
+	for _, route := range t.Routes {
+		rules = append(rules, auth.Rule{Prefix: route.Prefix, Public: route.Auth.Public, Permission: route.Auth.Permission})
+		for _, path := range route.Auth.Paths {
+			rules = append(rules, auth.Rule{Prefix: path.Prefix, Public: path.Public, Permission: path.Permission})
+		}
+	}
+	return rules
+}
@@ -0,0 +1,173 @@
+package route
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascallin/go-kit-application/gateway/auth"
+)
+
+var upstreams = map[string][]string{"addsvc": {ProtocolGRPC, ProtocolHTTP}, "usersvc": {ProtocolGRPC}}
+
+const yamlTable = `
+routes:
+  - prefix: /addsvc
+    service: addsvc
+    protocol: http
+    timeout: 1s
+    retry: {max: 2, timeout: 3s}
+    auth:
+      permission: addsvc:use
+      paths:
+        - {prefix: /addsvc/health, public: true}
+    rate_limit: {rps: 10}
+  - prefix: /usersvc
+    service: usersvc
+    auth: {public: true}
+`
+
+const jsonTable = `{"routes": [
+  {"prefix": "/addsvc", "service": "addsvc", "protocol": "http", "timeout": "1s",
+   "retry": {"max": 2, "timeout": "3s"},
+   "auth": {"permission": "addsvc:use", "paths": [{"prefix": "/addsvc/health", "public": true}]},
+   "rate_limit": {"rps": 10}},
+  {"prefix": "/usersvc", "service": "usersvc", "auth": {"public": true}}
+]}`
+
+func TestParse(t *testing.T) {
+	want := Table{Routes: []Route{
+		{
+			Prefix: "/addsvc", Service: "addsvc", Protocol: ProtocolHTTP,
+			Timeout:   Duration(time.Second),
+			Retry:     Retry{Max: 2, Timeout: Duration(3 * time.Second)},
+			Auth:      Auth{Permission: "addsvc:use", Paths: []PathAuth{{Prefix: "/addsvc/health", Public: true}}},
+			RateLimit: RateLimit{RPS: 10, Burst: 10},
+		},
+		{
+			Prefix: "/usersvc", Service: "usersvc", Protocol: DefaultProtocol,
+			Timeout: Duration(DefaultTimeout),
+			Retry:   Retry{Max: DefaultRetryMax, Timeout: Duration(DefaultRetryTimeout)},
+			Auth:    Auth{Public: true},
+		},
+	}}
+	for _, tc := range []struct {
+		ext  string
+		data string
+	}{
+		{".yaml", yamlTable},
+		{".json", jsonTable},
+	} {
+		t.Run(tc.ext, func(t *testing.T) {
+			table, err := Parse([]byte(tc.data), tc.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table, want) {
+				t.Fatalf("expected %+v, got %+v", want, table)
+			}
+			if err := table.Validate(upstreams); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ext  string
+		data string
+	}{
+		{"unknown field", ".yaml", "routes:\n  - prefix: /addsvc\n    servce: addsvc\n"},
+		{"unknown json field", ".json", `{"routes": [{"prefix": "/addsvc", "retries": 3}]}`},
+		{"bad duration", ".yaml", "routes:\n  - prefix: /addsvc\n    timeout: soon\n"},
+		{"unknown format", ".toml", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.data), tc.ext); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	table := Table{Routes: []Route{
+		{Prefix: "addsvc/", Service: "addsvc", Protocol: ProtocolGRPC},
+		{Prefix: "/users", Service: "usersvc", Protocol: ProtocolHTTP},
+		{Prefix: "/users", Service: "billing", Protocol: ProtocolGRPC},
+		{Prefix: "/other", Protocol: ProtocolGRPC, Timeout: -1, RateLimit: RateLimit{RPS: -1}},
+		{Prefix: "/public", Service: "usersvc", Protocol: ProtocolGRPC, Auth: Auth{
+			Public: true, Permission: "user:read",
+			Paths: []PathAuth{{Prefix: "/publicity"}, {Prefix: "/public/admin", Public: true, Permission: "user:admin"}},
+		}},
+	}}
+	err := table.Validate(upstreams)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	for _, problem := range []string{
+		"routes[0] addsvc/: prefix must start with /",
+		`routes[1] /users: service usersvc cannot be called over "http", only grpc`,
+		"routes[2] /users: prefix already used by routes[1]",
+		`routes[2] /users: unknown service "billing"`,
+		"routes[3] /other: service is required",
+		"routes[3] /other: timeout must not be negative",
+		"routes[3] /other: rate limit must not be negative",
+		"routes[4] /public: a public route cannot require a permission",
+		"routes[4] /public: auth path /publicity is not under the route prefix",
+		"routes[4] /public: public auth path /public/admin cannot require a permission",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %q in\n%s", problem, err)
+		}
+	}
+	if len(verr.Problems) != 10 {
+		t.Errorf("expected 10 problems, got %d", len(verr.Problems))
+	}
+
+	if err := (Table{}).Validate(upstreams); err == nil {
+		t.Error("expected an empty table to be invalid")
+	}
+}
+
+func TestRules(t *testing.T) {
+	table, err := Parse([]byte(yamlTable), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := auth.Rules{
+		{Prefix: "/addsvc", Permission: "addsvc:use"},
+		{Prefix: "/addsvc/health", Public: true},
+		{Prefix: "/usersvc", Public: true},
+	}
+	if rules := table.Rules(); !reflect.DeepEqual(rules, want) {
+		t.Fatalf("expected %+v, got %+v", want, rules)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	table, err := Parse([]byte(yamlTable), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := table.Print(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	for i, want := range []string{
+		"PREFIX SERVICE PROTOCOL TIMEOUT RETRY RATE LIMIT AUTH",
+		"/addsvc addsvc http 1s 2 in 3s 10/s burst 10 token with addsvc:use",
+		"/addsvc/health public",
+		"/usersvc usersvc grpc 5s 3 in 10s unlimited public",
+	} {
+		if got := strings.Join(strings.Fields(lines[i]), " "); got != want {
+			t.Errorf("line %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists everything wrong with a route table, so all of it
+// can be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid route table:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the routes against the protocols each known upstream
+// service can be called with.
+func (t Table) Validate(upstreams map[string][]string) error {
+	errs := &ValidationError{}
+	if len(t.Routes) == 0 {
+		errs.add("no routes")
+	}
+	prefixes := map[string]int{}
+	for i, route := range t.Routes {
+		name := fmt.Sprintf("routes[%d] %s", i, route.Prefix)
+		if !strings.HasPrefix(route.Prefix, "/") || (len(route.Prefix) > 1 && strings.HasSuffix(route.Prefix, "/")) {
+			errs.add("%s: prefix must start with / and not end with one", name)
+		}
+		if j, ok := prefixes[route.Prefix]; ok {
+			errs.add("%s: prefix already used by routes[%d]", name, j)
+		}
+		prefixes[route.Prefix] = i
+
+		if route.Service == "" {
+			errs.add("%s: service is required", name)
+		} else if protocols, ok := upstreams[route.Service]; !ok {
+			errs.add("%s: unknown service %q", name, route.Service)
+		} else if !contains(protocols, route.Protocol) {
+			errs.add("%s: service %s cannot be called over %q, only %s", name, route.Service, route.Protocol, strings.Join(protocols, ", "))
+		}
+
+		if route.Timeout < 0 {
+			errs.add("%s: timeout must not be negative", name)
+		}
+		if route.Retry.Max < 0 || route.Retry.Timeout < 0 {
+			errs.add("%s: retry max and timeout must not be negative", name)
+		}
+		if route.RateLimit.RPS < 0 || route.RateLimit.Burst < 0 {
+			errs.add("%s: rate limit must not be negative", name)
+		}
+
+		if route.Auth.Public && route.Auth.Permission != "" {
+			errs.add("%s: a public route cannot require a permission", name)
+		}
+		for _, path := range route.Auth.Paths {
+			if path.Prefix == route.Prefix || !strings.HasPrefix(path.Prefix, route.Prefix+"/") {
+				errs.add("%s: auth path %s is not under the route prefix", name, path.Prefix)
+			}
+			if path.Public && path.Permission != "" {
+				errs.add("%s: public auth path %s cannot require a permission", name, path.Prefix)
+			}
+		}
+	}
+	if len(errs.Problems) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,60 +1,45 @@
 package svc
 
 import (
-	"context"
 	"io"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/sd"
-	consulsd "github.com/go-kit/kit/sd/consul"
-	"github.com/go-kit/kit/sd/lb"
-	"github.com/gorilla/mux"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 
 	svcendpoints "github.com/pascallin/go-kit-application/addsvc/endpoints"
 	"github.com/pascallin/go-kit-application/addsvc/services"
 	"github.com/pascallin/go-kit-application/addsvc/transports"
-	"github.com/pascallin/go-kit-application/config"
-	"github.com/pascallin/go-kit-application/pkg"
 )
 
-func RegisterAddsvc(ctx context.Context, r *mux.Router, tracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, client consulsd.Client) {
-	config := config.GetGatewayConfig()
-	logger := pkg.GetLogger()
-
-	var (
-		tags        = []string{}
-		passingOnly = true
-		endpoints   = svcendpoints.Set{}
-		instancer   = consulsd.NewInstancer(client, logger, "addsvc", tags, passingOnly)
-	)
-	{
-		factory := addsvcFactory(svcendpoints.MakeSumEndpoint, tracer, zipkinTracer, logger)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(config.RetryMax, config.RetryTimeout, balancer)
-		endpoints.SumEndpoint = retry
-	}
-	{
-		factory := addsvcFactory(svcendpoints.MakeConcatEndpoint, tracer, zipkinTracer, logger)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(config.RetryMax, config.RetryTimeout, balancer)
-		endpoints.ConcatEndpoint = retry
+func addsvcGRPC(balance Balancer, tracer trace.Tracer, logger log.Logger) http.Handler {
+	endpoints := svcendpoints.Set{
+		SumEndpoint:    balance(addsvcFactory(svcendpoints.MakeSumEndpoint, tracer, logger)),
+		ConcatEndpoint: balance(addsvcFactory(svcendpoints.MakeConcatEndpoint, tracer, logger)),
+		// served as the public /health of the route
+		HealthCheckEndpoint: balance(addsvcFactory(svcendpoints.MakeHealthCheckEndpoint, tracer, logger)),
 	}
 
 	// Here we leverage the fact that addsvc comes with a constructor for an
-	// HTTP handler, and just install it under a particular path prefix in
-	// our router.
+	// HTTP handler, and just serve it under the route prefix.
+	return transports.NewHTTPHandler(endpoints, tracer, logger)
+}
 
-	r.PathPrefix("/addsvc").Handler(http.StripPrefix("/addsvc", transports.NewHTTPHandler(endpoints, tracer, zipkinTracer, logger)))
+// addsvcHTTP is addsvcGRPC calling the instances over HTTP, those addsvc
+// registers as addsvc-http.
+func addsvcHTTP(balance Balancer, tracer trace.Tracer, logger log.Logger) http.Handler {
+	endpoints := svcendpoints.Set{
+		SumEndpoint:         balance(addsvcHTTPFactory(svcendpoints.MakeSumEndpoint, tracer, logger)),
+		ConcatEndpoint:      balance(addsvcHTTPFactory(svcendpoints.MakeConcatEndpoint, tracer, logger)),
+		HealthCheckEndpoint: balance(addsvcHTTPFactory(svcendpoints.MakeHealthCheckEndpoint, tracer, logger)),
+	}
+	return transports.NewHTTPHandler(endpoints, tracer, logger)
 }
 
-func addsvcFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, logger log.Logger) sd.Factory {
+func addsvcFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer trace.Tracer, logger log.Logger) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
 		// We could just as easily use the HTTP or Thrift client package to make
 		// the connection to addsvc. We've chosen gRPC arbitrarily. Note that
@@ -65,7 +50,7 @@ func addsvcFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer
 		if err != nil {
 			return nil, nil, err
 		}
-		service := transports.NewGRPCClient(conn, tracer, zipkinTracer, logger)
+		service := transports.NewGRPCClient(conn, tracer, logger)
 		endpoint := makeEndpoint(service)
 
 		// Notice that the addsvc gRPC client converts the connection to a
@@ -78,3 +63,14 @@ func addsvcFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer
 		return endpoint, conn, nil
 	}
 }
+
+func addsvcHTTPFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer trace.Tracer, logger log.Logger) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		service, err := transports.NewHTTPClient(instance, tracer, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the HTTP client keeps no connection of its own to close
+		return makeEndpoint(service), nil, nil
+	}
+}
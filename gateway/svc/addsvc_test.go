@@ -0,0 +1,137 @@
+package svc
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	svcendpoints "github.com/pascallin/go-kit-application/addsvc/endpoints"
+	"github.com/pascallin/go-kit-application/addsvc/services"
+	"github.com/pascallin/go-kit-application/addsvc/transports"
+	"github.com/pascallin/go-kit-application/gateway/route"
+	pb "github.com/pascallin/go-kit-application/pb/addsvc"
+)
+
+// serveAddsvc runs an addsvc instance over gRPC and one over HTTP, and returns
+// their addresses.
+func serveAddsvc(t *testing.T) (grpcInstance, httpInstance string) {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	svc := services.NewBasicService()
+	endpoints := svcendpoints.Set{
+		SumEndpoint:         svcendpoints.MakeSumEndpoint(svc),
+		ConcatEndpoint:      svcendpoints.MakeConcatEndpoint(svc),
+		HealthCheckEndpoint: svcendpoints.MakeHealthCheckEndpoint(svc),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterAddServer(server, transports.NewGRPCServer(endpoints, tracer, logger))
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.Add_ServiceDesc.ServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	httpServer := httptest.NewServer(transports.NewHTTPHandler(endpoints, tracer, logger))
+	t.Cleanup(httpServer.Close)
+	return listener.Addr().String(), httpServer.Listener.Addr().String()
+}
+
+// TestAddsvcHealth calls the public health path of the addsvc route over both
+// protocols, through a real addsvc instance.
+func TestAddsvcHealth(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	grpcInstance, httpInstance := serveAddsvc(t)
+
+	for _, tt := range []struct {
+		name     string
+		upstream Upstream
+		instance string
+	}{
+		{"grpc", addsvcGRPC, grpcInstance},
+		{"http", addsvcHTTP, httpInstance},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			balance := func(factory sd.Factory) endpoint.Endpoint {
+				e, _, err := factory(tt.instance)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return e
+			}
+			handler := http.StripPrefix("/addsvc", tt.upstream(balance, tracer, logger))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/addsvc/health", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != `{"status":true}` {
+				t.Fatalf("unexpected body %s", body)
+			}
+		})
+	}
+}
+
+// TestAddsvcFailover calls the addsvc route balanced over a live instance and
+// one down, whose calls are retried on the live one.
+func TestAddsvcFailover(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	grpcInstance, httpInstance := serveAddsvc(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := listener.Addr().String()
+	listener.Close()
+
+	for _, tt := range []struct {
+		name     string
+		upstream Upstream
+		instance string
+	}{
+		{"grpc", addsvcGRPC, grpcInstance},
+		{"http", addsvcHTTP, httpInstance},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			balance := NewBalancer(sd.FixedInstancer{down, tt.instance}, route.Duration(time.Second), route.Retry{Max: 3, Timeout: route.Duration(5 * time.Second)}, logger)
+			handler := http.StripPrefix("/addsvc", tt.upstream(balance, tracer, logger))
+
+			// round robin, one of the calls goes to the instance down first
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/addsvc/sum", strings.NewReader(`{"a":1,"b":2}`)))
+				if w.Code != http.StatusOK {
+					t.Fatalf("call %d: expected %d, got %d: %s", i, http.StatusOK, w.Code, w.Body)
+				}
+				if body := strings.TrimSpace(w.Body.String()); body != `{"v":3}` {
+					t.Fatalf("call %d: unexpected body %s", i, body)
+				}
+			}
+
+			// the errors of the request are returned as they are
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/addsvc/sum", strings.NewReader(`{"a":0,"b":0}`)))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+			}
+		})
+	}
+}
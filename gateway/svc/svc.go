@@ -0,0 +1,144 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+
+	"github.com/pascallin/go-kit-application/gateway/route"
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+// Balancer turns the endpoints a factory makes out of each instance of a
+// service into a single endpoint, balanced and retried over the instances.
+type Balancer func(factory sd.Factory) endpoint.Endpoint
+
+// Upstream builds the HTTP handler serving a service behind the gateway,
+// calling the service through balanced endpoints.
+type Upstream func(balance Balancer, tracer trace.Tracer, logger log.Logger) http.Handler
+
+// upstreams are the services the gateway knows how to call, by Consul name,
+// then by protocol.
+var upstreams = map[string]map[string]Upstream{
+	"addsvc":  {route.ProtocolGRPC: addsvcGRPC, route.ProtocolHTTP: addsvcHTTP},
+	"usersvc": {route.ProtocolGRPC: usersvcGRPC},
+}
+
+// Upstreams lists the protocols each known service can be called with, for
+// route.Table.Validate.
+func Upstreams() map[string][]string {
+	known := make(map[string][]string, len(upstreams))
+	for service, protocols := range upstreams {
+		for protocol := range protocols {
+			known[service] = append(known[service], protocol)
+		}
+		sort.Strings(known[service])
+	}
+	return known
+}
+
+// Register mounts each route of a validated table on the router, balanced
+// over the instances the registry knows of, those serving the protocol of the
+// route.
+func Register(r *mux.Router, table route.Table, registry pkg.Registry, tracer trace.Tracer, logger log.Logger) error {
+	for _, rt := range table.Routes {
+		instancer, err := registry.Instancer(pkg.RegisteredName(rt.Service, rt.Protocol))
+		if err != nil {
+			return err
+		}
+		balance := NewBalancer(instancer, rt.Timeout, rt.Retry, logger)
+		handler := upstreams[rt.Service][rt.Protocol](balance, tracer, logger)
+		handler = rateLimited(rt.RateLimit, http.StripPrefix(rt.Prefix, handler))
+		r.PathPrefix(rt.Prefix).Handler(handler)
+		logger.Log("route", rt.Prefix, "service", rt.Service, "protocol", rt.Protocol)
+	}
+	return nil
+}
+
+// NewBalancer balances over the instances of a service, each call bounded by
+// timeout. Calls failing because of the instance, see instanceFailed, are
+// retried on the next ones as retry allows.
+func NewBalancer(instancer sd.Instancer, timeout route.Duration, retry route.Retry, logger log.Logger) Balancer {
+	return func(factory sd.Factory) endpoint.Endpoint {
+		endpointer := sd.NewEndpointer(instancer, failover(withTimeout(factory, time.Duration(timeout))), logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retrying := lb.RetryWithCallback(time.Duration(retry.Timeout), balancer, func(n int, err error) (bool, error) {
+			return n < retry.Max && instanceFailed(err), nil
+		})
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := retrying(ctx, request)
+			// the last error is returned as it is, to keep its kind
+			var retryErr lb.RetryError
+			if errors.As(err, &retryErr) {
+				err = retryErr.Final
+			}
+			return response, err
+		}
+	}
+}
+
+// instanceFailed tells the errors of an instance down or overloaded, the
+// retryable server errors, from those of the request.
+func instanceFailed(err error) bool {
+	return pkg.IsRetryable(err) && pkg.IsServerError(err)
+}
+
+// failover returns the errors of the instance as the error of the endpoints
+// factory makes, so that lb.Retry sees them. The endpoints of the services
+// return every error in their response, the errors of the request stay there.
+func failover(factory sd.Factory) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		next, closer, err := factory(instance)
+		if err != nil {
+			return next, closer, err
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if f, ok := response.(endpoint.Failer); ok && err == nil && instanceFailed(f.Failed()) {
+				return nil, f.Failed()
+			}
+			return response, err
+		}, closer, nil
+	}
+}
+
+func withTimeout(factory sd.Factory, timeout time.Duration) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		next, closer, err := factory(instance)
+		if err != nil || timeout <= 0 {
+			return next, closer, err
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, request)
+		}, closer, nil
+	}
+}
+
+func rateLimited(limit route.RateLimit, next http.Handler) http.Handler {
+	if limit.RPS <= 0 {
+		return next
+	}
+	limiter := rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.Allow() {
+			middleware.ErrorEncoder(r.Context(), ratelimit.ErrLimited, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
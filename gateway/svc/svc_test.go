@@ -0,0 +1,106 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pascallin/go-kit-application/gateway/route"
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+// TestRoutesFile keeps the shipped route table valid.
+func TestRoutesFile(t *testing.T) {
+	table, err := route.Load("../routes.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Validate(Upstreams()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	handler := rateLimited(route.RateLimit{RPS: 1, Burst: 2}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, code := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != code {
+			t.Fatalf("request %d: expected %d, got %d", i, code, w.Code)
+		}
+	}
+}
+
+// outcome is the response of the endpoints of TestBalancerRetries, failing
+// with err.
+type outcome struct{ err error }
+
+func (o outcome) Failed() error { return o.err }
+
+func TestBalancerRetries(t *testing.T) {
+	down := pkg.ErrorFromGRPC(status.Error(codes.Unavailable, "connection refused"))
+	invalid := pkg.NewError(pkg.KindInvalidArgument, "two_zeroes", "can't sum two zeroes")
+
+	for _, tt := range []struct {
+		name      string
+		instances map[string]error
+		calls     int
+		want      error
+	}{
+		// every call tries the instance down at most once
+		{"one instance down", map[string]error{"down:8080": down, "up:8080": nil}, 2, nil},
+		// the errors of the request are not retried
+		{"request error", map[string]error{"a:8080": invalid, "b:8080": invalid}, 1, invalid},
+		{"all instances down", map[string]error{"a:8080": down, "b:8080": down}, 3, down},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				calls int
+			)
+			factory := func(instance string) (endpoint.Endpoint, io.Closer, error) {
+				return func(context.Context, interface{}) (interface{}, error) {
+					mu.Lock()
+					calls++
+					mu.Unlock()
+					return outcome{tt.instances[instance]}, nil
+				}, nil, nil
+			}
+			var instances sd.FixedInstancer
+			for instance := range tt.instances {
+				instances = append(instances, instance)
+			}
+			balance := NewBalancer(instances, route.Duration(time.Second), route.Retry{Max: 3, Timeout: route.Duration(5 * time.Second)}, log.NewNopLogger())
+			e := balance(factory)
+
+			for i := 0; i < 2; i++ {
+				mu.Lock()
+				calls = 0
+				mu.Unlock()
+				response, err := e(context.Background(), nil)
+				if err == nil {
+					err = response.(outcome).Failed()
+				}
+				if !errors.Is(err, tt.want) && err != tt.want {
+					t.Fatalf("call %d: expected %v, got %v", i, tt.want, err)
+				}
+				mu.Lock()
+				if calls > tt.calls {
+					t.Fatalf("call %d: expected at most %d tries, got %d", i, tt.calls, calls)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package svc
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	svcendpoints "github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+	"github.com/pascallin/go-kit-application/usersvc/transports"
+)
+
+func usersvcGRPC(balance Balancer, tracer trace.Tracer, logger log.Logger) http.Handler {
+	// The usersvc HTTP handler serves the balanced endpoints as it would the
+	// local ones. Their requests are recorded, and their permissions checked,
+	// by the usersvc instances, not here. No proxy is trusted, the client
+	// address is resolved by ForwardedFor in front of the routes.
+	return transports.MakeHandler(usersvcEndpoints(balance, tracer, logger), nil, tracer, logger)
+}
+
+// NewUsersvcClient returns usersvc, each method balanced over the instances
+// and called over gRPC.
+func NewUsersvcClient(balance Balancer, tracer trace.Tracer, logger log.Logger) services.Service {
+	return usersvcEndpoints(balance, tracer, logger).Service()
+}
+
+func usersvcEndpoints(balance Balancer, tracer trace.Tracer, logger log.Logger) svcendpoints.EndpointSet {
+	balanced := func(makeEndpoint func(services.Service) endpoint.Endpoint) endpoint.Endpoint {
+		return balance(usersvcFactory(makeEndpoint, tracer, logger))
+	}
+	return svcendpoints.EndpointSet{
+		RegisterEndpoint:             balanced(svcendpoints.MakeRegisterEndpoint),
+		LoginEndpoint:                balanced(svcendpoints.MakeLoginEndpoint),
+		UpdatePasswordEndpoint:       balanced(svcendpoints.MakeUpdatePasswordEndpoint),
+		ValidTokenEndpoint:           balanced(svcendpoints.MakeValidTokenEndpoint),
+		RefreshEndpoint:              balanced(svcendpoints.MakeRefreshEndpoint),
+		LogoutEndpoint:               balanced(svcendpoints.MakeLogoutEndpoint),
+		GrantRoleEndpoint:            balanced(svcendpoints.MakeGrantRoleEndpoint),
+		RevokeRoleEndpoint:           balanced(svcendpoints.MakeRevokeRoleEndpoint),
+		GetUserEndpoint:              balanced(svcendpoints.MakeGetUserEndpoint),
+		ListUsersEndpoint:            balanced(svcendpoints.MakeListUsersEndpoint),
+		UpdateProfileEndpoint:        balanced(svcendpoints.MakeUpdateProfileEndpoint),
+		DeleteUserEndpoint:           balanced(svcendpoints.MakeDeleteUserEndpoint),
+		UnlockUserEndpoint:           balanced(svcendpoints.MakeUnlockUserEndpoint),
+		EnrollMFAEndpoint:            balanced(svcendpoints.MakeEnrollMFAEndpoint),
+		ConfirmMFAEndpoint:           balanced(svcendpoints.MakeConfirmMFAEndpoint),
+		VerifyMFAEndpoint:            balanced(svcendpoints.MakeVerifyMFAEndpoint),
+		RequestPasswordResetEndpoint: balanced(svcendpoints.MakeRequestPasswordResetEndpoint),
+		ResetPasswordEndpoint:        balanced(svcendpoints.MakeResetPasswordEndpoint),
+		VerifyEmailEndpoint:          balanced(svcendpoints.MakeVerifyEmailEndpoint),
+		ClaimsEndpoint:               balanced(svcendpoints.MakeClaimsEndpoint),
+		JWKSEndpoint:                 balanced(svcendpoints.MakeJWKSEndpoint),
+	}
+}
+
+func usersvcFactory(makeEndpoint func(services.Service) endpoint.Endpoint, tracer trace.Tracer, logger log.Logger) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		conn, err := grpc.Dial(instance, grpc.WithInsecure())
+		if err != nil {
+			return nil, nil, err
+		}
+		service := transports.NewGRPCClient(conn, tracer, logger)
+		// like addsvcFactory, each method gets a connection of its own
+		return makeEndpoint(service), conn, nil
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+var (
+	ErrUnauthenticated = pkg.NewError(pkg.KindUnauthenticated, "unauthenticated", "unauthenticated")
+	ErrForbidden       = pkg.NewError(pkg.KindPermissionDenied, "permission_denied", "permission denied")
+)
+
+// ClaimsParser validates a bearer token and returns its claims.
+type ClaimsParser func(ctx context.Context, token string) (*model.CustomerClaims, error)
+
+// Authenticate returns an endpoint middleware that validates the bearer token
+// put in the context by kitjwt.HTTPToContext or kitjwt.GRPCToContext, and
+// stores its claims in the context under kitjwt.JWTClaimsContextKey.
+func Authenticate(parse ClaimsParser) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			token, ok := ctx.Value(kitjwt.JWTContextKey).(string)
+			if !ok || token == "" {
+				return nil, ErrUnauthenticated
+			}
+			claims, err := parse(ctx, token)
+			if err != nil {
+				return nil, ErrUnauthenticated
+			}
+			ctx = context.WithValue(ctx, kitjwt.JWTClaimsContextKey, claims)
+			recordUser(ctx, claims.Username)
+			return next(ctx, request)
+		}
+	}
+}
+
+// Subject is implemented by the requests acting on a single user, which the
+// user themselves may send without the permission of the endpoint.
+type Subject interface {
+	Subject() string
+}
+
+// RequirePermission returns an endpoint middleware that rejects requests whose
+// claims, stored by Authenticate, lack permission, unless the request is a
+// Subject naming the authenticated user.
+func RequirePermission(permission string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			claims, ok := ClaimsFromContext(ctx)
+			if !ok {
+				return nil, ErrUnauthenticated
+			}
+			if !claims.HasPermission(permission) && !isSubject(request, claims.Username) {
+				return nil, ErrForbidden
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// Authorize maps endpoint names to the permission they require, so the
+// protected endpoints of a service are declared in one place. An empty
+// permission only requires the caller to be authenticated.
+type Authorize map[string]string
+
+// Middleware returns the authentication and permission middlewares for the
+// named endpoint, or a pass-through middleware if the endpoint is public.
+func (a Authorize) Middleware(name string, parse ClaimsParser) endpoint.Middleware {
+	permission, ok := a[name]
+	if !ok {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	if permission == "" {
+		return Authenticate(parse)
+	}
+	return endpoint.Chain(Authenticate(parse), RequirePermission(permission))
+}
+
+func isSubject(request interface{}, username string) bool {
+	subject, ok := request.(Subject)
+	return ok && username != "" && subject.Subject() == username
+}
+
+// ClaimsFromContext returns the claims stored by Authenticate.
+func ClaimsFromContext(ctx context.Context) (*model.CustomerClaims, bool) {
+	claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*model.CustomerClaims)
+	return claims, ok
+}
+
+// ClaimsToGRPC is a kitgrpc.ClientRequestFunc passing the user authenticated
+// at the gateway as x-user, x-user-roles and x-user-permissions metadata.
+// They are informational, services authorize with the bearer token, which
+// kitjwt.ContextToGRPC forwards.
+func ClaimsToGRPC(ctx context.Context, md *metadata.MD) context.Context {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	md.Set("x-user", claims.Username)
+	if len(claims.Roles) > 0 {
+		md.Set("x-user-roles", claims.Roles...)
+	}
+	if len(claims.Permissions) > 0 {
+		md.Set("x-user-permissions", claims.Permissions...)
+	}
+	return ctx
+}
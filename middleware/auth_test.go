@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+func TestAuthorize(t *testing.T) {
+	parse := func(_ context.Context, token string) (*model.CustomerClaims, error) {
+		switch token {
+		case "admin":
+			return &model.CustomerClaims{Username: "root", Permissions: model.EffectivePermissions([]string{model.RoleAdmin}, nil)}, nil
+		case "user":
+			return &model.CustomerClaims{Username: "pascal", Permissions: model.EffectivePermissions([]string{model.RoleUser}, nil)}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	authorize := Authorize{"Admin": model.PermUserAdmin, "Self": "", "Read": model.PermUserRead}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		token    string
+		request  interface{}
+		err      error
+	}{
+		{"public endpoint without token", "Public", "", nil, nil},
+		{"protected endpoint without token", "Admin", "", nil, ErrUnauthenticated},
+		{"protected endpoint with invalid token", "Admin", "garbage", nil, ErrUnauthenticated},
+		{"protected endpoint without permission", "Admin", "user", nil, ErrForbidden},
+		{"protected endpoint with permission", "Admin", "admin", nil, nil},
+		{"authenticated endpoint without token", "Self", "", nil, ErrUnauthenticated},
+		{"authenticated endpoint with token", "Self", "user", nil, nil},
+		{"protected endpoint on own account", "Read", "user", subject("pascal"), nil},
+		{"protected endpoint on another account", "Read", "user", subject("root"), ErrForbidden},
+		{"protected endpoint on another account with permission", "Read", "admin", subject("pascal"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = context.WithValue(ctx, kitjwt.JWTContextKey, tt.token)
+			}
+			_, err := authorize.Middleware(tt.endpoint, parse)(next)(ctx, tt.request)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+type subject string
+
+func (s subject) Subject() string { return string(s) }
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type clientIPKey struct{}
+
+// ContextWithClientIP returns a copy of ctx carrying the address of the
+// client the request originates from.
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client address stored by the transports, or
+// an empty string if it is unknown.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// TrustedProxies are the networks of the proxies, the gateway or a load
+// balancer, whose X-Forwarded-For is trusted. The X-Forwarded-For of the
+// other peers is ignored, anyone could have written it.
+type TrustedProxies []*net.IPNet
+
+// trusts tells whether the peer at host is a trusted proxy. The peers without
+// an IP address, unix sockets and in-process connections, are local ones.
+func (t TrustedProxies) trusts(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host != ""
+	}
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of a request from the peer at
+// remote. The X-Forwarded-For entries are walked from the nearest proxy back,
+// as long as the hop they come from is trusted, so a client cannot pass
+// itself off as another by sending the header.
+func (t TrustedProxies) ClientIP(remote string, forwarded []string) string {
+	client := hostOf(remote)
+	var hops []string
+	for _, header := range forwarded {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0 && t.trusts(client); i-- {
+		client = hostOf(hops[i])
+	}
+	return client
+}
+
+// HTTPClientIPToContext returns a kithttp.RequestFunc storing the client
+// address in the context, see ClientIP. A client address already in the
+// context, resolved by ForwardedFor at the edge, is kept.
+func (t TrustedProxies) HTTPClientIPToContext(ctx context.Context, r *http.Request) context.Context {
+	if ClientIPFromContext(ctx) != "" {
+		return ctx
+	}
+	return ContextWithClientIP(ctx, t.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For")))
+}
+
+// GRPCClientIPToContext is a kitgrpc.ServerRequestFunc storing the client
+// address in the context, from the peer address and the x-forwarded-for
+// metadata set by the gateway, see ClientIP.
+func (t TrustedProxies) GRPCClientIPToContext(ctx context.Context, md metadata.MD) context.Context {
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	return ContextWithClientIP(ctx, t.ClientIP(remote, md.Get("x-forwarded-for")))
+}
+
+// ForwardedFor returns an HTTP middleware for the edge of the system, the
+// gateway, resolving the client address once, see ClientIP. It stores it in
+// the context and replaces the X-Forwarded-For the request came with, so
+// nothing behind sees what the client sent.
+func (t TrustedProxies) ForwardedFor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := t.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+		r.Header.Set("X-Forwarded-For", ip)
+		next.ServeHTTP(w, r.WithContext(ContextWithClientIP(r.Context(), ip)))
+	})
+}
+
+// ClientIPToGRPC is a kitgrpc.ClientRequestFunc forwarding the client address
+// in the context as x-forwarded-for metadata, for the service behind to
+// throttle the actual client rather than the gateway.
+func ClientIPToGRPC(ctx context.Context, md *metadata.MD) context.Context {
+	if ip := ClientIPFromContext(ctx); ip != "" {
+		md.Set("x-forwarded-for", ip)
+	}
+	return ctx
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	proxies := TrustedProxies{private}
+
+	for _, tc := range []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.7:4242", nil, "203.0.113.7"},
+		{"spoofed by an untrusted peer", "203.0.113.7:4242", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through a trusted proxy", "10.0.0.2:4242", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed through a trusted proxy", "10.0.0.2:4242", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"through trusted proxies", "10.0.0.2:4242", []string{"198.51.100.1, 203.0.113.7", "10.0.0.3"}, "203.0.113.7"},
+		{"only trusted hops", "10.0.0.2:4242", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"in-process peer", "bufconn", []string{"203.0.113.7"}, "203.0.113.7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ip := proxies.ClientIP(tc.remote, tc.forwarded); ip != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, ip)
+			}
+		})
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	var forwarded, ip string
+	handler := TrustedProxies(nil).ForwardedFor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, ip = r.Header.Get("X-Forwarded-For"), ClientIPFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/usersvc/user/v1/login", nil)
+	r.RemoteAddr = "203.0.113.7:4242"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if forwarded != "203.0.113.7" || ip != "203.0.113.7" {
+		t.Fatalf("expected the peer address to replace X-Forwarded-For, got %q and %q", forwarded, ip)
+	}
+}
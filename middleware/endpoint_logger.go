@@ -9,12 +9,16 @@ import (
 )
 
 // LoggingMiddleware returns an endpoint middleware that logs the
-// duration of each invocation, and the resulting error, if any.
+// duration of each invocation, and the resulting error, if any, with the
+// request ID, trace ID and user of ContextLogger. The user authenticated by
+// the middlewares it wraps is logged too. Failed invocations are logged at the
+// warn level, or error for the server errors, the others at info.
 func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx = withUserSlot(ctx)
 			defer func(begin time.Time) {
-				logger.Log("transport_error", err, "took", time.Since(begin))
+				leveled(ContextLogger(ctx, logger), err).Log("transport_error", err, "took", time.Since(begin))
 			}(time.Now())
 			return next(ctx, request)
 
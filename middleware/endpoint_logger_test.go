@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+func TestLoggingMiddlewareLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := pkg.LevelFilter(log.NewLogfmtLogger(&buf))
+	call := func(err error) string {
+		buf.Reset()
+		e := LoggingMiddleware(log.With(logger, "method", "Test"))(func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+		e(context.Background(), nil)
+		return buf.String()
+	}
+	t.Cleanup(func() { pkg.SetLogLevel("") })
+
+	tests := []struct {
+		name   string
+		level  string
+		err    error
+		logged string
+	}{
+		{"success at debug", "debug", nil, "level=info"},
+		{"client error at debug", "debug", ErrForbidden, "level=warn"},
+		{"server error at debug", "debug", errors.New("boom"), "level=error"},
+		{"success at warn", "warn", nil, ""},
+		{"client error at warn", "warn", ErrForbidden, "level=warn"},
+		{"client error at error", "error", ErrForbidden, ""},
+		{"server error at error", "error", errors.New("boom"), "level=error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := pkg.SetLogLevel(tt.level); err != nil {
+				t.Fatal(err)
+			}
+			line := call(tt.err)
+			if tt.logged == "" {
+				if line != "" {
+					t.Fatalf("expected the record dropped, got %q", line)
+				}
+				return
+			}
+			if !strings.HasPrefix(line, tt.logged+" method=Test") {
+				t.Fatalf("expected a %s record, got %q", tt.logged, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+// The outcomes of the requests, the errors being told apart by whose fault
+// they are, see pkg.IsServerError.
+const (
+	OutcomeSuccess     = "success"
+	OutcomeClientError = "client_error"
+	OutcomeServerError = "server_error"
+)
+
+// EndpointMetrics are the RED metrics of the endpoints: the requests and the
+// duration labelled by method, transport and outcome, and the errors by
+// method, transport and code.
+type EndpointMetrics struct {
+	Requests metrics.Counter
+	Errors   metrics.Counter
+	Duration metrics.Histogram
+}
+
+// NewEndpointMetrics registers the endpoint metrics of the service named
+// subsystem, the duration histogram having the given buckets.
+func NewEndpointMetrics(subsystem string, buckets []float64) EndpointMetrics {
+	return EndpointMetrics{
+		Requests: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: subsystem,
+			Name:      "requests_total",
+			Help:      "Total count of requests.",
+		}, []string{"method", "transport", "outcome"}),
+		Errors: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: subsystem,
+			Name:      "request_errors_total",
+			Help:      "Total count of failed requests, by error code.",
+		}, []string{"method", "transport", "code"}),
+		Duration: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "example",
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Request duration in seconds.",
+			Buckets:   buckets,
+		}, []string{"method", "transport", "outcome"}),
+	}
+}
+
+// NopEndpointMetrics returns endpoint metrics recording nothing, for the
+// handlers whose requests are recorded elsewhere.
+func NopEndpointMetrics() EndpointMetrics {
+	return EndpointMetrics{
+		Requests: discard.NewCounter(),
+		Errors:   discard.NewCounter(),
+		Duration: discard.NewHistogram(),
+	}
+}
+
+// With returns the metrics with the label values added to all of them, the
+// transport ones for instance.
+func (m EndpointMetrics) With(labelValues ...string) EndpointMetrics {
+	return EndpointMetrics{
+		Requests: m.Requests.With(labelValues...),
+		Errors:   m.Errors.With(labelValues...),
+		Duration: m.Duration.With(labelValues...),
+	}
+}
+
+// Outcome returns the outcome of a request failed with err, if any.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case pkg.IsServerError(err):
+		return OutcomeServerError
+	}
+	return OutcomeClientError
+}
+
+// InstrumentingMiddleware returns an endpoint middleware that records the
+// requests to method in m, labelled by transport already. The errors are
+// those of the endpoint and those of the responses implementing
+// endpoint.Failer, counted by their pkg.Error code.
+func InstrumentingMiddleware(m EndpointMetrics, method string) endpoint.Middleware {
+	m = m.With("method", method)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				failure := err
+				if f, ok := response.(endpoint.Failer); ok && failure == nil {
+					failure = f.Failed()
+				}
+				outcome := Outcome(failure)
+				m.Requests.With("outcome", outcome).Add(1)
+				m.Duration.With("outcome", outcome).Observe(time.Since(begin).Seconds())
+				if failure != nil {
+					m.Errors.With("code", pkg.ErrorOf(failure).Code).Add(1)
+				}
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+type failedResponse struct{ err error }
+
+func (r failedResponse) Failed() error { return r.err }
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	labels := []string{"method", "transport", "outcome"}
+	requests := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "requests_total"}, labels)
+	errs := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "request_errors_total"}, []string{"method", "transport", "code"})
+	duration := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{Name: "request_duration_seconds"}, labels)
+	m := EndpointMetrics{
+		Requests: prometheus.NewCounter(requests),
+		Errors:   prometheus.NewCounter(errs),
+		Duration: prometheus.NewHistogram(duration),
+	}.With("transport", "grpc")
+
+	invalid := pkg.NewError(pkg.KindInvalidArgument, "two_zeroes", "can't sum two zeroes")
+	for _, tc := range []struct {
+		response interface{}
+		err      error
+	}{
+		{failedResponse{}, nil},
+		{failedResponse{}, nil},
+		{failedResponse{err: invalid}, nil},
+		{nil, invalid},
+		{nil, errors.New("boom")},
+	} {
+		e := InstrumentingMiddleware(m, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+			return tc.response, tc.err
+		})
+		e(context.Background(), nil)
+	}
+
+	for _, tc := range []struct {
+		collector stdprometheus.Collector
+		want      float64
+	}{
+		{requests.WithLabelValues("Sum", "grpc", OutcomeSuccess), 2},
+		{requests.WithLabelValues("Sum", "grpc", OutcomeClientError), 2},
+		{requests.WithLabelValues("Sum", "grpc", OutcomeServerError), 1},
+		{errs.WithLabelValues("Sum", "grpc", "two_zeroes"), 2},
+		{errs.WithLabelValues("Sum", "grpc", "internal"), 1},
+	} {
+		if got := testutil.ToFloat64(tc.collector); got != tc.want {
+			t.Errorf("expected %v, got %v", tc.want, got)
+		}
+	}
+	if n := testutil.CollectAndCount(duration); n != 3 {
+		t.Errorf("expected a histogram per outcome, got %d", n)
+	}
+}
@@ -4,17 +4,116 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
+
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
-type ErrorWrapper struct {
-	Error string `json:"error"`
+// ProblemContentType is the content type of the error responses.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code of an error to make the type of its
+// problem.
+const problemTypePrefix = "urn:go-kit-application:error:"
+
+// Problem is the RFC 7807 problem details body of the error responses, its
+// extension members carrying what pkg.Error keeps of the error.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Code is the stable identifier of the error, Type is made of it
+	Code      string `json:"code"`
+	Retryable bool   `json:"retryable,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Fields lists the rejected request fields of a validation error
+	Fields  []pkg.FieldViolation `json:"fields,omitempty"`
+	Details map[string]string    `json:"details,omitempty"`
+}
+
+// NewProblem returns the problem err is returned as in reply to the request
+// of ctx.
+func NewProblem(ctx context.Context, err error) Problem {
+	e := pkg.ErrorOf(err)
+	p := Problem{
+		Type:      problemTypePrefix + e.Code,
+		Title:     e.Message,
+		Status:    e.Kind.HTTPStatus(),
+		Code:      e.Code,
+		Retryable: e.Retryable,
+		RequestID: RequestIDFromContext(ctx),
+		Fields:    e.Fields,
+		Details:   e.Details,
+	}
+	if detail := pkg.PublicMessage(err); detail != p.Title {
+		p.Detail = detail
+	}
+	return p
+}
+
+// Err returns the pkg.Error p was made of.
+func (p Problem) Err() error {
+	code := strings.TrimPrefix(p.Type, problemTypePrefix)
+	if p.Code != "" {
+		code = p.Code
+	}
+	message := p.Title
+	if p.Detail != "" {
+		message = p.Detail
+	}
+	return &pkg.Error{
+		Kind:      kindOfStatus(p.Status),
+		Code:      code,
+		Message:   message,
+		Retryable: p.Retryable,
+		Details:   p.Details,
+		Fields:    p.Fields,
+	}
+}
+
+func kindOfStatus(code int) pkg.Kind {
+	for _, kind := range []pkg.Kind{
+		pkg.KindInvalidArgument,
+		pkg.KindUnauthenticated,
+		pkg.KindPermissionDenied,
+		pkg.KindNotFound,
+		pkg.KindAlreadyExists,
+		pkg.KindLocked,
+		pkg.KindResourceExhausted,
+		pkg.KindUnavailable,
+		pkg.KindDeadlineExceeded,
+	} {
+		if kind.HTTPStatus() == code {
+			return kind
+		}
+	}
+	return pkg.KindInternal
 }
 
-func ErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	w.WriteHeader(err2code(err))
-	json.NewEncoder(w).Encode(ErrorWrapper{Error: err.Error()})
+// ErrorEncoder is a kithttp.ErrorEncoder writing err as a problem details
+// body, with the status code of its kind.
+func ErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	p := NewProblem(ctx, err)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
 }
 
-func err2code(err error) int {
-	return http.StatusInternalServerError
+// DecodeProblem returns the error of an error response, the pkg.Error of its
+// problem details body, or one made of its status code if it has none.
+func DecodeProblem(r *http.Response) error {
+	p := Problem{Status: r.StatusCode}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), ProblemContentType) {
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return err
+		}
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(r.StatusCode)
+	}
+	if p.Code == "" && !strings.HasPrefix(p.Type, problemTypePrefix) {
+		p.Code = string(kindOfStatus(r.StatusCode))
+	}
+	return p.Err()
 }
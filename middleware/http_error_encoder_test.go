@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+func TestErrorEncoder(t *testing.T) {
+	errLocked := pkg.NewRetryableError(pkg.KindLocked, "account_locked", "account locked")
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	w := httptest.NewRecorder()
+	ErrorEncoder(ctx, fmt.Errorf("login: %w", errLocked), w)
+
+	if w.Code != http.StatusLocked || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("expected a 423 problem, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := Problem{
+		Type:      "urn:go-kit-application:error:account_locked",
+		Title:     "account locked",
+		Status:    http.StatusLocked,
+		Detail:    "login: account locked",
+		Code:      "account_locked",
+		Retryable: true,
+		RequestID: "req-42",
+	}
+	if fmt.Sprint(p) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, p)
+	}
+
+	// a client decodes the problem back to the error
+	err := DecodeProblem(w.Result())
+	if !errors.Is(err, errLocked) || !pkg.IsRetryable(err) || pkg.HTTPStatus(err) != http.StatusLocked {
+		t.Fatalf("expected the locked error, got %+v", err)
+	}
+}
+
+func TestErrorEncoderInternal(t *testing.T) {
+	w := httptest.NewRecorder()
+	ErrorEncoder(context.Background(), errors.New("mongo: no reachable servers"), w)
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	// the message of the errors of no kind is not sent
+	if w.Code != http.StatusInternalServerError || p.Title != "internal error" || p.Detail != "" {
+		t.Fatalf("expected an internal error, got %d %+v", w.Code, p)
+	}
+}
+
+func TestDecodeProblemWithoutBody(t *testing.T) {
+	r := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	err := DecodeProblem(r)
+	if pkg.HTTPStatus(err) != http.StatusServiceUnavailable || err.Error() != "Service Unavailable" {
+		t.Fatalf("expected an unavailable error, got %+v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextLogger returns logger, its lines carrying the request ID, the trace
+// ID and the authenticated user of ctx, those it knows of.
+func ContextLogger(ctx context.Context, logger log.Logger) log.Logger {
+	var keyvals []interface{}
+	if id := RequestIDFromContext(ctx); id != "" {
+		keyvals = append(keyvals, "request_id", id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		keyvals = append(keyvals, "trace_id", sc.TraceID().String())
+	}
+	if user := userOf(ctx); user != "" {
+		keyvals = append(keyvals, "user", user)
+	}
+	if len(keyvals) == 0 {
+		return logger
+	}
+	return log.With(logger, keyvals...)
+}
+
+type userSlotKey struct{}
+
+// withUserSlot returns a copy of ctx in which Authenticate records the user
+// it authenticated, for the middlewares wrapping it to log the user once the
+// call returned.
+func withUserSlot(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(userSlotKey{}).(*atomic.Value); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, userSlotKey{}, new(atomic.Value))
+}
+
+func recordUser(ctx context.Context, username string) {
+	if slot, ok := ctx.Value(userSlotKey{}).(*atomic.Value); ok {
+		slot.Store(username)
+	}
+}
+
+func userOf(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.Username
+	}
+	if slot, ok := ctx.Value(userSlotKey{}).(*atomic.Value); ok {
+		user, _ := slot.Load().(string)
+		return user
+	}
+	return ""
+}
+
+// leveled returns logger at the level of the outcome of a request failed with
+// err, if any: info for a success, warn for a client error, error otherwise.
+func leveled(logger log.Logger, err error) log.Logger {
+	switch Outcome(err) {
+	case OutcomeSuccess:
+		return level.Info(logger)
+	case OutcomeClientError:
+		return level.Warn(logger)
+	}
+	return level.Error(logger)
+}
+
+// LogErrorHandler is a transport.ErrorHandler logging the errors of the
+// transports with ContextLogger.
+type LogErrorHandler struct {
+	logger log.Logger
+}
+
+// NewLogErrorHandler returns a LogErrorHandler logging to logger.
+func NewLogErrorHandler(logger log.Logger) *LogErrorHandler {
+	return &LogErrorHandler{logger: logger}
+}
+
+// Handle logs err.
+func (h *LogErrorHandler) Handle(ctx context.Context, err error) {
+	leveled(ContextLogger(ctx, h.logger), err).Log("err", err)
+}
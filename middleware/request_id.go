@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the header, and in lower case the gRPC metadata key, a
+// request ID travels in.
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDMetadata = "x-request-id"
+
+// maxRequestIDLength bounds the request IDs accepted from the callers.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID or
+// GRPCRequestID, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID, 32 hex characters.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts the IDs made of up to maxRequestIDLength printable
+// ASCII characters, the others are replaced rather than logged.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the request ID already in the context, the one the
+// caller sent, or a new one.
+func requestID(ctx context.Context, sent string) string {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return id
+	}
+	if validRequestID(sent) {
+		return sent
+	}
+	return NewRequestID()
+}
+
+// RequestID is an HTTP middleware storing the request ID in the request
+// context, the X-Request-ID of the caller or a new one, and returning it in
+// the X-Request-ID response header, errors included.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Context(), r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// GRPCRequestID is a gRPC unary interceptor storing the request ID in the
+// context, the x-request-id metadata of the caller or a new one, and
+// returning it in the x-request-id response header, errors included.
+func GRPCRequestID(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var sent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) > 0 {
+			sent = values[0]
+		}
+	}
+	id := requestID(ctx, sent)
+	// the header only fails to be set out of a gRPC server, as in tests
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	return handler(ContextWithRequestID(ctx, id), req)
+}
+
+// RequestIDToHTTP is a kithttp.RequestFunc forwarding the request ID in the
+// context as the X-Request-ID header.
+func RequestIDToHTTP(ctx context.Context, r *http.Request) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	return ctx
+}
+
+// RequestIDToGRPC is a kitgrpc.ClientRequestFunc forwarding the request ID in
+// the context as x-request-id metadata.
+func RequestIDToGRPC(ctx context.Context, md *metadata.MD) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		md.Set(requestIDMetadata, id)
+	}
+	return ctx
+}
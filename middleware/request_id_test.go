@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		sent string
+		kept bool
+	}{
+		{"generated", "", false},
+		{"accepted", "req-42", true},
+		{"control characters replaced", "req\n42", false},
+		{"too long replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestIDFromContext(r.Context())
+				w.WriteHeader(http.StatusTeapot)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				r.Header.Set(RequestIDHeader, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if seen == "" || w.Header().Get(RequestIDHeader) != seen {
+				t.Fatalf("request ID %q in the context, %q returned", seen, w.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.sent) != tt.kept {
+				t.Fatalf("request ID %q for %q sent", seen, tt.sent)
+			}
+		})
+	}
+}
+
+func TestRequestIDNested(t *testing.T) {
+	// a handler served behind another, as the usersvc handler at the gateway,
+	// keeps the request ID of the outer one
+	var outer, inner string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outer = RequestIDFromContext(r.Context())
+		RequestID(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			inner = RequestIDFromContext(r.Context())
+		})).ServeHTTP(w, r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if outer == "" || inner != outer {
+		t.Fatalf("request ID %q inside %q", inner, outer)
+	}
+}
+
+func TestGRPCRequestID(t *testing.T) {
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	md := &metadata.MD{}
+	ctx = RequestIDToGRPC(ctx, md)
+
+	// the server side of the call
+	incoming := metadata.NewIncomingContext(context.Background(), *md)
+	var seen string
+	GRPCRequestID(incoming, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = RequestIDFromContext(ctx)
+		return nil, nil
+	})
+	if seen != "req-42" {
+		t.Fatalf("request ID %q forwarded", seen)
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+	parse := func(context.Context, string) (*model.CustomerClaims, error) {
+		return &model.CustomerClaims{Username: "pascal"}, nil
+	}
+	e := LoggingMiddleware(logger)(Authenticate(parse)(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.New("failure")
+	}))
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	ctx = context.WithValue(ctx, kitjwt.JWTContextKey, "token")
+	e(ctx, nil)
+
+	// the user authenticated inside the logging middleware is logged
+	if got := buf.String(); !strings.HasPrefix(got, "level=error request_id=req-42 user=pascal transport_error=failure") {
+		t.Fatalf("unexpected log line %q", got)
+	}
+}
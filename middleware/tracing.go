@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The span started by a transport option is kept under its own key, so the
+// finalizer never ends the span of the caller when the request failed before
+// the option ran.
+type transportSpanKey struct{}
+
+func withTransportSpan(ctx context.Context, span trace.Span) context.Context {
+	return context.WithValue(trace.ContextWithSpan(ctx, span), transportSpanKey{}, span)
+}
+
+func transportSpan(ctx context.Context) (trace.Span, bool) {
+	span, ok := ctx.Value(transportSpanKey{}).(trace.Span)
+	return span, ok
+}
+
+// TraceEndpoint returns an endpoint middleware recording a span named name
+// around each call, the child of the span in the context. Business errors of
+// an endpoint.Failer response fail the span, as errors do.
+func TraceEndpoint(tracer trace.Tracer, name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx, span := tracer.Start(ctx, name)
+			defer func() {
+				if err == nil {
+					if f, ok := response.(endpoint.Failer); ok {
+						recordError(span, f.Failed())
+					}
+				}
+				recordError(span, err)
+				span.End()
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// HTTPServerTrace is a kithttp.ServerOption recording a server span for each
+// request, the child of the trace context of the request headers. The span
+// is named after the method and the route template, or the path.
+func HTTPServerTrace(tracer trace.Tracer) kithttp.ServerOption {
+	before := kithttp.ServerBefore(func(ctx context.Context, r *http.Request) context.Context {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+		path := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				path = template
+			}
+		}
+		_, span := tracer.Start(ctx, r.Method+" "+path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.HTTPRoute(path),
+			),
+		)
+		return withTransportSpan(ctx, span)
+	})
+	finalizer := kithttp.ServerFinalizer(func(ctx context.Context, code int, _ *http.Request) {
+		span, ok := transportSpan(ctx)
+		if !ok {
+			return
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+		span.End()
+	})
+	return func(s *kithttp.Server) {
+		before(s)
+		finalizer(s)
+	}
+}
+
+// HTTPClientTrace is a kithttp.ClientOption recording a client span for each
+// request, its trace context written in the request headers.
+func HTTPClientTrace(tracer trace.Tracer) kithttp.ClientOption {
+	before := kithttp.ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLFull(r.URL.String()),
+			),
+		)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+		return withTransportSpan(ctx, span)
+	})
+	after := kithttp.ClientAfter(func(ctx context.Context, resp *http.Response) context.Context {
+		if span, ok := transportSpan(ctx); ok {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			if resp.StatusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+		}
+		return ctx
+	})
+	finalizer := kithttp.ClientFinalizer(func(ctx context.Context, err error) {
+		span, ok := transportSpan(ctx)
+		if !ok {
+			return
+		}
+		recordError(span, err)
+		span.End()
+	})
+	return func(c *kithttp.Client) {
+		before(c)
+		after(c)
+		finalizer(c)
+	}
+}
+
+// GRPCServerTrace is a kitgrpc.ServerOption recording a server span for each
+// call, the child of the trace context of the request metadata. The span is
+// named after the method, taken from the context, which kitgrpc.Interceptor
+// stores it in.
+func GRPCServerTrace(tracer trace.Tracer) kitgrpc.ServerOption {
+	before := kitgrpc.ServerBefore(func(ctx context.Context, md metadata.MD) context.Context {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+		method, _ := ctx.Value(kitgrpc.ContextKeyRequestMethod).(string)
+		if method == "" {
+			method, _ = grpc.Method(ctx)
+		}
+		_, span := tracer.Start(ctx, strings.TrimPrefix(method, "/"),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(rpcAttributes(method)...),
+		)
+		return withTransportSpan(ctx, span)
+	})
+	finalizer := kitgrpc.ServerFinalizer(func(ctx context.Context, err error) {
+		span, ok := transportSpan(ctx)
+		if !ok {
+			return
+		}
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		recordError(span, err)
+		span.End()
+	})
+	return func(s *kitgrpc.Server) {
+		before(s)
+		finalizer(s)
+	}
+}
+
+// GRPCClientTrace is a kitgrpc.ClientOption recording a client span for each
+// call, its trace context written in the request metadata.
+func GRPCClientTrace(tracer trace.Tracer) kitgrpc.ClientOption {
+	before := kitgrpc.ClientBefore(func(ctx context.Context, md *metadata.MD) context.Context {
+		method, _ := ctx.Value(kitgrpc.ContextKeyRequestMethod).(string)
+		ctx, span := tracer.Start(ctx, strings.TrimPrefix(method, "/"),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(rpcAttributes(method)...),
+		)
+		otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(*md))
+		return withTransportSpan(ctx, span)
+	})
+	finalizer := kitgrpc.ClientFinalizer(func(ctx context.Context, err error) {
+		span, ok := transportSpan(ctx)
+		if !ok {
+			return
+		}
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		recordError(span, err)
+		span.End()
+	})
+	return func(c *kitgrpc.Client) {
+		before(c)
+		finalizer(c)
+	}
+}
+
+// rpcAttributes describes the gRPC method /package.Service/Method.
+func rpcAttributes(method string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{semconv.RPCSystemGRPC}
+	parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+	if len(parts) == 2 {
+		attributes = append(attributes, semconv.RPCService(parts[0]), semconv.RPCMethod(parts[1]))
+	}
+	return attributes
+}
+
+// metadataCarrier reads and writes the trace context in gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+type failed struct{ err error }
+
+func (r failed) Failed() error { return r.err }
+
+func newRecorder(t *testing.T) (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	t.Helper()
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+	recorder := tracetest.NewSpanRecorder()
+	return recorder, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+}
+
+func TestHTTPTrace(t *testing.T) {
+	recorder, provider := newRecorder(t)
+	tracer := provider.Tracer("test")
+
+	business := errors.New("business failure")
+	server := kithttp.NewServer(
+		TraceEndpoint(tracer, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+			return failed{business}, nil
+		}),
+		func(context.Context, *http.Request) (interface{}, error) { return nil, nil },
+		func(_ context.Context, w http.ResponseWriter, _ interface{}) error { return nil },
+		HTTPServerTrace(tracer),
+	)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	target, _ := url.Parse(ts.URL + "/sum")
+	client := kithttp.NewClient(http.MethodPost, target,
+		kithttp.EncodeJSONRequest,
+		func(context.Context, *http.Response) (interface{}, error) { return nil, nil },
+		HTTPClientTrace(tracer),
+	)
+	ctx, root := tracer.Start(context.Background(), "root")
+	if _, err := client.Endpoint()(ctx, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for child, parent := range map[string]string{"POST": "root", "POST /sum": "POST", "Sum": "POST /sum"} {
+		c, p := spans[child], spans[parent]
+		if c == nil || p == nil {
+			t.Fatalf("missing spans %q or %q in %v", child, parent, spans)
+		}
+		if c.Parent().SpanID() != p.SpanContext().SpanID() || c.SpanContext().TraceID() != p.SpanContext().TraceID() {
+			t.Errorf("span %q is not a child of %q", child, parent)
+		}
+	}
+	if status := spans["Sum"].Status(); status.Code != codes.Error || status.Description != business.Error() {
+		t.Errorf("the business error did not fail the endpoint span: %+v", status)
+	}
+	if status := spans["POST /sum"].Status(); status.Code == codes.Error {
+		t.Errorf("the server span failed: %+v", status)
+	}
+}
+
+func TestGRPCClientTraceEncodingError(t *testing.T) {
+	// the call fails before the client span starts, the span of the caller
+	// is left alone
+	recorder, provider := newRecorder(t)
+	tracer := provider.Tracer("test")
+	client := kitgrpc.NewClient(nil, "pb.Add", "Sum",
+		func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("encoding failure") },
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+		struct{}{},
+		GRPCClientTrace(tracer),
+	)
+	ctx, root := tracer.Start(context.Background(), "root")
+	if _, err := client.Endpoint()(ctx, nil); err == nil {
+		t.Fatal("expected an encoding error")
+	}
+	if ended := recorder.Ended(); len(ended) != 0 {
+		t.Fatalf("%d spans ended with the call", len(ended))
+	}
+	root.End()
+}
+
+func TestMetadataCarrier(t *testing.T) {
+	_, provider := newRecorder(t)
+	ctx, span := provider.Tracer("test").Start(context.Background(), "root")
+	defer span.End()
+
+	md := metadata.MD{}
+	propagation.TraceContext{}.Inject(ctx, metadataCarrier(md))
+	if len(md.Get("traceparent")) != 1 {
+		t.Fatalf("traceparent not written: %v", md)
+	}
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), metadataCarrier(md)))
+	if remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("span context %v read back, want %v", remote, span.SpanContext())
+	}
+}
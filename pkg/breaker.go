@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sony/gobreaker"
+)
+
+var breakers = struct {
+	sync.Mutex
+	byName map[string]*gobreaker.CircuitBreaker
+}{byName: map[string]*gobreaker.CircuitBreaker{}}
+
+// NewBreaker returns a circuit breaker reported by BreakersCheck. A breaker
+// replaces the previous one of the same name, name them after the method and
+// the instance they guard.
+func NewBreaker(settings gobreaker.Settings) *gobreaker.CircuitBreaker {
+	cb := gobreaker.NewCircuitBreaker(settings)
+	breakers.Lock()
+	defer breakers.Unlock()
+	breakers.byName[settings.Name] = cb
+	return cb
+}
+
+// BreakersCheck fails while circuit breakers are open, that is while calls to
+// downstream services are failing. Breakers of instances gone away end up
+// half-open once their timeout is over, they do not fail the check forever.
+func BreakersCheck(_ context.Context) error {
+	breakers.Lock()
+	defer breakers.Unlock()
+	var open []string
+	for name, cb := range breakers.byName {
+		if cb.State() == gobreaker.StateOpen {
+			open = append(open, name)
+		}
+	}
+	if len(open) > 0 {
+		sort.Strings(open)
+		return fmt.Errorf("open circuit breakers: %s", strings.Join(open, ", "))
+	}
+	return nil
+}
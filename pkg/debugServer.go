@@ -1,30 +1,24 @@
 package pkg
 
 import (
-	"fmt"
-	"net"
 	"net/http"
-
-	"github.com/go-kit/kit/log"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func StartDebugServer(port int, logger log.Logger) error {
-	http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
-
-	// The debug listener mounts the http.DefaultServeMux, and serves up
-	// stuff like the Prometheus metrics route, the Go debug and profiling
-	// routes, and so on.
-	debugListener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return err
-	}
-	logger.Log("transport", "http", "addr", port)
-
-	if err := http.Serve(debugListener, http.DefaultServeMux); err != nil {
-		return err
-	}
-	return nil
+var debugOnce sync.Once
 
+// DebugHandler returns the handler of the debug server. It serves the health
+// endpoints, and mounts the http.DefaultServeMux, which serves up stuff like
+// the Prometheus metrics route, the Go debug and profiling routes, and so on.
+func DebugHandler(health *Health) http.Handler {
+	debugOnce.Do(func() {
+		http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
+	})
+	m := http.NewServeMux()
+	m.Handle("/livez", health.Handler())
+	m.Handle("/readyz", health.Handler())
+	m.Handle("/", http.DefaultServeMux)
+	return m
 }
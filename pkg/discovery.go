@@ -5,9 +5,13 @@ import (
 	"log"
 	"sync"
 
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
 	consulsd "github.com/go-kit/kit/sd/consul"
 	consulapi "github.com/hashicorp/consul/api"
 	watch "github.com/hashicorp/consul/api/watch"
+
+	appconfig "github.com/pascallin/go-kit-application/config"
 )
 
 type KitDiscoverClient struct {
@@ -21,12 +25,18 @@ type ServiceInstance struct {
 	InstanceId   string
 	InstanceHost string
 	InstancePort int
+	// HTTPCheck is the URL Consul checks the health of the instance at, the
+	// gRPC health service of the instance is checked if empty
+	HTTPCheck string
 }
 
 func NewKitDiscoverClient() (client *KitDiscoverClient, err error) {
 	c := new(KitDiscoverClient)
 	config := consulapi.DefaultConfig()
-	apiClient, err := consulapi.NewClient(consulapi.DefaultConfig())
+	if url := appconfig.GetInfraConfig().CONSUL_URL; url != "" {
+		config.Address = url
+	}
+	apiClient, err := consulapi.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
@@ -36,17 +46,21 @@ func NewKitDiscoverClient() (client *KitDiscoverClient, err error) {
 }
 
 func (c *KitDiscoverClient) Register(name string, instance ServiceInstance, meta map[string]string) error {
+	check := &consulapi.AgentServiceCheck{
+		DeregisterCriticalServiceAfter: "30s",
+		GRPC:                           fmt.Sprintf("%s:%d", instance.InstanceHost, instance.InstancePort),
+		Interval:                       "15s",
+	}
+	if instance.HTTPCheck != "" {
+		check.GRPC, check.HTTP = "", instance.HTTPCheck
+	}
 	serviceRegistration := &consulapi.AgentServiceRegistration{
 		ID:      instance.InstanceId,
 		Name:    name,
 		Address: instance.InstanceHost,
 		Port:    instance.InstancePort,
 		Meta:    meta,
-		Check: &consulapi.AgentServiceCheck{
-			DeregisterCriticalServiceAfter: "30s",
-			GRPC:                           fmt.Sprintf("%s:%d", instance.InstanceHost, instance.InstancePort),
-			Interval:                       "15s",
-		},
+		Check:   check,
 	}
 	err := c.Client.Register(serviceRegistration)
 	if err != nil {
@@ -136,3 +150,34 @@ func (c *KitDiscoverClient) DiscoveryServices(serviceName string) []interface{}
 	c.instanceMap.Store(serviceName, instances)
 	return instances
 }
+
+// ConsulRegistry registers instances in Consul, health checked over gRPC, and
+// discovers the passing ones.
+type ConsulRegistry struct {
+	client *KitDiscoverClient
+	logger kitlog.Logger
+}
+
+func NewConsulRegistry(logger kitlog.Logger) (*ConsulRegistry, error) {
+	client, err := NewKitDiscoverClient()
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulRegistry{client: client, logger: logger}, nil
+}
+
+func (r *ConsulRegistry) Register(name string, instance ServiceInstance, meta map[string]string) error {
+	return r.client.Register(name, instance, meta)
+}
+
+func (r *ConsulRegistry) Deregister(instanceId string) error {
+	return r.client.Client.Deregister(&consulapi.AgentServiceRegistration{ID: instanceId})
+}
+
+func (r *ConsulRegistry) Instancer(name string) (sd.Instancer, error) {
+	var (
+		tags        = []string{}
+		passingOnly = true
+	)
+	return consulsd.NewInstancer(r.client.Client, r.logger, name, tags, passingOnly), nil
+}
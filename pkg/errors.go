@@ -0,0 +1,293 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/golang/protobuf/proto"
+	"github.com/sony/gobreaker"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the errdetails.ErrorInfo the errors of the
+// services are sent with, the errors of other domains are not decoded.
+const ErrorDomain = "go-kit-application"
+
+// Kind classifies the errors, the HTTP status and the gRPC code they are
+// returned with follow from it.
+type Kind string
+
+const (
+	KindInternal          Kind = "internal"
+	KindInvalidArgument   Kind = "invalid_argument"
+	KindUnauthenticated   Kind = "unauthenticated"
+	KindPermissionDenied  Kind = "permission_denied"
+	KindNotFound          Kind = "not_found"
+	KindAlreadyExists     Kind = "already_exists"
+	KindLocked            Kind = "locked"
+	KindResourceExhausted Kind = "resource_exhausted"
+	KindUnavailable       Kind = "unavailable"
+	KindDeadlineExceeded  Kind = "deadline_exceeded"
+)
+
+var httpStatuses = map[Kind]int{
+	KindInternal:          http.StatusInternalServerError,
+	KindInvalidArgument:   http.StatusBadRequest,
+	KindUnauthenticated:   http.StatusUnauthorized,
+	KindPermissionDenied:  http.StatusForbidden,
+	KindNotFound:          http.StatusNotFound,
+	KindAlreadyExists:     http.StatusConflict,
+	KindLocked:            http.StatusLocked,
+	KindResourceExhausted: http.StatusTooManyRequests,
+	KindUnavailable:       http.StatusServiceUnavailable,
+	KindDeadlineExceeded:  http.StatusGatewayTimeout,
+}
+
+var grpcCodes = map[Kind]codes.Code{
+	KindInternal:          codes.Internal,
+	KindInvalidArgument:   codes.InvalidArgument,
+	KindUnauthenticated:   codes.Unauthenticated,
+	KindPermissionDenied:  codes.PermissionDenied,
+	KindNotFound:          codes.NotFound,
+	KindAlreadyExists:     codes.AlreadyExists,
+	KindLocked:            codes.FailedPrecondition,
+	KindResourceExhausted: codes.ResourceExhausted,
+	KindUnavailable:       codes.Unavailable,
+	KindDeadlineExceeded:  codes.DeadlineExceeded,
+}
+
+// kindsByCode maps the gRPC codes back to kinds, the codes of no kind to
+// KindInternal.
+var kindsByCode = func() map[codes.Code]Kind {
+	m := make(map[codes.Code]Kind, len(grpcCodes))
+	for kind, code := range grpcCodes {
+		m[code] = kind
+	}
+	return m
+}()
+
+// HTTPStatus returns the HTTP status code of the errors of kind k.
+func (k Kind) HTTPStatus() int {
+	if code, ok := httpStatuses[k]; ok {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC code of the errors of kind k.
+func (k Kind) GRPCCode() codes.Code {
+	if code, ok := grpcCodes[k]; ok {
+		return code
+	}
+	return codes.Internal
+}
+
+// serverFault tells the kinds of errors which are the fault of the server
+// rather than of the request.
+func (k Kind) serverFault() bool {
+	return k.HTTPStatus() >= http.StatusInternalServerError
+}
+
+// transient tells the kinds of the errors of gRPC itself, rather than of the
+// services, which may not happen again on retry.
+func (k Kind) transient() bool {
+	return k == KindUnavailable || k == KindDeadlineExceeded
+}
+
+// FieldViolation describes why the value of a request field was rejected.
+type FieldViolation struct {
+	Field string `json:"field"`
+	// Code is a stable identifier of the rule, for clients to translate
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error of the domain of the services, which keeps its code,
+// kind and details across HTTP and gRPC. Errors are matched by code with
+// errors.Is, so the errors decoded by a client match the variables of the
+// service they were returned by.
+type Error struct {
+	Kind Kind
+	// Code is a stable identifier of the error, for clients to tell it apart
+	Code    string
+	Message string
+	// Retryable errors may not happen again if the request is retried later
+	Retryable bool
+	Details   map[string]string
+	// Fields lists the rejected request fields of a validation error
+	Fields []FieldViolation
+}
+
+// NewError returns an Error of kind, identified by code.
+func NewError(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NewRetryableError returns a retryable Error of kind, identified by code.
+func NewRetryableError(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Retryable: true}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches the errors with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+var (
+	errInternal         = NewError(KindInternal, "internal", "internal error")
+	errLimited          = NewRetryableError(KindResourceExhausted, "rate_limited", ratelimit.ErrLimited.Error())
+	errBreakerOpen      = NewRetryableError(KindUnavailable, "circuit_open", gobreaker.ErrOpenState.Error())
+	errDeadlineExceeded = NewRetryableError(KindDeadlineExceeded, "deadline_exceeded", context.DeadlineExceeded.Error())
+	errUnavailable      = NewRetryableError(KindUnavailable, "unavailable", "service unavailable")
+)
+
+// ErrorOf returns the Error err is or wraps. The errors of the rate limiters,
+// circuit breakers, timeouts and network are given their kinds, the gRPC
+// status errors that of their code, and the others are internal errors.
+func ErrorOf(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	switch {
+	case errors.Is(err, ratelimit.ErrLimited):
+		return errLimited
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		return errBreakerOpen
+	case errors.Is(err, context.DeadlineExceeded):
+		return errDeadlineExceeded
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		kind := kindOf(st.Code())
+		return &Error{Kind: kind, Code: string(kind), Message: st.Message(), Retryable: kind.transient()}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errUnavailable
+	}
+	return errInternal
+}
+
+func kindOf(code codes.Code) Kind {
+	if kind, ok := kindsByCode[code]; ok {
+		return kind
+	}
+	return KindInternal
+}
+
+// HTTPStatus returns the HTTP status code err is returned with.
+func HTTPStatus(err error) int {
+	return ErrorOf(err).Kind.HTTPStatus()
+}
+
+// IsServerError tells the errors which are the fault of the server, those the
+// circuit breakers count, from the rejected requests.
+func IsServerError(err error) bool {
+	return err != nil && ErrorOf(err).Kind.serverFault()
+}
+
+// IsRetryable tells whether err may not happen again if the request is
+// retried later.
+func IsRetryable(err error) bool {
+	return err != nil && ErrorOf(err).Retryable
+}
+
+// PublicMessage returns the message of err a caller is shown, that of err,
+// wrapping included, but for the internal and network errors whose message
+// is hidden, since it may name the hosts of the services.
+func PublicMessage(err error) string {
+	e := ErrorOf(err)
+	if e.Kind == KindInternal || e.Kind == "" || e == errUnavailable {
+		return e.Message
+	}
+	return err.Error()
+}
+
+// GRPCStatus returns the gRPC status err is returned with, its code following
+// the kind of err, with an errdetails.ErrorInfo carrying its code and
+// details, an errdetails.RetryInfo if retryable, and an errdetails.BadRequest
+// listing its rejected fields.
+func GRPCStatus(err error) *status.Status {
+	e := ErrorOf(err)
+	st := status.New(e.Kind.GRPCCode(), PublicMessage(err))
+	details := []proto.Message{&errdetails.ErrorInfo{
+		Reason:   e.Code,
+		Domain:   ErrorDomain,
+		Metadata: e.Details,
+	}}
+	if e.Retryable {
+		details = append(details, &errdetails.RetryInfo{})
+	}
+	if len(e.Fields) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, v := range e.Fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Code + ": " + v.Message,
+			})
+		}
+		details = append(details, br)
+	}
+	if withDetails, detailErr := st.WithDetails(details...); detailErr == nil {
+		return withDetails
+	}
+	return st
+}
+
+// GRPCError returns err as a gRPC status error, see GRPCStatus. The status
+// errors are returned as they are.
+func GRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return GRPCStatus(err).Err()
+}
+
+// ErrorFromGRPC turns the gRPC status errors made by GRPCError back into the
+// Error they were made from. The other errors are returned as they are.
+func ErrorFromGRPC(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	kind := kindOf(st.Code())
+	e := &Error{Kind: kind, Code: string(kind), Message: st.Message()}
+	// the errors of the domain are retryable if sent with a RetryInfo, the
+	// others, those of gRPC itself, if unavailable or timed out as well
+	var known, retry bool
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.Domain == ErrorDomain && d.Reason != "" {
+				known = true
+				e.Code, e.Details = d.Reason, d.Metadata
+			}
+		case *errdetails.RetryInfo:
+			retry = true
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				violation := FieldViolation{Field: v.Field, Message: v.Description}
+				if parts := strings.SplitN(v.Description, ": ", 2); len(parts) == 2 {
+					violation.Code, violation.Message = parts[0], parts[1]
+				}
+				e.Fields = append(e.Fields, violation)
+			}
+		}
+	}
+	e.Retryable = retry || !known && kind.transient()
+	return e
+}
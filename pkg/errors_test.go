@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCErrorRoundTrip(t *testing.T) {
+	errOverflow := NewError(KindInvalidArgument, "int_overflow", "integer overflow")
+	errLocked := NewRetryableError(KindLocked, "account_locked", "account locked")
+	invalid := &Error{
+		Kind:    KindInvalidArgument,
+		Code:    "validation_failed",
+		Message: "validation failed",
+		Details: map[string]string{"resource": "user"},
+		Fields:  []FieldViolation{{Field: "password", Code: "too_short", Message: "must be at least 8 characters"}},
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{"domain error", errOverflow, codes.InvalidArgument, "integer overflow"},
+		{"wrapped domain error", fmt.Errorf("sum: %w", errOverflow), codes.InvalidArgument, "sum: integer overflow"},
+		{"retryable error", errLocked, codes.FailedPrecondition, "account locked"},
+		{"validation error", invalid, codes.InvalidArgument, "validation failed"},
+		{"rate limited", ratelimit.ErrLimited, codes.ResourceExhausted, "rate limit exceeded"},
+		{"internal error", errors.New("mongo: no reachable servers"), codes.Internal, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := GRPCError(tt.err)
+			st, _ := status.FromError(sent)
+			if st.Code() != tt.code || st.Message() != tt.message {
+				t.Fatalf("expected %v %q, got %v %q", tt.code, tt.message, st.Code(), st.Message())
+			}
+
+			received := ErrorFromGRPC(sent)
+			if !errors.Is(received, ErrorOf(tt.err)) {
+				t.Fatalf("%v does not match %v", received, tt.err)
+			}
+			want, got := ErrorOf(tt.err), ErrorOf(received)
+			if got.Kind != want.Kind || got.Retryable != want.Retryable || HTTPStatus(received) != HTTPStatus(tt.err) {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+			if fmt.Sprint(got.Fields) != fmt.Sprint(want.Fields) || fmt.Sprint(got.Details) != fmt.Sprint(want.Details) {
+				t.Fatalf("expected the fields and details of %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestErrorFromGRPC(t *testing.T) {
+	// the errors gRPC returns itself keep their code
+	err := ErrorFromGRPC(status.Error(codes.Unavailable, "connection refused"))
+	if HTTPStatus(err) != http.StatusServiceUnavailable || !IsRetryable(err) || !IsServerError(err) {
+		t.Fatalf("expected a retryable unavailable error, got %+v", err)
+	}
+	err = ErrorFromGRPC(status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+	if HTTPStatus(err) != http.StatusGatewayTimeout || !IsRetryable(err) {
+		t.Fatalf("expected a retryable timeout, got %+v", err)
+	}
+	if err := errors.New("not a status"); ErrorFromGRPC(err) != err {
+		t.Fatalf("expected the error as it is")
+	}
+}
+
+func TestErrorOf(t *testing.T) {
+	tests := []struct {
+		err         error
+		status      int
+		serverError bool
+	}{
+		{NewError(KindNotFound, "user_not_found", "user not found"), http.StatusNotFound, false},
+		{ratelimit.ErrLimited, http.StatusTooManyRequests, false},
+		{gobreaker.ErrOpenState, http.StatusServiceUnavailable, true},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, http.StatusServiceUnavailable, true},
+		{errors.New("boom"), http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		if code := HTTPStatus(tt.err); code != tt.status {
+			t.Errorf("%v: expected %d, got %d", tt.err, tt.status, code)
+		}
+		if IsServerError(tt.err) != tt.serverError {
+			t.Errorf("%v: expected server error %v", tt.err, tt.serverError)
+		}
+	}
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	if msg := PublicMessage(dial); msg != "service unavailable" {
+		t.Errorf("expected the network error hidden, got %q", msg)
+	}
+	if IsServerError(nil) || IsRetryable(nil) {
+		t.Errorf("nil is no error")
+	}
+}
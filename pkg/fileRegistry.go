@@ -0,0 +1,239 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+// FileInstance is an instance of a service in the registry file.
+type FileInstance struct {
+	ID      string            `json:"id"`
+	Address string            `json:"address"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// FileRegistry keeps the instances of each service in a JSON file, such as
+//
+//	{"addsvc": [{"id": "addsvc-1", "address": "localhost:9083"}]}
+//
+// which services on the same machine register into, or which is written by
+// hand. The file is watched, instancers follow its changes. Concurrent
+// registrations from several processes may race, it is meant for development.
+type FileRegistry struct {
+	path   string
+	logger log.Logger
+
+	mu         sync.Mutex
+	watcher    *fsnotify.Watcher
+	instancers map[string]*fileInstancer
+}
+
+func NewFileRegistry(path string, logger log.Logger) *FileRegistry {
+	return &FileRegistry{path: path, logger: logger, instancers: map[string]*fileInstancer{}}
+}
+
+func (r *FileRegistry) Register(name string, instance ServiceInstance, meta map[string]string) error {
+	return r.update(func(services map[string][]FileInstance) {
+		instances := services[name][:0]
+		for _, i := range services[name] {
+			if i.ID != instance.InstanceId {
+				instances = append(instances, i)
+			}
+		}
+		services[name] = append(instances, FileInstance{ID: instance.InstanceId, Address: instance.address(), Meta: meta})
+	})
+}
+
+func (r *FileRegistry) Deregister(instanceId string) error {
+	return r.update(func(services map[string][]FileInstance) {
+		for name, instances := range services {
+			kept := instances[:0]
+			for _, i := range instances {
+				if i.ID != instanceId {
+					kept = append(kept, i)
+				}
+			}
+			if len(kept) == 0 {
+				delete(services, name)
+			} else {
+				services[name] = kept
+			}
+		}
+	})
+}
+
+// Instancer follows the instances of the service in the file. The file is
+// watched from the first call on.
+func (r *FileRegistry) Instancer(name string) (sd.Instancer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if instancer, ok := r.instancers[name]; ok {
+		return instancer, nil
+	}
+	if r.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		// the directory is watched, the file is replaced on every write
+		if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		r.watcher = watcher
+		go r.watch(watcher)
+	}
+	instancer := &fileInstancer{subscribers: map[chan<- sd.Event]struct{}{}}
+	services, err := r.read()
+	instancer.update(eventOf(services[name], err))
+	r.instancers[name] = instancer
+	return instancer, nil
+}
+
+// Close stops watching the file.
+func (r *FileRegistry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watcher == nil {
+		return nil
+	}
+	err := r.watcher.Close()
+	r.watcher = nil
+	return err
+}
+
+func (r *FileRegistry) watch(watcher *fsnotify.Watcher) {
+	path := filepath.Clean(r.path)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != path {
+				continue
+			}
+			services, err := r.read()
+			if err != nil {
+				r.logger.Log("registry", "file", "path", r.path, "err", err)
+			}
+			r.mu.Lock()
+			for name, instancer := range r.instancers {
+				instancer.update(eventOf(services[name], err))
+			}
+			r.mu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			r.logger.Log("registry", "file", "path", r.path, "err", err)
+		}
+	}
+}
+
+// read returns the services in the file, none if there is no file yet.
+func (r *FileRegistry) read() (map[string][]FileInstance, error) {
+	services := map[string][]FileInstance{}
+	data, err := ioutil.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return services, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return services, nil
+	}
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// update rewrites the file with the changes of change. The new content is
+// renamed over the file, watchers never see it half written.
+func (r *FileRegistry) update(change func(services map[string][]FileInstance)) error {
+	services, err := r.read()
+	if err != nil {
+		return err
+	}
+	change(services)
+	data, err := json.MarshalIndent(services, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+func eventOf(instances []FileInstance, err error) sd.Event {
+	if err != nil {
+		return sd.Event{Err: err}
+	}
+	addresses := make([]string, 0, len(instances))
+	for _, i := range instances {
+		addresses = append(addresses, i.Address)
+	}
+	sort.Strings(addresses)
+	return sd.Event{Instances: addresses}
+}
+
+// fileInstancer is a sd.Instancer sending the latest instances of a service
+// to its subscribers, on registration and on every change.
+type fileInstancer struct {
+	mu          sync.Mutex
+	state       sd.Event
+	subscribers map[chan<- sd.Event]struct{}
+}
+
+func (i *fileInstancer) update(event sd.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	// on errors the last instances are kept, as the consul instancer does
+	if event.Err == nil && reflect.DeepEqual(event.Instances, i.state.Instances) && i.state.Err == nil {
+		return
+	}
+	if event.Err != nil {
+		event.Instances = i.state.Instances
+	}
+	i.state = event
+	for ch := range i.subscribers {
+		ch <- event
+	}
+}
+
+func (i *fileInstancer) Register(ch chan<- sd.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.subscribers[ch] = struct{}{}
+	ch <- i.state
+}
+
+func (i *fileInstancer) Deregister(ch chan<- sd.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.subscribers, ch)
+}
+
+func (i *fileInstancer) Stop() {}
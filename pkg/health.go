@@ -0,0 +1,248 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Check tells whether a dependency is usable, by returning nil.
+type Check func(ctx context.Context) error
+
+// HealthCheck is a check registered in a Health.
+type HealthCheck struct {
+	Name  string
+	Check Check
+	// Critical checks make the service not ready when failing, the others
+	// only degrade it
+	Critical bool
+	// Services are the gRPC services which are not serving while a critical
+	// check fails, all of them when empty
+	Services []string
+}
+
+// CheckResult is the outcome of the last run of a check.
+type CheckResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the health of a service, as served on /readyz.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Health runs the checks of the dependencies of a service in the background,
+// and publishes their outcome: per gRPC service through grpc_health_v1, Watch
+// included, and over HTTP on /livez and /readyz.
+type Health struct {
+	logger   log.Logger
+	interval time.Duration
+	timeout  time.Duration
+	services []string
+	server   *health.Server
+
+	mu       sync.RWMutex
+	checks   []HealthCheck
+	results  []CheckResult
+	stopping bool
+	stop     chan struct{}
+}
+
+// NewHealth returns the health of a server serving the given gRPC services.
+// They are not serving until the checks ran once, on Start.
+func NewHealth(logger log.Logger, services ...string) *Health {
+	c := config.GetHealthConfig()
+	h := &Health{
+		logger:   logger,
+		interval: c.Interval,
+		timeout:  c.Timeout,
+		services: services,
+		server:   health.NewServer(),
+		stop:     make(chan struct{}),
+	}
+	for _, service := range append([]string{""}, services...) {
+		h.server.SetServingStatus(service, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+	return h
+}
+
+// Add registers a check, before Start.
+func (h *Health) Add(check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// Start runs the checks once, then every interval in the background.
+func (h *Health) Start() {
+	h.evaluate()
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.evaluate()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the checks and reports every service as not serving, so
+// clients and load balancers move away while the servers drain.
+func (h *Health) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopping {
+		return
+	}
+	h.stopping = true
+	close(h.stop)
+	h.server.Shutdown()
+}
+
+func (h *Health) evaluate() {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			results[i] = h.run(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	serving := map[string]bool{"": true}
+	for _, service := range h.services {
+		serving[service] = true
+	}
+	for i, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		h.logger.Log("health", result.Name, "status", result.Status, "err", result.Error)
+		if !result.Critical {
+			continue
+		}
+		serving[""] = false
+		services := checks[i].Services
+		if len(services) == 0 {
+			services = h.services
+		}
+		for _, service := range services {
+			serving[service] = false
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = results
+	if h.stopping {
+		return
+	}
+	for service, ok := range serving {
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if !ok {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		h.server.SetServingStatus(service, status)
+	}
+}
+
+func (h *Health) run(check HealthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	start := time.Now()
+	err := check.Check(ctx)
+	result := CheckResult{
+		Name:      check.Name,
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status, result.Error = StatusDown, err.Error()
+	}
+	return result
+}
+
+// Report returns the outcome of the last run of the checks. The service is
+// down if a critical check failed or it is shutting down, degraded if
+// another check failed.
+func (h *Health) Report() Report {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	report := Report{Status: StatusUp, Checks: append([]CheckResult{}, h.results...)}
+	for _, result := range h.results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	if h.stopping || h.results == nil && len(h.checks) > 0 {
+		report.Status = StatusDown
+	}
+	return report
+}
+
+// GRPCServer is the grpc_health_v1 service to register on the gRPC server.
+func (h *Health) GRPCServer() grpc_health_v1.HealthServer {
+	return h.server
+}
+
+// Handler serves /livez, which only tells the process is up, and /readyz,
+// which is 503 while the service is down, each check detailed.
+func (h *Health) Handler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, Report{Status: StatusUp, Checks: []CheckResult{}})
+	})
+	m.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := h.Report()
+		code := http.StatusOK
+		if report.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, report)
+	})
+	return m
+}
+
+func writeHealth(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type switchCheck struct{ failing atomic.Value }
+
+func newSwitchCheck() *switchCheck {
+	c := &switchCheck{}
+	c.failing.Store(false)
+	return c
+}
+
+func (c *switchCheck) set(failing bool) { c.failing.Store(failing) }
+
+func (c *switchCheck) check(context.Context) error {
+	if c.failing.Load().(bool) {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func newTestHealth(services ...string) *Health {
+	h := NewHealth(log.NewNopLogger(), services...)
+	h.interval, h.timeout = time.Hour, time.Second
+	return h
+}
+
+func dialHealth(t *testing.T, h *Health) grpc_health_v1.HealthClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, h.GRPCServer())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func readyz(t *testing.T, h *Health) (int, Report) {
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	report := Report{}
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+func TestHealthStatus(t *testing.T) {
+	mongo, cache := newSwitchCheck(), newSwitchCheck()
+	h := newTestHealth("pb.User", "pb.Admin")
+	h.Add(HealthCheck{Name: "mongo", Check: mongo.check, Critical: true, Services: []string{"pb.User"}})
+	h.Add(HealthCheck{Name: "cache", Check: cache.check})
+	client := dialHealth(t, h)
+
+	status := func(service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		res, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Status
+	}
+
+	if code, report := readyz(t, h); code != http.StatusServiceUnavailable || report.Status != StatusDown {
+		t.Fatalf("expected not ready before the first checks, got %d %s", code, report.Status)
+	}
+	if s := status(""); s != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected not serving before the first checks, got %s", s)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		mongo, cache bool
+		code         int
+		report       string
+		server, user grpc_health_v1.HealthCheckResponse_ServingStatus
+		admin        grpc_health_v1.HealthCheckResponse_ServingStatus
+		failingCheck string
+	}{
+		{"all up", false, false, http.StatusOK, StatusUp, grpc_health_v1.HealthCheckResponse_SERVING, grpc_health_v1.HealthCheckResponse_SERVING, grpc_health_v1.HealthCheckResponse_SERVING, ""},
+		{"non critical down", false, true, http.StatusOK, StatusDegraded, grpc_health_v1.HealthCheckResponse_SERVING, grpc_health_v1.HealthCheckResponse_SERVING, grpc_health_v1.HealthCheckResponse_SERVING, "cache"},
+		{"critical down", true, false, http.StatusServiceUnavailable, StatusDown, grpc_health_v1.HealthCheckResponse_NOT_SERVING, grpc_health_v1.HealthCheckResponse_NOT_SERVING, grpc_health_v1.HealthCheckResponse_SERVING, "mongo"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mongo.set(tc.mongo)
+			cache.set(tc.cache)
+			h.evaluate()
+
+			code, report := readyz(t, h)
+			if code != tc.code || report.Status != tc.report {
+				t.Fatalf("expected %d %s, got %d %s", tc.code, tc.report, code, report.Status)
+			}
+			if len(report.Checks) != 2 {
+				t.Fatalf("expected the detail of 2 checks, got %+v", report.Checks)
+			}
+			for _, check := range report.Checks {
+				failing := check.Name == tc.failingCheck
+				if failing != (check.Status == StatusDown) || failing != (check.Error != "") {
+					t.Fatalf("unexpected result %+v", check)
+				}
+			}
+			if s := status(""); s != tc.server {
+				t.Errorf("server: expected %s, got %s", tc.server, s)
+			}
+			if s := status("pb.User"); s != tc.user {
+				t.Errorf("pb.User: expected %s, got %s", tc.user, s)
+			}
+			if s := status("pb.Admin"); s != tc.admin {
+				t.Errorf("pb.Admin: expected %s, got %s", tc.admin, s)
+			}
+		})
+	}
+}
+
+func TestHealthWatch(t *testing.T) {
+	mongo := newSwitchCheck()
+	h := newTestHealth("pb.User")
+	h.Add(HealthCheck{Name: "mongo", Check: mongo.check, Critical: true})
+	h.Start()
+	client := dialHealth(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: "pb.User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(want grpc_health_v1.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != want {
+			t.Fatalf("expected %s, got %s", want, res.Status)
+		}
+	}
+	expect(grpc_health_v1.HealthCheckResponse_SERVING)
+
+	mongo.set(true)
+	h.evaluate()
+	expect(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	mongo.set(false)
+	h.evaluate()
+	expect(grpc_health_v1.HealthCheckResponse_SERVING)
+
+	h.Shutdown()
+	expect(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	if code, report := readyz(t, h); code != http.StatusServiceUnavailable || report.Status != StatusDown {
+		t.Fatalf("expected not ready once shutting down, got %d %s", code, report.Status)
+	}
+}
+
+func TestLivez(t *testing.T) {
+	h := newTestHealth()
+	h.Shutdown()
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the process to be live, got %d", w.Code)
+	}
+}
+
+func TestBreakersCheck(t *testing.T) {
+	cb := NewBreaker(gobreaker.Settings{
+		Name:        "test.Method@bufnet",
+		Timeout:     time.Hour,
+		ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures > 0 },
+	})
+	if err := BreakersCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cb.Execute(func() (interface{}, error) { return nil, errors.New("unavailable") })
+	if err := BreakersCheck(context.Background()); err == nil {
+		t.Fatal("expected an open breaker to fail the check")
+	}
+
+	// a breaker replaces the previous one of the same name
+	NewBreaker(gobreaker.Settings{Name: "test.Method@bufnet"})
+	if err := BreakersCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+// Lifecycle runs the servers of a service until one of them fails or the
+// service is asked to stop, then shuts the service down in order:
+// deregistration first, so no new requests are routed to the instance, then
+// draining the servers, then closing the connections and flushing the tracer.
+type Lifecycle struct {
+	logger       log.Logger
+	drainTimeout time.Duration
+	closeTimeout time.Duration
+
+	servers     []lifecycleServer
+	deregisters []func() error
+	onShutdown  []func()
+	closers     []lifecycleCloser
+	running     bool
+}
+
+type lifecycleServer struct {
+	name     string
+	addr     string
+	listener net.Listener
+	serve    func() error
+	shutdown func(ctx context.Context) error
+}
+
+type lifecycleCloser struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+func NewLifecycle(logger log.Logger) *Lifecycle {
+	c := config.GetLifecycleConfig()
+	return &Lifecycle{logger: logger, drainTimeout: c.DrainTimeout, closeTimeout: c.CloseTimeout}
+}
+
+// GRPC listens on addr right away, so a port in use fails the start rather
+// than a goroutine, and serves server once running.
+func (l *Lifecycle) GRPC(name, addr string, server *grpc.Server) error {
+	listener, err := l.listen(name, addr)
+	if err != nil {
+		return err
+	}
+	l.servers = append(l.servers, lifecycleServer{
+		name:     name,
+		addr:     listener.Addr().String(),
+		listener: listener,
+		serve:    func() error { return server.Serve(listener) },
+		shutdown: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				// the drain timeout is up, cut the remaining calls
+				server.Stop()
+				return ctx.Err()
+			}
+		},
+	})
+	return nil
+}
+
+// HTTP listens on addr right away, and serves handler once running.
+func (l *Lifecycle) HTTP(name, addr string, handler http.Handler) error {
+	listener, err := l.listen(name, addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler}
+	l.servers = append(l.servers, lifecycleServer{
+		name:     name,
+		addr:     listener.Addr().String(),
+		listener: listener,
+		serve: func() error {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		shutdown: func(ctx context.Context) error {
+			if err := server.Shutdown(ctx); err != nil {
+				server.Close()
+				return err
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+func (l *Lifecycle) listen(name, addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		l.logger.Log("transport", name, "during", "Listen", "err", err)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	l.logger.Log("transport", name, "addr", addr)
+	return listener, nil
+}
+
+// Register registers the instance in the registry, and deregisters it first
+// thing on shutdown.
+func (l *Lifecycle) Register(registry Registry, name string, instance ServiceInstance) error {
+	if err := registry.Register(name, instance, make(map[string]string)); err != nil {
+		return err
+	}
+	l.logger.Log("registry", "register", "service", name, "instance", instance.InstanceId)
+	l.deregisters = append(l.deregisters, func() error {
+		l.logger.Log("registry", "deregister", "service", name, "instance", instance.InstanceId)
+		return registry.Deregister(instance.InstanceId)
+	})
+	return nil
+}
+
+// OnShutdown adds a step run first thing on shutdown, along with the
+// deregistration, before the servers are drained.
+func (l *Lifecycle) OnShutdown(fn func()) {
+	l.onShutdown = append(l.onShutdown, fn)
+}
+
+// Close adds a resource to close once the servers are stopped. Resources are
+// closed in the reverse order they were added in.
+func (l *Lifecycle) Close(name string, close func(ctx context.Context) error) {
+	l.closers = append(l.closers, lifecycleCloser{name: name, close: close})
+}
+
+// Run serves until ctx is done or a server fails, then shuts the service
+// down. It returns the error of the first server which failed, if any.
+func (l *Lifecycle) Run(ctx context.Context) error {
+	l.running = true
+	g, ctx := errgroup.WithContext(ctx)
+	for _, s := range l.servers {
+		s := s
+		g.Go(func() error {
+			if err := s.serve(); err != nil {
+				return fmt.Errorf("%s: %w", s.name, err)
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		<-ctx.Done()
+		l.shutdown()
+		return nil
+	})
+	return g.Wait()
+}
+
+// Abort undoes a start failing before Run: the instances registered so far
+// are deregistered, then the listeners and the resources closed. Once Run is
+// called it does nothing, Run shuts the service down itself.
+func (l *Lifecycle) Abort() {
+	if l.running {
+		return
+	}
+	l.logger.Log("lifecycle", "aborting")
+	l.deregister()
+	for _, s := range l.servers {
+		if s.listener != nil {
+			s.listener.Close()
+		}
+	}
+	l.close()
+}
+
+func (l *Lifecycle) shutdown() {
+	l.logger.Log("lifecycle", "shutting down")
+	l.deregister()
+	for _, fn := range l.onShutdown {
+		fn()
+	}
+
+	drain, cancel := context.WithTimeout(context.Background(), l.drainTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range l.servers {
+		wg.Add(1)
+		go func(s lifecycleServer) {
+			defer wg.Done()
+			if err := s.shutdown(drain); err != nil {
+				l.logger.Log("lifecycle", "shutdown", "transport", s.name, "err", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	l.close()
+	l.logger.Log("lifecycle", "stopped")
+}
+
+func (l *Lifecycle) deregister() {
+	for _, deregister := range l.deregisters {
+		if err := deregister(); err != nil {
+			l.logger.Log("lifecycle", "deregister", "err", err)
+		}
+	}
+}
+
+// close closes the resources, in the reverse order they were added in.
+func (l *Lifecycle) close() {
+	closing, cancel := context.WithTimeout(context.Background(), l.closeTimeout)
+	defer cancel()
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		if err := l.closers[i].close(closing); err != nil {
+			l.logger.Log("lifecycle", "close", "resource", l.closers[i].name, "err", err)
+		}
+	}
+}
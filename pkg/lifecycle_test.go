@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) closer(name string) func(context.Context) error {
+	return func(context.Context) error {
+		r.record("close " + name)
+		return nil
+	}
+}
+
+type recordingRegistry struct{ *recorder }
+
+func (r recordingRegistry) Register(name string, instance ServiceInstance, _ map[string]string) error {
+	r.record("register " + instance.InstanceId)
+	return nil
+}
+
+func (r recordingRegistry) Deregister(instanceId string) error {
+	r.record("deregister " + instanceId)
+	return nil
+}
+
+func (r recordingRegistry) Instancer(string) (sd.Instancer, error) {
+	return sd.FixedInstancer{}, nil
+}
+
+func newTestLifecycle() *Lifecycle {
+	return &Lifecycle{logger: log.NewNopLogger(), drainTimeout: 2 * time.Second, closeTimeout: time.Second}
+}
+
+func TestLifecycleShutdownOrder(t *testing.T) {
+	events := &recorder{}
+	lifecycle := newTestLifecycle()
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		events.record("request done")
+	})
+	if err := lifecycle.HTTP("HTTP", "127.0.0.1:0", handler); err != nil {
+		t.Fatal(err)
+	}
+	addr := lifecycle.servers[0].addr
+	lifecycle.Close("connections", events.closer("connections"))
+	lifecycle.Close("tracer", events.closer("tracer"))
+	if err := lifecycle.Register(recordingRegistry{events}, "svc", ServiceInstance{InstanceId: "svc-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- lifecycle.Run(ctx) }()
+
+	go http.Get("http://" + addr)
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"register svc-1", "deregister svc-1", "request done", "close tracer", "close connections"}
+	if !reflect.DeepEqual(events.events, want) {
+		t.Fatalf("expected %v, got %v", want, events.events)
+	}
+}
+
+func TestLifecycleFailFast(t *testing.T) {
+	events := &recorder{}
+	lifecycle := newTestLifecycle()
+	if err := lifecycle.HTTP("HTTP", "127.0.0.1:0", http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+	if err := lifecycle.HTTP("taken", lifecycle.servers[0].addr, http.NotFoundHandler()); err == nil {
+		t.Fatal("expected listening on a port in use to fail")
+	}
+	failure := errors.New("listener died")
+	lifecycle.servers = append(lifecycle.servers, lifecycleServer{
+		name:     "broken",
+		serve:    func() error { return failure },
+		shutdown: func(context.Context) error { return nil },
+	})
+	lifecycle.Close("connections", events.closer("connections"))
+
+	done := make(chan error)
+	go func() { done <- lifecycle.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected the failure of the broken server, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return once a server failed")
+	}
+	if !reflect.DeepEqual(events.events, []string{"close connections"}) {
+		t.Fatalf("expected the service to be shut down, got %v", events.events)
+	}
+}
+
+func TestLifecycleAbort(t *testing.T) {
+	events := &recorder{}
+	lifecycle := newTestLifecycle()
+	if err := lifecycle.HTTP("HTTP", "127.0.0.1:0", http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+	lifecycle.Close("connections", events.closer("connections"))
+	registry := recordingRegistry{events}
+	if err := lifecycle.Register(registry, "svc", ServiceInstance{InstanceId: "svc-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lifecycle.Register(registry, "svc-http", ServiceInstance{InstanceId: "svc-1-http"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a later step of the start failed
+	lifecycle.Abort()
+	want := []string{"register svc-1", "register svc-1-http", "deregister svc-1", "deregister svc-1-http", "close connections"}
+	if !reflect.DeepEqual(events.events, want) {
+		t.Fatalf("expected %v, got %v", want, events.events)
+	}
+	if conn, err := net.Dial("tcp", lifecycle.servers[0].addr); err == nil {
+		conn.Close()
+		t.Fatal("expected the listener closed")
+	}
+}
+
+func TestLifecycleAbortOnceRunning(t *testing.T) {
+	events := &recorder{}
+	lifecycle := newTestLifecycle()
+	lifecycle.Close("connections", events.closer("connections"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lifecycle.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// shut down by Run already
+	lifecycle.Abort()
+	if !reflect.DeepEqual(events.events, []string{"close connections"}) {
+		t.Fatalf("expected the resources closed once, got %v", events.events)
+	}
+}
+
+func TestLifecycleGRPC(t *testing.T) {
+	lifecycle := newTestLifecycle()
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	if err := lifecycle.GRPC("gRPC", "127.0.0.1:0", server); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- lifecycle.Run(ctx) }()
+
+	conn, err := grpc.Dial(lifecycle.servers[0].addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
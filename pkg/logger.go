@@ -1,12 +1,15 @@
 package pkg
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"runtime"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	kitlogrus "github.com/go-kit/kit/log/logrus"
 	kitzap "github.com/go-kit/kit/log/zap"
 	"github.com/sirupsen/logrus"
@@ -58,9 +61,61 @@ func NewZapLogger() {
 	logger = kitzap.NewZapSugarLogger(zap.New(core), zapcore.DebugLevel)
 }
 
+// GetLogger returns the logger of the service, leveled records below the
+// level set by SetLogLevel dropped.
 func GetLogger() log.Logger {
 	_loggerOnce.Do(func() {
 		NewDefaultLogger()
+		logger = LevelFilter(logger)
 	})
 	return logger
 }
+
+var levels = map[string]int32{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// logLevel is the least level logged, debug by default
+var logLevel int32
+
+func parseLevel(name string) (int32, error) {
+	if name == "" {
+		return levels["debug"], nil
+	}
+	l, ok := levels[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q, not one of debug, info, warn, error", name)
+	}
+	return l, nil
+}
+
+// SetLogLevel sets the least level logged, debug, info, warn or error, debug
+// when empty. Records without a level are always logged.
+func SetLogLevel(name string) error {
+	l, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&logLevel, l)
+	return nil
+}
+
+// LevelFilter returns a logger dropping the leveled records below the level
+// set by SetLogLevel, and passing the others to next.
+func LevelFilter(next log.Logger) log.Logger {
+	return levelFilter{next: next}
+}
+
+type levelFilter struct {
+	next log.Logger
+}
+
+func (f levelFilter) Log(keyvals ...interface{}) error {
+	for i := 1; i < len(keyvals); i += 2 {
+		if v, ok := keyvals[i].(level.Value); ok {
+			if levels[v.String()] < atomic.LoadInt32(&logLevel) {
+				return nil
+			}
+			break
+		}
+	}
+	return f.next.Log(keyvals...)
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+// The protocols a service is called with. The instances serving gRPC are
+// registered under the name of the service, those serving another protocol
+// under the name followed by the protocol, see RegisteredName.
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+// RegisteredName returns the name the instances of service serving protocol
+// are registered under, such as addsvc for gRPC and addsvc-http for HTTP.
+func RegisteredName(service, protocol string) string {
+	if protocol == "" || protocol == ProtocolGRPC {
+		return service
+	}
+	return service + "-" + protocol
+}
+
+// Registry is where service instances register themselves, and where the
+// instances of a service are discovered from.
+type Registry interface {
+	Register(name string, instance ServiceInstance, meta map[string]string) error
+	Deregister(instanceId string) error
+	// Instancer follows the instances of a service, as host:port
+	Instancer(name string) (sd.Instancer, error)
+}
+
+// NewRegistry returns the registry backend chosen by configuration: consul,
+// static or file. The last two need no Consul agent, for local development.
+func NewRegistry(logger log.Logger) (Registry, error) {
+	c := config.GetRegistryConfig()
+	switch c.Backend {
+	case "consul":
+		return NewConsulRegistry(logger)
+	case "static":
+		return NewStaticRegistry(c.Static, logger)
+	case "file":
+		return NewFileRegistry(c.File, logger), nil
+	}
+	return nil, fmt.Errorf("unknown registry backend %q", c.Backend)
+}
+
+func (i ServiceInstance) address() string {
+	return fmt.Sprintf("%s:%d", i.InstanceHost, i.InstancePort)
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+func TestStaticRegistry(t *testing.T) {
+	registry, err := NewStaticRegistry("addsvc=localhost:9083, localhost:9183;usersvc=localhost:9093;", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	instancer, err := registry.Instancer("addsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan sd.Event, 1)
+	instancer.Register(ch)
+	if event := <-ch; !reflect.DeepEqual(event.Instances, []string{"localhost:9083", "localhost:9183"}) {
+		t.Fatalf("unexpected instances %v", event.Instances)
+	}
+	if _, err := registry.Instancer("billing"); err == nil {
+		t.Fatal("expected an error for a service without instances")
+	}
+	if _, err := NewStaticRegistry("addsvc", log.NewNopLogger()); err == nil {
+		t.Fatal("expected an error for a service without addresses")
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+	registry := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"), log.NewNopLogger())
+	defer registry.Close()
+
+	instancer, err := registry.Instancer("addsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan sd.Event, 10)
+	instancer.Register(ch)
+	defer instancer.Deregister(ch)
+	expect := func(instances ...string) {
+		t.Helper()
+		for {
+			select {
+			case event := <-ch:
+				if event.Err != nil {
+					t.Fatal(event.Err)
+				}
+				if len(event.Instances) == len(instances) && (len(instances) == 0 || reflect.DeepEqual(event.Instances, instances)) {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected instances %v", instances)
+			}
+		}
+	}
+	expect()
+
+	for _, instance := range []ServiceInstance{
+		{InstanceId: "addsvc-1", InstanceHost: "localhost", InstancePort: 9083},
+		{InstanceId: "addsvc-2", InstanceHost: "localhost", InstancePort: 9183},
+	} {
+		if err := registry.Register("addsvc", instance, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Register("usersvc", ServiceInstance{InstanceId: "usersvc-1", InstanceHost: "localhost", InstancePort: 9093}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("localhost:9083", "localhost:9183")
+
+	if err := registry.Deregister("addsvc-1"); err != nil {
+		t.Fatal(err)
+	}
+	expect("localhost:9183")
+
+	users, err := registry.Instancer("usersvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersCh := make(chan sd.Event, 1)
+	users.Register(usersCh)
+	if event := <-usersCh; !reflect.DeepEqual(event.Instances, []string{"localhost:9093"}) {
+		t.Fatalf("unexpected usersvc instances %v", event.Instances)
+	}
+}
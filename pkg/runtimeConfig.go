@@ -0,0 +1,330 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	consulapi "github.com/hashicorp/consul/api"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+// RuntimeSettings are the settings applied without restart, read from the
+// runtime configuration source, such as
+//
+//	version: "2026-10-18.1"
+//	log_level: debug
+//	endpoints:
+//	  addsvc.Sum:
+//	    limit: {rps: 10, burst: 20}
+//	    timeout: 1s
+//	    breaker: {consecutive_failures: 5, timeout: 30s}
+//
+// Endpoints missing from the settings, or settings missing from an endpoint,
+// keep the defaults of the code.
+type RuntimeSettings struct {
+	// Version is logged and exposed as a metric once applied, the hash of the
+	// content when empty
+	Version   string                      `yaml:"version"`
+	LogLevel  string                      `yaml:"log_level"`
+	Endpoints map[string]EndpointSettings `yaml:"endpoints"`
+}
+
+// EndpointSettings are the runtime settings of an endpoint, by the name the
+// Runtime middlewares were given.
+type EndpointSettings struct {
+	Limit   *LimitSettings   `yaml:"limit"`
+	Breaker *BreakerSettings `yaml:"breaker"`
+	// Timeout bounds each call, 0 for none
+	Timeout *time.Duration `yaml:"timeout"`
+}
+
+// LimitSettings is a token bucket, refilled at RPS tokens per second, 0 for
+// no limit.
+type LimitSettings struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+// BreakerSettings override the gobreaker settings of the code, those left
+// to 0 are kept.
+type BreakerSettings struct {
+	// MaxRequests is the number of calls let through while half-open
+	MaxRequests uint32 `yaml:"max_requests"`
+	// Interval is how often the failure counts are cleared while closed
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is how long the breaker stays open
+	Timeout time.Duration `yaml:"timeout"`
+	// ConsecutiveFailures is the number of failures in a row tripping the
+	// breaker
+	ConsecutiveFailures uint32 `yaml:"consecutive_failures"`
+}
+
+func (s RuntimeSettings) validate() error {
+	if _, err := parseLevel(s.LogLevel); err != nil {
+		return err
+	}
+	for name, e := range s.Endpoints {
+		if e.Limit != nil && (e.Limit.RPS < 0 || e.Limit.Burst < 0) {
+			return fmt.Errorf("endpoints.%s: limit must not be negative", name)
+		}
+		if e.Limit != nil && e.Limit.RPS > 0 && e.Limit.Burst == 0 {
+			return fmt.Errorf("endpoints.%s: a limit needs a burst of at least 1", name)
+		}
+		if e.Timeout != nil && *e.Timeout < 0 {
+			return fmt.Errorf("endpoints.%s: timeout must not be negative", name)
+		}
+		if e.Breaker != nil && (e.Breaker.Interval < 0 || e.Breaker.Timeout < 0) {
+			return fmt.Errorf("endpoints.%s: breaker durations must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// runtimeState is the applied settings, its generation telling the
+// middlewares whether they are up to date.
+type runtimeState struct {
+	generation uint64
+	settings   RuntimeSettings
+}
+
+var (
+	runtimeMu      sync.Mutex
+	runtimeCurrent atomic.Value // runtimeState
+
+	runtimeMetricsOnce sync.Once
+	runtimeVersion     metrics.Gauge
+	runtimeReloads     metrics.Counter
+)
+
+func init() {
+	runtimeCurrent.Store(runtimeState{})
+}
+
+func currentRuntime() runtimeState {
+	return runtimeCurrent.Load().(runtimeState)
+}
+
+// CurrentRuntimeSettings returns the settings applied last.
+func CurrentRuntimeSettings() RuntimeSettings {
+	return currentRuntime().settings
+}
+
+// ApplyRuntimeSettings parses and validates YAML settings, then applies
+// them, the Runtime middlewares picking them up on their next call. Invalid
+// settings are rejected, the previous ones stay.
+func ApplyRuntimeSettings(data []byte, source string, logger log.Logger) error {
+	runtimeMetricsOnce.Do(func() {
+		runtimeVersion = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "example",
+			Subsystem: "runtime_config",
+			Name:      "version_info",
+			Help:      "Applied runtime configuration version, 1 for the current one.",
+		}, []string{"version"})
+		runtimeReloads = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "runtime_config",
+			Name:      "reloads_total",
+			Help:      "Runtime configuration reloads, by result.",
+		}, []string{"result"})
+	})
+
+	settings := RuntimeSettings{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&settings)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err == nil {
+		err = settings.validate()
+	}
+	if err != nil {
+		runtimeReloads.With("result", "rejected").Add(1)
+		return fmt.Errorf("runtime config %s: %w", source, err)
+	}
+	if settings.Version == "" {
+		sum := sha256.Sum256(data)
+		settings.Version = hex.EncodeToString(sum[:])[:12]
+	}
+
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	previous := currentRuntime()
+	if previous.generation > 0 && reflect.DeepEqual(previous.settings, settings) {
+		// rewritten with the same content, or a watch firing twice
+		return nil
+	}
+	if err := SetLogLevel(settings.LogLevel); err != nil {
+		return err
+	}
+	runtimeCurrent.Store(runtimeState{generation: previous.generation + 1, settings: settings})
+	if previous.generation > 0 {
+		runtimeVersion.With("version", previous.settings.Version).Set(0)
+	}
+	runtimeVersion.With("version", settings.Version).Set(1)
+	runtimeReloads.With("result", "applied").Add(1)
+	logger.Log("runtime_config", "applied", "source", source, "version", settings.Version)
+	return nil
+}
+
+// WatchRuntimeConfig applies the runtime configuration of the configured
+// source, then follows its changes in the background until stopped. It
+// fails when the first settings read are invalid, later invalid ones are
+// only logged.
+func WatchRuntimeConfig(logger log.Logger) (stop func(ctx context.Context) error, err error) {
+	c := config.GetRuntimeConfig()
+	switch c.Source {
+	case "consul":
+		return watchRuntimeConsul(c.ConsulKey, c.ConsulWait, logger)
+	default:
+		if c.File == "" {
+			return func(context.Context) error { return nil }, nil
+		}
+		return watchRuntimeFile(c.File, logger)
+	}
+}
+
+// runtimeFileSettle is how long the runtime configuration file has to stay
+// unchanged before it is read.
+var runtimeFileSettle = 100 * time.Millisecond
+
+func watchRuntimeFile(path string, logger log.Logger) (func(ctx context.Context) error, error) {
+	apply := func() error {
+		data, err := ioutil.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// the code defaults apply, or the last settings applied
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return ApplyRuntimeSettings(data, path, logger)
+	}
+	if err := apply(); err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// the directory is watched, editors replace files rather than write them
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go func() {
+		clean := filepath.Clean(path)
+		var settle <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != clean || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				// a file written in place fires several events, truncated
+				// first, it is read once they settled
+				settle = time.After(runtimeFileSettle)
+			case <-settle:
+				settle = nil
+				if err := apply(); err != nil {
+					logger.Log("runtime_config", "file", "path", path, "err", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Log("runtime_config", "file", "path", path, "err", err)
+			}
+		}
+	}()
+	return func(context.Context) error { return watcher.Close() }, nil
+}
+
+func watchRuntimeConsul(key string, wait time.Duration, logger log.Logger) (func(ctx context.Context) error, error) {
+	consulConfig := consulapi.DefaultConfig()
+	if url := config.GetInfraConfig().CONSUL_URL; url != "" {
+		consulConfig.Address = url
+	}
+	client, err := consulapi.NewClient(consulConfig)
+	if err != nil {
+		return nil, err
+	}
+	kv := client.KV()
+	pair, meta, err := kv.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair != nil {
+		if err := ApplyRuntimeSettings(pair.Value, "consul:"+key, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		index := meta.LastIndex
+		for ctx.Err() == nil {
+			// blocking query, returns once the key changed or wait is over
+			opts := (&consulapi.QueryOptions{WaitIndex: index, WaitTime: wait}).WithContext(ctx)
+			pair, meta, err := kv.Get(key, opts)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Log("runtime_config", "consul", "key", key, "err", err)
+				}
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			if meta.LastIndex < index {
+				// the index went backwards, as after a consul restore
+				index = 0
+				continue
+			}
+			if meta.LastIndex == index {
+				continue
+			}
+			index = meta.LastIndex
+			if pair == nil {
+				continue
+			}
+			if err := ApplyRuntimeSettings(pair.Value, "consul:"+key, logger); err != nil {
+				logger.Log("runtime_config", "consul", "key", key, "err", err)
+			}
+		}
+	}()
+	return func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}, nil
+}
@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/sony/gobreaker"
+)
+
+func applyRuntime(t *testing.T, settings string) {
+	t.Helper()
+	t.Cleanup(func() {
+		runtimeMu.Lock()
+		defer runtimeMu.Unlock()
+		runtimeCurrent.Store(runtimeState{generation: currentRuntime().generation + 1})
+		SetLogLevel("")
+	})
+	if err := ApplyRuntimeSettings([]byte(settings), "test", log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nop(context.Context, interface{}) (interface{}, error) { return nil, nil }
+
+func calls(e func(context.Context, interface{}) (interface{}, error), n int) (limited int) {
+	for i := 0; i < n; i++ {
+		if _, err := e(context.Background(), nil); errors.Is(err, ratelimit.ErrLimited) {
+			limited++
+		}
+	}
+	return limited
+}
+
+func TestRuntimeLimiter(t *testing.T) {
+	e := RuntimeLimiter("test.limiter", LimitSettings{RPS: 0.001, Burst: 1})(nop)
+	if limited := calls(e, 3); limited != 2 {
+		t.Fatalf("default limit: %d calls limited, want 2", limited)
+	}
+
+	applyRuntime(t, "endpoints:\n  test.limiter:\n    limit: {rps: 0}\n")
+	if limited := calls(e, 10); limited != 0 {
+		t.Fatalf("no limit: %d calls limited", limited)
+	}
+
+	applyRuntime(t, "endpoints:\n  test.limiter:\n    limit: {rps: 0.001, burst: 3}\n")
+	if limited := calls(e, 5); limited != 2 {
+		t.Fatalf("new limit: %d calls limited, want 2", limited)
+	}
+}
+
+func TestRuntimeBreaker(t *testing.T) {
+	failure := errors.New("failure")
+	t.Cleanup(func() {
+		breakers.Lock()
+		defer breakers.Unlock()
+		delete(breakers.byName, "test.breaker")
+	})
+	e := RuntimeBreaker("test.breaker", gobreaker.Settings{Name: "test.breaker", Timeout: time.Minute})(
+		func(context.Context, interface{}) (interface{}, error) { return nil, failure },
+	)
+	// gobreaker trips after more than 5 consecutive failures
+	for i := 0; i < 5; i++ {
+		e(context.Background(), nil)
+	}
+	if _, err := e(context.Background(), nil); err != failure {
+		t.Fatalf("breaker tripped early: %v", err)
+	}
+
+	applyRuntime(t, "endpoints:\n  test.breaker:\n    breaker: {consecutive_failures: 1}\n")
+	if _, err := e(context.Background(), nil); err != failure {
+		t.Fatalf("the new breaker did not start closed: %v", err)
+	}
+	if _, err := e(context.Background(), nil); err != gobreaker.ErrOpenState {
+		t.Fatalf("breaker not tripped after a failure: %v", err)
+	}
+	if err := BreakersCheck(context.Background()); err == nil || !strings.Contains(err.Error(), "test.breaker") {
+		t.Fatalf("the new breaker is not checked: %v", err)
+	}
+}
+
+func TestRuntimeTimeout(t *testing.T) {
+	e := RuntimeTimeout("test.timeout", 0)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return nil, nil
+		}
+	})
+	applyRuntime(t, "endpoints:\n  test.timeout:\n    timeout: 10ms\n")
+	if _, err := e(context.Background(), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestApplyRuntimeSettingsRejected(t *testing.T) {
+	applyRuntime(t, "version: good\nlog_level: info\n")
+	for _, settings := range []string{
+		"version: [",
+		"version: bad\nlog_levl: info\n",
+		"version: bad\nlog_level: verbose\n",
+		"version: bad\nendpoints:\n  a:\n    limit: {rps: -1}\n",
+		"version: bad\nendpoints:\n  a:\n    timeout: -1s\n",
+	} {
+		if err := ApplyRuntimeSettings([]byte(settings), "test", log.NewNopLogger()); err == nil {
+			t.Errorf("settings %q applied", settings)
+		}
+	}
+	if version := CurrentRuntimeSettings().Version; version != "good" {
+		t.Fatalf("rejected settings replaced the previous ones, version %q", version)
+	}
+}
+
+func TestRuntimeSettingsVersion(t *testing.T) {
+	applyRuntime(t, "log_level: info\n")
+	if version := CurrentRuntimeSettings().Version; len(version) != 12 {
+		t.Fatalf("unexpected version %q of settings without one", version)
+	}
+}
+
+func TestWatchRuntimeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runtime.yaml")
+	t.Cleanup(func() {
+		runtimeMu.Lock()
+		defer runtimeMu.Unlock()
+		runtimeCurrent.Store(runtimeState{generation: currentRuntime().generation + 1})
+		SetLogLevel("")
+	})
+	// the defaults apply until the file exists
+	stop, err := watchRuntimeFile(path, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop(context.Background())
+
+	for _, version := range []string{"1", "2"} {
+		if err := ioutil.WriteFile(path, []byte("version: \""+version+"\"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for CurrentRuntimeSettings().Version != version {
+			if time.Now().After(deadline) {
+				t.Fatalf("version %s not applied", version)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// broken settings are not applied
+	if err := ioutil.WriteFile(path, []byte("version: 3\nlog_level: loud\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * runtimeFileSettle)
+	if version := CurrentRuntimeSettings().Version; version != "2" {
+		t.Fatalf("unexpected version %q", version)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := levelFilter{next: log.NewLogfmtLogger(&buf)}
+	applyRuntime(t, "log_level: warn\n")
+	level.Info(logger).Log("msg", "dropped")
+	level.Warn(logger).Log("msg", "kept")
+	logger.Log("msg", "unleveled")
+	if got := buf.String(); got != "level=warn msg=kept\nmsg=unleveled\n" {
+		t.Fatalf("unexpected logs:\n%s", got)
+	}
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/sony/gobreaker"
+	"golang.org/x/time/rate"
+)
+
+// endpointSettings returns the runtime settings of the endpoint name.
+func endpointSettings(state runtimeState, name string) EndpointSettings {
+	return state.settings.Endpoints[name]
+}
+
+// RuntimeLimiter limits the calls to the endpoints it wraps, all of them
+// sharing a bucket, at the limit the runtime settings give to name, def
+// until they give one. Calls over the limit fail with ratelimit.ErrLimited.
+func RuntimeLimiter(name string, def LimitSettings) endpoint.Middleware {
+	var (
+		mu         sync.Mutex
+		generation uint64
+		limiter    = rate.NewLimiter(limitOf(def), def.Burst)
+	)
+	allow := func() bool {
+		state := currentRuntime()
+		mu.Lock()
+		defer mu.Unlock()
+		if state.generation != generation {
+			generation = state.generation
+			settings := def
+			if s := endpointSettings(state, name).Limit; s != nil {
+				settings = *s
+			}
+			if limitOf(settings) != limiter.Limit() || settings.Burst != limiter.Burst() {
+				// a new bucket, full, the tokens of the previous one are not
+				// meaningful under a different rate
+				limiter = rate.NewLimiter(limitOf(settings), settings.Burst)
+			}
+		}
+		return limiter.Allow()
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !allow() {
+				return nil, ratelimit.ErrLimited
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func limitOf(s LimitSettings) rate.Limit {
+	if s.RPS <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(s.RPS)
+}
+
+// RuntimeBreaker guards the endpoint with a circuit breaker made of settings,
+// overridden by the breaker settings the runtime settings give to name. The
+// breaker is replaced, closed, when they change.
+func RuntimeBreaker(name string, settings gobreaker.Settings) endpoint.Middleware {
+	var (
+		mu         sync.Mutex
+		generation uint64
+		applied    *BreakerSettings
+		cb         = NewBreaker(settings)
+	)
+	current := func() *gobreaker.CircuitBreaker {
+		state := currentRuntime()
+		mu.Lock()
+		defer mu.Unlock()
+		if state.generation == generation {
+			return cb
+		}
+		generation = state.generation
+		override := endpointSettings(state, name).Breaker
+		if !reflect.DeepEqual(override, applied) {
+			applied = override
+			cb = NewBreaker(breakerSettings(settings, override))
+		}
+		return cb
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			return current().Execute(func() (interface{}, error) {
+				return next(ctx, request)
+			})
+		}
+	}
+}
+
+func breakerSettings(settings gobreaker.Settings, override *BreakerSettings) gobreaker.Settings {
+	if override == nil {
+		return settings
+	}
+	if override.MaxRequests > 0 {
+		settings.MaxRequests = override.MaxRequests
+	}
+	if override.Interval > 0 {
+		settings.Interval = override.Interval
+	}
+	if override.Timeout > 0 {
+		settings.Timeout = override.Timeout
+	}
+	if n := override.ConsecutiveFailures; n > 0 {
+		settings.ReadyToTrip = func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= n
+		}
+	}
+	return settings
+}
+
+// RuntimeTimeout bounds each call to the endpoint by the timeout the runtime
+// settings give to name, def until they give one, 0 for none.
+func RuntimeTimeout(name string, def time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			timeout := def
+			if t := endpointSettings(currentRuntime(), name).Timeout; t != nil {
+				timeout = *t
+			}
+			if timeout <= 0 {
+				return next(ctx, request)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
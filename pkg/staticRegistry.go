@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+// StaticRegistry serves a fixed list of instances per service. Registration
+// does nothing, the instances are whatever the configuration says.
+type StaticRegistry struct {
+	instances map[string][]string
+	logger    log.Logger
+}
+
+// NewStaticRegistry parses the instances of each service, written as
+// addsvc=host:port,host:port;usersvc=host:port.
+func NewStaticRegistry(static string, logger log.Logger) (*StaticRegistry, error) {
+	instances := map[string][]string{}
+	for _, service := range strings.Split(static, ";") {
+		if strings.TrimSpace(service) == "" {
+			continue
+		}
+		parts := strings.SplitN(service, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("static registry: %q is not name=host:port", service)
+		}
+		for _, addr := range strings.Split(parts[1], ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				instances[name] = append(instances[name], addr)
+			}
+		}
+	}
+	return &StaticRegistry{instances: instances, logger: logger}, nil
+}
+
+func (r *StaticRegistry) Register(name string, instance ServiceInstance, _ map[string]string) error {
+	r.logger.Log("registry", "static", "register", name, "instance", instance.InstanceId, "msg", "nothing to do")
+	return nil
+}
+
+func (r *StaticRegistry) Deregister(instanceId string) error {
+	return nil
+}
+
+func (r *StaticRegistry) Instancer(name string) (sd.Instancer, error) {
+	instances, ok := r.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("static registry: no instances of %s", name)
+	}
+	return sd.FixedInstancer(instances), nil
+}
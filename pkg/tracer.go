@@ -1,57 +1,183 @@
 package pkg
 
 import (
-	stdopentracing "github.com/opentracing/opentracing-go"
-	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
-	zipkin "github.com/openzipkin/zipkin-go"
-	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pascallin/go-kit-application/config"
 )
 
-func InitTracer(name string) (*zipkin.Tracer, stdopentracing.Tracer, error) {
-	var (
-		zipkinURL    = config.GetInfraConfig().ZIPKIN_URL
-		zipkinBridge = true
+// instrumentationName names the tracer of the services.
+const instrumentationName = "github.com/pascallin/go-kit-application"
+
+var (
+	tracerMu       sync.Mutex
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// InitTracer returns the tracer of the service, its spans sampled and sent
+// to the exporter of the tracing configuration, and installs the configured
+// propagators. The tracer provider is made by the first call, the next ones
+// share it.
+func InitTracer(service config.ServiceConfig) (trace.Tracer, error) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	if tracerProvider == nil {
+		c := config.GetTracingConfig()
+		propagator, err := NewPropagator(c.Propagators)
+		if err != nil {
+			return nil, err
+		}
+		provider, err := newTracerProvider(context.Background(), c, service)
+		if err != nil {
+			return nil, err
+		}
+		tracerProvider = provider
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}
+	return tracerProvider.Tracer(instrumentationName), nil
+}
+
+// CloseTracers flushes the spans still buffered, and shuts the exporter
+// down. It is called on shutdown.
+func CloseTracers(ctx context.Context) error {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	if tracerProvider == nil {
+		return nil
+	}
+	err := tracerProvider.Shutdown(ctx)
+	tracerProvider = nil
+	return err
+}
+
+func newTracerProvider(ctx context.Context, c config.TracingConfig, service config.ServiceConfig) (*sdktrace.TracerProvider, error) {
+	res, err := newResource(ctx, c, service)
+	if err != nil {
+		return nil, err
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler(c)),
+	}
+	exporter, err := newExporter(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	// without exporter, spans are still made for the trace context to be
+	// propagated
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// newResource describes the service the spans come from: its name and
+// instance ID, the host, the configured attributes, and those of
+// OTEL_RESOURCE_ATTRIBUTES.
+func newResource(ctx context.Context, c config.TracingConfig, service config.ServiceConfig) (*resource.Resource, error) {
+	extra, err := config.ParseAttributes(c.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	var attributes []attribute.KeyValue
+	for k, v := range extra {
+		attributes = append(attributes, attribute.String(k, v))
+	}
+	attributes = append(attributes, semconv.ServiceName(service.Name))
+	if service.HostName != "" {
+		attributes = append(attributes, semconv.ServiceInstanceID(service.HostName))
+	}
+	return resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+		resource.WithAttributes(attributes...),
 	)
-	var zipkinTracer *zipkin.Tracer
-	{
-		if zipkinURL != "" {
-			var (
-				err         error
-				hostPort    = "localhost:80"
-				serviceName = name
-				reporter    = zipkinhttp.NewReporter(zipkinURL)
-			)
-			defer reporter.Close()
-			zEP, _ := zipkin.NewEndpoint(serviceName, hostPort)
-			zipkinTracer, err = zipkin.NewTracer(reporter, zipkin.WithLocalEndpoint(zEP))
-			if err != nil {
-				log.Error("err", err)
-				return nil, nil, err
-			}
-			if !(zipkinBridge) {
-				log.WithFields(log.Fields{
-					"tracer": "Zipkin",
-					"type":   "Native",
-					"URL":    zipkinURL,
-				}).Infof("Zipkin tracer without bridge")
-			}
-		}
-	}
-	// Determine which OpenTracing tracer to use. We'll pass the tracer to all the
-	// components that use it, as a dependency.
-	var tracer stdopentracing.Tracer
-	{
-		if zipkinBridge && zipkinTracer != nil {
-			tracer = zipkinot.Wrap(zipkinTracer)
-			zipkinTracer = nil // do not instrument with both native tracer and opentracing bridge
-		} else {
-			tracer = stdopentracing.GlobalTracer() // no-op
-		}
-	}
-
-	return zipkinTracer, tracer, nil
+}
+
+// newSampler records SampleRatio of the traces, of those starting here only
+// when ParentBased, the callers deciding for theirs.
+func newSampler(c config.TracingConfig) sdktrace.Sampler {
+	sampler := sdktrace.TraceIDRatioBased(c.SampleRatio)
+	if c.ParentBased {
+		return sdktrace.ParentBased(sampler)
+	}
+	return sampler
+}
+
+func newExporter(ctx context.Context, c config.TracingConfig) (sdktrace.SpanExporter, error) {
+	switch c.Exporter {
+	case "otlp-grpc":
+		var options []otlptracegrpc.Option
+		if c.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, options...)
+	case "otlp-http":
+		var options []otlptracehttp.Option
+		if c.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	case "zipkin":
+		url := c.Endpoint
+		if url == "" {
+			url = config.GetInfraConfig().ZIPKIN_URL
+		}
+		if url == "" {
+			return nil, errors.New("tracing: the zipkin exporter needs an endpoint, or infra.zipkin_url")
+		}
+		return zipkin.New(url)
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	return nil, nil
+}
+
+// NewPropagator returns the propagator of the comma separated formats names,
+// among config.Propagators. The trace context is read from any of them, and
+// written in all of them.
+func NewPropagator(names string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "":
+		default:
+			return nil, fmt.Errorf("tracing: unknown propagator %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
 }
@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+func TestNewPropagator(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), sc)
+
+	tests := []struct {
+		names   string
+		headers []string
+	}{
+		{"tracecontext", []string{"Traceparent"}},
+		{"b3", []string{"B3"}},
+		{"b3multi", []string{"X-B3-Traceid", "X-B3-Spanid"}},
+		{"tracecontext, b3multi", []string{"Traceparent", "X-B3-Traceid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.names, func(t *testing.T) {
+			propagator, err := NewPropagator(tt.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := http.Header{}
+			propagator.Inject(ctx, propagation.HeaderCarrier(header))
+			for _, h := range tt.headers {
+				if header.Get(h) == "" {
+					t.Errorf("%s not written: %v", h, header)
+				}
+			}
+			got := trace.SpanContextFromContext(propagator.Extract(context.Background(), propagation.HeaderCarrier(header)))
+			if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+				t.Errorf("span context %v read back, want %v", got, sc)
+			}
+		})
+	}
+
+	if _, err := NewPropagator("tracecontext,jaeger"); err == nil {
+		t.Fatal("unknown propagator accepted")
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	sampled := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	tests := []struct {
+		name   string
+		config config.TracingConfig
+		ctx    context.Context
+		want   sdktrace.SamplingDecision
+	}{
+		{"ratio 0", config.TracingConfig{SampleRatio: 0}, context.Background(), sdktrace.Drop},
+		{"ratio 1", config.TracingConfig{SampleRatio: 1}, context.Background(), sdktrace.RecordAndSample},
+		{"parent sampled", config.TracingConfig{SampleRatio: 0, ParentBased: true}, sampled, sdktrace.RecordAndSample},
+		{"parent ignored", config.TracingConfig{SampleRatio: 0}, sampled, sdktrace.Drop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newSampler(tt.config).ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: tt.ctx,
+				TraceID:       trace.TraceID{3},
+				Name:          "test",
+			})
+			if result.Decision != tt.want {
+				t.Fatalf("decision %v, want %v", result.Decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	res, err := newResource(context.Background(),
+		config.TracingConfig{Attributes: "deployment.environment=test"},
+		config.ServiceConfig{Name: "addsvc", HostName: "addsvc-1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := map[string]string{}
+	for _, kv := range res.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.Emit()
+	}
+	for k, v := range map[string]string{
+		"service.name":           "addsvc",
+		"service.instance.id":    "addsvc-1",
+		"deployment.environment": "test",
+	} {
+		if attributes[k] != v {
+			t.Errorf("attribute %s is %q, want %q", k, attributes[k], v)
+		}
+	}
+}
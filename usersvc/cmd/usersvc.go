@@ -2,66 +2,101 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/conn"
 	"github.com/pascallin/go-kit-application/pkg"
 	"github.com/pascallin/go-kit-application/usersvc"
 )
 
 func main() {
+	// startup aborts on an invalid configuration
+	err := config.Load("usersvc", config.NewUsersvcTree(), flag.CommandLine, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 	logger := pkg.GetLogger()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(); err != nil {
+	// run blocks until the interrupt signal, or a server failure
+	if err := run(ctx); err != nil {
 		log.Fatal(err)
 	}
 
-	// Listen for the interrupt signal.
-	<-ctx.Done()
-
 	logger.Log("service", "exiting")
 }
 
-func run() error {
+func run(ctx context.Context) error {
 	c := config.GetUserSvcConfig()
 	logger := pkg.GetLogger()
+	lifecycle := pkg.NewLifecycle(logger)
+	// undoes what was started if run fails before the servers run
+	defer lifecycle.Abort()
+	// closed last, after the servers are drained
+	lifecycle.Close("connections", conn.Close)
+	lifecycle.Close("tracer", pkg.CloseTracers)
+	// limits, breakers, timeouts and the log level follow the runtime
+	// configuration from now on
+	stopRuntime, err := pkg.WatchRuntimeConfig(logger)
+	if err != nil {
+		return err
+	}
+	lifecycle.Close("runtime config", stopRuntime)
+
+	service, err := usersvc.NewService(logger)
+	if err != nil {
+		return err
+	}
+	health := usersvc.NewHealth(logger)
+	// not serving anymore as soon as the shutdown starts
+	lifecycle.OnShutdown(health.Shutdown)
+	grpcServer, err := usersvc.NewGrpcServer(service, health, logger)
+	if err != nil {
+		return err
+	}
+
+	if err := lifecycle.HTTP("debug", fmt.Sprintf(":%d", c.DebugPort), pkg.DebugHandler(health)); err != nil {
+		return err
+	}
+	if err := lifecycle.GRPC("gRPC", fmt.Sprintf(":%d", c.GrpcPort), grpcServer); err != nil {
+		return err
+	}
+	httpHandler, err := usersvc.NewHttpHandler(service, logger)
+	if err != nil {
+		return err
+	}
+	if err := lifecycle.HTTP("HTTP", fmt.Sprintf(":%d", c.HttpPort), httpHandler); err != nil {
+		return err
+	}
 
+	// registered once listening, deregistered first on shutdown
 	if c.IsNeedDiscovery {
-		client, err := pkg.NewKitDiscoverClient()
+		registry, err := pkg.NewRegistry(logger)
 		if err != nil {
 			return err
 		}
-		status := client.Register(c.Name, pkg.ServiceInstance{
+		err = lifecycle.Register(registry, c.Name, pkg.ServiceInstance{
 			InstanceId:   c.HostName,
 			InstanceHost: c.Host,
 			InstancePort: c.GrpcPort,
-		}, make(map[string]string))
-		logger.Log("consul discovery register ", status)
-		defer client.Deregister(c.Name)
-	}
-
-	go func() {
-		if err := pkg.StartDebugServer(c.DebugPort, logger); err != nil {
-			logger.Log(err.Error())
-		}
-	}()
-
-	go func() {
-		if err := usersvc.GrpcServe(logger); err != nil {
-			logger.Log(err.Error())
-		}
-	}()
-
-	go func() {
-		if err := usersvc.HttpServe(logger); err != nil {
-			logger.Log(err.Error())
+		})
+		if err != nil {
+			return err
 		}
-	}()
+	}
 
-	return nil
+	health.Start()
+	return lifecycle.Run(ctx)
 }
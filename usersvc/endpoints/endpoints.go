@@ -4,112 +4,284 @@ import (
 	"context"
 
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/tracing/opentracing"
-	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/log"
-	stdopentracing "github.com/opentracing/opentracing-go"
-	stdzipkin "github.com/openzipkin/zipkin-go"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/usersvc/model"
 	"github.com/pascallin/go-kit-application/usersvc/services"
 )
 
+// Permissions declares the permission each protected endpoint requires, the
+// endpoints not listed here are public. The requests implementing
+// middleware.Subject need no permission when sent by the user they name.
+var Permissions = middleware.Authorize{
+	"GrantRole":     model.PermUserAdmin,
+	"RevokeRole":    model.PermUserAdmin,
+	"GetUser":       model.PermUserRead,
+	"ListUsers":     model.PermUserRead,
+	"UpdateProfile": model.PermUserWrite,
+	"DeleteUser":    model.PermUserWrite,
+	"UnlockUser":    model.PermUserAdmin,
+	// users enroll themselves, it only takes a valid token
+	"EnrollMFA":  "",
+	"ConfirmMFA": "",
+}
+
 type EndpointSet struct {
-	RegisterEndpoint       endpoint.Endpoint
-	LoginEndpoint          endpoint.Endpoint
-	UpdatePasswordEndpoint endpoint.Endpoint
-	ValidTokenEndpoint     endpoint.Endpoint
+	RegisterEndpoint             endpoint.Endpoint
+	LoginEndpoint                endpoint.Endpoint
+	UpdatePasswordEndpoint       endpoint.Endpoint
+	ValidTokenEndpoint           endpoint.Endpoint
+	RefreshEndpoint              endpoint.Endpoint
+	LogoutEndpoint               endpoint.Endpoint
+	GrantRoleEndpoint            endpoint.Endpoint
+	RevokeRoleEndpoint           endpoint.Endpoint
+	GetUserEndpoint              endpoint.Endpoint
+	ListUsersEndpoint            endpoint.Endpoint
+	UpdateProfileEndpoint        endpoint.Endpoint
+	DeleteUserEndpoint           endpoint.Endpoint
+	UnlockUserEndpoint           endpoint.Endpoint
+	EnrollMFAEndpoint            endpoint.Endpoint
+	ConfirmMFAEndpoint           endpoint.Endpoint
+	VerifyMFAEndpoint            endpoint.Endpoint
+	RequestPasswordResetEndpoint endpoint.Endpoint
+	ResetPasswordEndpoint        endpoint.Endpoint
+	VerifyEmailEndpoint          endpoint.Endpoint
+	ClaimsEndpoint               endpoint.Endpoint
+	JWKSEndpoint                 endpoint.Endpoint
 }
 
-func New(svc services.Service, logger log.Logger, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer) EndpointSet {
-	var registerEndpoint, loginEndpoint, updatePasswordEndpoint, validEndpoint endpoint.Endpoint
+// New returns the endpoints of the gRPC and HTTP servers, wired with the
+// permissions of Permissions, the logging, tracing and metrics middlewares.
+// The metrics are expected to be labelled by transport already.
+func New(svc services.Service, logger log.Logger, m middleware.EndpointMetrics, tracer trace.Tracer) EndpointSet {
+	var registerEndpoint, loginEndpoint, updatePasswordEndpoint, validEndpoint, refreshEndpoint, logoutEndpoint endpoint.Endpoint
+	var grantRoleEndpoint, revokeRoleEndpoint endpoint.Endpoint
+	var getUserEndpoint, listUsersEndpoint, updateProfileEndpoint, deleteUserEndpoint, unlockUserEndpoint endpoint.Endpoint
+	var enrollMFAEndpoint, confirmMFAEndpoint, verifyMFAEndpoint endpoint.Endpoint
+	var requestPasswordResetEndpoint, resetPasswordEndpoint, verifyEmailEndpoint endpoint.Endpoint
+	var claimsEndpoint, jwksEndpoint endpoint.Endpoint
 	{
 		registerEndpoint = MakeRegisterEndpoint(svc)
-		registerEndpoint = LoggingMiddleware(log.With(logger, "method", "Register"))(registerEndpoint)
-		registerEndpoint = opentracing.TraceServer(otTracer, "Register")(registerEndpoint)
-		if zipkinTracer != nil {
-			registerEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Register")(registerEndpoint)
-		}
+		registerEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Register"))(registerEndpoint)
+		registerEndpoint = middleware.TraceEndpoint(tracer, "Register")(registerEndpoint)
+		registerEndpoint = middleware.InstrumentingMiddleware(m, "Register")(registerEndpoint)
 	}
 	{
-		loginEndpoint = makeLoginEndpoint(svc)
-		loginEndpoint = LoggingMiddleware(log.With(logger, "method", "Login"))(loginEndpoint)
-		loginEndpoint = opentracing.TraceServer(otTracer, "Login")(loginEndpoint)
-		if zipkinTracer != nil {
-			loginEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Login")(loginEndpoint)
-		}
+		loginEndpoint = MakeLoginEndpoint(svc)
+		loginEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Login"))(loginEndpoint)
+		loginEndpoint = middleware.TraceEndpoint(tracer, "Login")(loginEndpoint)
+		loginEndpoint = middleware.InstrumentingMiddleware(m, "Login")(loginEndpoint)
 	}
 	{
-		updatePasswordEndpoint = makeUpdatePasswordEndpoint(svc)
-		updatePasswordEndpoint = LoggingMiddleware(log.With(logger, "method", "UpdatePassword"))(updatePasswordEndpoint)
-		updatePasswordEndpoint = opentracing.TraceServer(otTracer, "UpdatePassword")(updatePasswordEndpoint)
-		if zipkinTracer != nil {
-			updatePasswordEndpoint = zipkin.TraceEndpoint(zipkinTracer, "UpdatePassword")(updatePasswordEndpoint)
-		}
+		updatePasswordEndpoint = MakeUpdatePasswordEndpoint(svc)
+		updatePasswordEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "UpdatePassword"))(updatePasswordEndpoint)
+		updatePasswordEndpoint = middleware.TraceEndpoint(tracer, "UpdatePassword")(updatePasswordEndpoint)
+		updatePasswordEndpoint = middleware.InstrumentingMiddleware(m, "UpdatePassword")(updatePasswordEndpoint)
 	}
 	{
-		validEndpoint = makeValidTokenEndpoint(svc)
-		validEndpoint = LoggingMiddleware(log.With(logger, "method", "valid token"))(validEndpoint)
-		validEndpoint = opentracing.TraceServer(otTracer, "AuthTokenValid")(validEndpoint)
-		if zipkinTracer != nil {
-			validEndpoint = zipkin.TraceEndpoint(zipkinTracer, "AuthTokenValid")(validEndpoint)
-		}
+		validEndpoint = MakeValidTokenEndpoint(svc)
+		validEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "valid token"))(validEndpoint)
+		validEndpoint = middleware.TraceEndpoint(tracer, "AuthTokenValid")(validEndpoint)
+		validEndpoint = middleware.InstrumentingMiddleware(m, "AuthTokenValid")(validEndpoint)
+	}
+	{
+		refreshEndpoint = MakeRefreshEndpoint(svc)
+		refreshEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Refresh"))(refreshEndpoint)
+		refreshEndpoint = middleware.TraceEndpoint(tracer, "Refresh")(refreshEndpoint)
+		refreshEndpoint = middleware.InstrumentingMiddleware(m, "Refresh")(refreshEndpoint)
+	}
+	{
+		logoutEndpoint = MakeLogoutEndpoint(svc)
+		logoutEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Logout"))(logoutEndpoint)
+		logoutEndpoint = middleware.TraceEndpoint(tracer, "Logout")(logoutEndpoint)
+		logoutEndpoint = middleware.InstrumentingMiddleware(m, "Logout")(logoutEndpoint)
+	}
+	{
+		grantRoleEndpoint = MakeGrantRoleEndpoint(svc)
+		grantRoleEndpoint = Permissions.Middleware("GrantRole", svc.AuthService.Claims)(grantRoleEndpoint)
+		grantRoleEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "GrantRole"))(grantRoleEndpoint)
+		grantRoleEndpoint = middleware.TraceEndpoint(tracer, "GrantRole")(grantRoleEndpoint)
+		grantRoleEndpoint = middleware.InstrumentingMiddleware(m, "GrantRole")(grantRoleEndpoint)
+	}
+	{
+		revokeRoleEndpoint = MakeRevokeRoleEndpoint(svc)
+		revokeRoleEndpoint = Permissions.Middleware("RevokeRole", svc.AuthService.Claims)(revokeRoleEndpoint)
+		revokeRoleEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "RevokeRole"))(revokeRoleEndpoint)
+		revokeRoleEndpoint = middleware.TraceEndpoint(tracer, "RevokeRole")(revokeRoleEndpoint)
+		revokeRoleEndpoint = middleware.InstrumentingMiddleware(m, "RevokeRole")(revokeRoleEndpoint)
+	}
+	{
+		getUserEndpoint = MakeGetUserEndpoint(svc)
+		getUserEndpoint = Permissions.Middleware("GetUser", svc.AuthService.Claims)(getUserEndpoint)
+		getUserEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "GetUser"))(getUserEndpoint)
+		getUserEndpoint = middleware.TraceEndpoint(tracer, "GetUser")(getUserEndpoint)
+		getUserEndpoint = middleware.InstrumentingMiddleware(m, "GetUser")(getUserEndpoint)
+	}
+	{
+		listUsersEndpoint = MakeListUsersEndpoint(svc)
+		listUsersEndpoint = Permissions.Middleware("ListUsers", svc.AuthService.Claims)(listUsersEndpoint)
+		listUsersEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "ListUsers"))(listUsersEndpoint)
+		listUsersEndpoint = middleware.TraceEndpoint(tracer, "ListUsers")(listUsersEndpoint)
+		listUsersEndpoint = middleware.InstrumentingMiddleware(m, "ListUsers")(listUsersEndpoint)
+	}
+	{
+		updateProfileEndpoint = MakeUpdateProfileEndpoint(svc)
+		updateProfileEndpoint = Permissions.Middleware("UpdateProfile", svc.AuthService.Claims)(updateProfileEndpoint)
+		updateProfileEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "UpdateProfile"))(updateProfileEndpoint)
+		updateProfileEndpoint = middleware.TraceEndpoint(tracer, "UpdateProfile")(updateProfileEndpoint)
+		updateProfileEndpoint = middleware.InstrumentingMiddleware(m, "UpdateProfile")(updateProfileEndpoint)
+	}
+	{
+		deleteUserEndpoint = MakeDeleteUserEndpoint(svc)
+		deleteUserEndpoint = Permissions.Middleware("DeleteUser", svc.AuthService.Claims)(deleteUserEndpoint)
+		deleteUserEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "DeleteUser"))(deleteUserEndpoint)
+		deleteUserEndpoint = middleware.TraceEndpoint(tracer, "DeleteUser")(deleteUserEndpoint)
+		deleteUserEndpoint = middleware.InstrumentingMiddleware(m, "DeleteUser")(deleteUserEndpoint)
+	}
+	{
+		unlockUserEndpoint = MakeUnlockUserEndpoint(svc)
+		unlockUserEndpoint = Permissions.Middleware("UnlockUser", svc.AuthService.Claims)(unlockUserEndpoint)
+		unlockUserEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "UnlockUser"))(unlockUserEndpoint)
+		unlockUserEndpoint = middleware.TraceEndpoint(tracer, "UnlockUser")(unlockUserEndpoint)
+		unlockUserEndpoint = middleware.InstrumentingMiddleware(m, "UnlockUser")(unlockUserEndpoint)
+	}
+	{
+		enrollMFAEndpoint = MakeEnrollMFAEndpoint(svc)
+		enrollMFAEndpoint = Permissions.Middleware("EnrollMFA", svc.AuthService.Claims)(enrollMFAEndpoint)
+		enrollMFAEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "EnrollMFA"))(enrollMFAEndpoint)
+		enrollMFAEndpoint = middleware.TraceEndpoint(tracer, "EnrollMFA")(enrollMFAEndpoint)
+		enrollMFAEndpoint = middleware.InstrumentingMiddleware(m, "EnrollMFA")(enrollMFAEndpoint)
+	}
+	{
+		confirmMFAEndpoint = MakeConfirmMFAEndpoint(svc)
+		confirmMFAEndpoint = Permissions.Middleware("ConfirmMFA", svc.AuthService.Claims)(confirmMFAEndpoint)
+		confirmMFAEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "ConfirmMFA"))(confirmMFAEndpoint)
+		confirmMFAEndpoint = middleware.TraceEndpoint(tracer, "ConfirmMFA")(confirmMFAEndpoint)
+		confirmMFAEndpoint = middleware.InstrumentingMiddleware(m, "ConfirmMFA")(confirmMFAEndpoint)
+	}
+	{
+		verifyMFAEndpoint = MakeVerifyMFAEndpoint(svc)
+		verifyMFAEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "VerifyMFA"))(verifyMFAEndpoint)
+		verifyMFAEndpoint = middleware.TraceEndpoint(tracer, "VerifyMFA")(verifyMFAEndpoint)
+		verifyMFAEndpoint = middleware.InstrumentingMiddleware(m, "VerifyMFA")(verifyMFAEndpoint)
+	}
+	{
+		requestPasswordResetEndpoint = MakeRequestPasswordResetEndpoint(svc)
+		requestPasswordResetEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "RequestPasswordReset"))(requestPasswordResetEndpoint)
+		requestPasswordResetEndpoint = middleware.TraceEndpoint(tracer, "RequestPasswordReset")(requestPasswordResetEndpoint)
+		requestPasswordResetEndpoint = middleware.InstrumentingMiddleware(m, "RequestPasswordReset")(requestPasswordResetEndpoint)
+	}
+	{
+		resetPasswordEndpoint = MakeResetPasswordEndpoint(svc)
+		resetPasswordEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "ResetPassword"))(resetPasswordEndpoint)
+		resetPasswordEndpoint = middleware.TraceEndpoint(tracer, "ResetPassword")(resetPasswordEndpoint)
+		resetPasswordEndpoint = middleware.InstrumentingMiddleware(m, "ResetPassword")(resetPasswordEndpoint)
+	}
+	{
+		verifyEmailEndpoint = MakeVerifyEmailEndpoint(svc)
+		verifyEmailEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "VerifyEmail"))(verifyEmailEndpoint)
+		verifyEmailEndpoint = middleware.TraceEndpoint(tracer, "VerifyEmail")(verifyEmailEndpoint)
+		verifyEmailEndpoint = middleware.InstrumentingMiddleware(m, "VerifyEmail")(verifyEmailEndpoint)
+	}
+	{
+		claimsEndpoint = MakeClaimsEndpoint(svc)
+		claimsEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "Claims"))(claimsEndpoint)
+		claimsEndpoint = middleware.TraceEndpoint(tracer, "Claims")(claimsEndpoint)
+		claimsEndpoint = middleware.InstrumentingMiddleware(m, "Claims")(claimsEndpoint)
+	}
+	{
+		jwksEndpoint = MakeJWKSEndpoint(svc)
+		jwksEndpoint = middleware.LoggingMiddleware(log.With(logger, "method", "JWKS"))(jwksEndpoint)
+		jwksEndpoint = middleware.TraceEndpoint(tracer, "JWKS")(jwksEndpoint)
+		jwksEndpoint = middleware.InstrumentingMiddleware(m, "JWKS")(jwksEndpoint)
 	}
 	return EndpointSet{
-		RegisterEndpoint:       registerEndpoint,
-		LoginEndpoint:          loginEndpoint,
-		UpdatePasswordEndpoint: updatePasswordEndpoint,
-		ValidTokenEndpoint:     validEndpoint,
+		RegisterEndpoint:             registerEndpoint,
+		LoginEndpoint:                loginEndpoint,
+		UpdatePasswordEndpoint:       updatePasswordEndpoint,
+		ValidTokenEndpoint:           validEndpoint,
+		RefreshEndpoint:              refreshEndpoint,
+		LogoutEndpoint:               logoutEndpoint,
+		GrantRoleEndpoint:            grantRoleEndpoint,
+		RevokeRoleEndpoint:           revokeRoleEndpoint,
+		GetUserEndpoint:              getUserEndpoint,
+		ListUsersEndpoint:            listUsersEndpoint,
+		UpdateProfileEndpoint:        updateProfileEndpoint,
+		DeleteUserEndpoint:           deleteUserEndpoint,
+		UnlockUserEndpoint:           unlockUserEndpoint,
+		EnrollMFAEndpoint:            enrollMFAEndpoint,
+		ConfirmMFAEndpoint:           confirmMFAEndpoint,
+		VerifyMFAEndpoint:            verifyMFAEndpoint,
+		RequestPasswordResetEndpoint: requestPasswordResetEndpoint,
+		ResetPasswordEndpoint:        resetPasswordEndpoint,
+		VerifyEmailEndpoint:          verifyEmailEndpoint,
+		ClaimsEndpoint:               claimsEndpoint,
+		JWKSEndpoint:                 jwksEndpoint,
 	}
 }
 
 // swagger:parameters RegisterRequest
 type RegisterRequest struct {
-	Username, Password, Nickname string
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Nickname string `json:"nickname"`
+	// Email is optional, a verification link is sent to it
+	Email string `json:"email"`
 }
 
 // swagger:parameters RegisterResponse
 type RegisterResponse struct {
-	Id  string
-	Err string
+	Id  string `json:"id"`
+	Err error  `json:"-"`
 }
 
 func MakeRegisterEndpoint(s services.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(RegisterRequest)
-		id, err := s.UserService.Register(ctx, req.Username, req.Password, req.Nickname)
+		id, err := s.UserService.Register(ctx, req.Username, req.Password, req.Nickname, req.Email)
 		if err != nil {
-			return RegisterResponse{Id: "", Err: err.Error()}, nil
+			return RegisterResponse{Id: "", Err: err}, nil
 		}
-		return RegisterResponse{Id: id.String(), Err: ""}, nil
+		return RegisterResponse{Id: id.Hex(), Err: nil}, nil
 	}
 }
 
 type LoginRequest struct {
-	Username, Password string
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type LoginResponse struct {
-	Token string
-	Err   error
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at,omitempty"`
+	// MFAChallenge is returned instead of the tokens to users with MFA
+	// enabled, to be sent to VerifyMFA along with a code
+	MFAChallenge string `json:"mfa_challenge,omitempty"`
+	Err          error  `json:"-"`
 }
 
-func makeLoginEndpoint(s services.Service) endpoint.Endpoint {
+func MakeLoginEndpoint(s services.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(LoginRequest)
-		token, err := s.UserService.Login(ctx, req.Username, req.Password)
-		return LoginResponse{Token: token, Err: err}, nil
+		tokens, err := s.UserService.Login(ctx, req.Username, req.Password)
+		return LoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, ExpiresAt: tokens.ExpiresAt, MFAChallenge: tokens.MFAChallenge, Err: err}, nil
 	}
 }
 
 type UpdatePasswordRequest struct {
-	Username, Password, NewPassword string
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
 }
 
 type UpdatePasswordResponse struct {
-	Err error
+	Err error `json:"-"`
 }
 
-func makeUpdatePasswordEndpoint(s services.Service) endpoint.Endpoint {
+func MakeUpdatePasswordEndpoint(s services.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(UpdatePasswordRequest)
 		err = s.UserService.UpdatePassword(ctx, req.Username, req.Password, req.NewPassword)
@@ -118,18 +290,408 @@ func makeUpdatePasswordEndpoint(s services.Service) endpoint.Endpoint {
 }
 
 type ValidTokenEndpointRequest struct {
-	Token string
+	Token string `json:"token"`
 }
 
 type ValidTokenEndpointResponse struct {
-	IsValid bool
-	Err     error
+	IsValid bool  `json:"is_valid"`
+	Err     error `json:"-"`
 }
 
-func makeValidTokenEndpoint(s services.Service) endpoint.Endpoint {
+func MakeValidTokenEndpoint(s services.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(ValidTokenEndpointRequest)
 		isValid, err := s.AuthService.Valid(ctx, req.Token)
 		return ValidTokenEndpointResponse{Err: err, IsValid: isValid}, nil
 	}
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Err          error  `json:"-"`
+}
+
+func MakeRefreshEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RefreshRequest)
+		tokens, err := s.UserService.Refresh(ctx, req.RefreshToken)
+		return RefreshResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, ExpiresAt: tokens.ExpiresAt, Err: err}, nil
+	}
+}
+
+type LogoutRequest struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeLogoutEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(LogoutRequest)
+		err = s.AuthService.Logout(ctx, req.Token, req.RefreshToken)
+		return LogoutResponse{Err: err}, nil
+	}
+}
+
+type ClaimsRequest struct {
+	Token string `json:"token"`
+}
+
+type ClaimsResponse struct {
+	Claims *model.CustomerClaims `json:"claims,omitempty"`
+	Err    error                 `json:"-"`
+}
+
+func MakeClaimsEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ClaimsRequest)
+		claims, err := s.AuthService.Claims(ctx, req.Token)
+		return ClaimsResponse{Claims: claims, Err: err}, nil
+	}
+}
+
+type JWKSRequest struct{}
+
+type JWKSResponse struct {
+	Keys []model.JWK `json:"keys"`
+	Err  error       `json:"-"`
+}
+
+func MakeJWKSEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		jwks, err := s.AuthService.JWKS(ctx)
+		return JWKSResponse{Keys: jwks.Keys, Err: err}, nil
+	}
+}
+
+type RoleRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type RoleResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeGrantRoleEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RoleRequest)
+		err = s.UserService.GrantRole(ctx, req.Username, req.Role)
+		return RoleResponse{Err: err}, nil
+	}
+}
+
+func MakeRevokeRoleEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RoleRequest)
+		err = s.UserService.RevokeRole(ctx, req.Username, req.Role)
+		return RoleResponse{Err: err}, nil
+	}
+}
+
+type GetUserRequest struct {
+	Username string `json:"username"`
+}
+
+// Subject implements middleware.Subject, users read their own profile.
+func (r GetUserRequest) Subject() string { return r.Username }
+
+type GetUserResponse struct {
+	User model.User `json:"user"`
+	Err  error      `json:"-"`
+}
+
+func MakeGetUserEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(GetUserRequest)
+		user, err := s.UserService.GetUser(ctx, req.Username)
+		return GetUserResponse{User: user, Err: err}, nil
+	}
+}
+
+type ListUsersRequest struct {
+	Cursor         string `json:"cursor"`
+	Limit          int    `json:"limit"`
+	UsernamePrefix string `json:"username_prefix"`
+	SortBy         string `json:"sort_by"`
+	Descending     bool   `json:"descending"`
+}
+
+type ListUsersResponse struct {
+	Users      []model.User `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	Err        error        `json:"-"`
+}
+
+func MakeListUsersEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ListUsersRequest)
+		page, err := s.UserService.ListUsers(ctx, model.ListUsersQuery{
+			Cursor:         req.Cursor,
+			Limit:          req.Limit,
+			UsernamePrefix: req.UsernamePrefix,
+			SortBy:         req.SortBy,
+			Descending:     req.Descending,
+		})
+		return ListUsersResponse{Users: page.Users, NextCursor: page.NextCursor, Err: err}, nil
+	}
+}
+
+type UpdateProfileRequest struct {
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+}
+
+// Subject implements middleware.Subject, users update their own profile.
+func (r UpdateProfileRequest) Subject() string { return r.Username }
+
+type UpdateProfileResponse struct {
+	User model.User `json:"user"`
+	Err  error      `json:"-"`
+}
+
+func MakeUpdateProfileEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UpdateProfileRequest)
+		user, err := s.UserService.UpdateProfile(ctx, req.Username, req.Nickname)
+		return UpdateProfileResponse{User: user, Err: err}, nil
+	}
+}
+
+type DeleteUserRequest struct {
+	Username string `json:"username"`
+}
+
+type DeleteUserResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeDeleteUserEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DeleteUserRequest)
+		err = s.UserService.DeleteUser(ctx, req.Username)
+		return DeleteUserResponse{Err: err}, nil
+	}
+}
+
+type UnlockUserRequest struct {
+	Username string `json:"username"`
+}
+
+type UnlockUserResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeUnlockUserEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UnlockUserRequest)
+		err = s.UserService.UnlockUser(ctx, req.Username)
+		return UnlockUserResponse{Err: err}, nil
+	}
+}
+
+type EnrollMFARequest struct{}
+
+type EnrollMFAResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	Err    error  `json:"-"`
+}
+
+// MakeEnrollMFAEndpoint enrolls the caller, as authenticated by the token.
+func MakeEnrollMFAEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		claims, ok := middleware.ClaimsFromContext(ctx)
+		if !ok {
+			return nil, middleware.ErrUnauthenticated
+		}
+		enrollment, err := s.UserService.EnrollMFA(ctx, claims.Username)
+		return EnrollMFAResponse{Secret: enrollment.Secret, URI: enrollment.URI, Err: err}, nil
+	}
+}
+
+type ConfirmMFARequest struct {
+	Code string `json:"code"`
+}
+
+type ConfirmMFAResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Err           error    `json:"-"`
+}
+
+// MakeConfirmMFAEndpoint confirms the enrollment of the caller, as
+// authenticated by the token.
+func MakeConfirmMFAEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ConfirmMFARequest)
+		claims, ok := middleware.ClaimsFromContext(ctx)
+		if !ok {
+			return nil, middleware.ErrUnauthenticated
+		}
+		codes, err := s.UserService.ConfirmMFA(ctx, claims.Username, req.Code)
+		return ConfirmMFAResponse{RecoveryCodes: codes, Err: err}, nil
+	}
+}
+
+type VerifyMFARequest struct {
+	MFAChallenge string `json:"mfa_challenge"`
+	// Code is a TOTP code or one of the recovery codes
+	Code string `json:"code"`
+}
+
+type VerifyMFAResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Err          error  `json:"-"`
+}
+
+func MakeVerifyMFAEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(VerifyMFARequest)
+		tokens, err := s.UserService.VerifyMFA(ctx, req.MFAChallenge, req.Code)
+		return VerifyMFAResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, ExpiresAt: tokens.ExpiresAt, Err: err}, nil
+	}
+}
+
+type RequestPasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type RequestPasswordResetResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeRequestPasswordResetEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RequestPasswordResetRequest)
+		err = s.UserService.RequestPasswordReset(ctx, req.Email)
+		return RequestPasswordResetResponse{Err: err}, nil
+	}
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ResetPasswordResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeResetPasswordEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ResetPasswordRequest)
+		err = s.UserService.ResetPassword(ctx, req.Token, req.NewPassword)
+		return ResetPasswordResponse{Err: err}, nil
+	}
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type VerifyEmailResponse struct {
+	Err error `json:"-"`
+}
+
+func MakeVerifyEmailEndpoint(s services.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(VerifyEmailRequest)
+		err = s.UserService.VerifyEmail(ctx, req.Token)
+		return VerifyEmailResponse{Err: err}, nil
+	}
+}
+
+// compile time assertions for our response types implementing endpoint.Failer.
+var (
+	_ endpoint.Failer = RegisterResponse{}
+	_ endpoint.Failer = LoginResponse{}
+	_ endpoint.Failer = UpdatePasswordResponse{}
+	_ endpoint.Failer = ValidTokenEndpointResponse{}
+	_ endpoint.Failer = RefreshResponse{}
+	_ endpoint.Failer = LogoutResponse{}
+	_ endpoint.Failer = ClaimsResponse{}
+	_ endpoint.Failer = JWKSResponse{}
+	_ endpoint.Failer = RoleResponse{}
+	_ endpoint.Failer = GetUserResponse{}
+	_ endpoint.Failer = ListUsersResponse{}
+	_ endpoint.Failer = UpdateProfileResponse{}
+	_ endpoint.Failer = DeleteUserResponse{}
+	_ endpoint.Failer = UnlockUserResponse{}
+	_ endpoint.Failer = EnrollMFAResponse{}
+	_ endpoint.Failer = ConfirmMFAResponse{}
+	_ endpoint.Failer = VerifyMFAResponse{}
+	_ endpoint.Failer = RequestPasswordResetResponse{}
+	_ endpoint.Failer = ResetPasswordResponse{}
+	_ endpoint.Failer = VerifyEmailResponse{}
+)
+
+// Failed implements endpoint.Failer.
+func (r RegisterResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r LoginResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r UpdatePasswordResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r ValidTokenEndpointResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r RefreshResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r LogoutResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r ClaimsResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r JWKSResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r RoleResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r GetUserResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r ListUsersResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r UpdateProfileResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r DeleteUserResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r UnlockUserResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r EnrollMFAResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r ConfirmMFAResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r VerifyMFAResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r RequestPasswordResetResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r ResetPasswordResponse) Failed() error { return r.Err }
+
+// Failed implements endpoint.Failer.
+func (r VerifyEmailResponse) Failed() error { return r.Err }
@@ -0,0 +1,239 @@
+package endpoints
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+// EndpointSet implements both IUserService and IAuthService by invoking its
+// endpoints, so a set of client endpoints can be used as a services.Service.
+var (
+	_ services.IUserService = EndpointSet{}
+	_ services.IAuthService = EndpointSet{}
+)
+
+// Service returns the set as a services.Service.
+func (s EndpointSet) Service() services.Service {
+	return services.NewService(s, s)
+}
+
+// Register implements services.IUserService.
+func (s EndpointSet) Register(ctx context.Context, username, password, nickname, email string) (primitive.ObjectID, error) {
+	resp, err := s.RegisterEndpoint(ctx, RegisterRequest{Username: username, Password: password, Nickname: nickname, Email: email})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	response := resp.(RegisterResponse)
+	if response.Err != nil {
+		return primitive.NilObjectID, response.Err
+	}
+	return primitive.ObjectIDFromHex(response.Id)
+}
+
+// Login implements services.IUserService.
+func (s EndpointSet) Login(ctx context.Context, username string, password string) (model.TokenPair, error) {
+	resp, err := s.LoginEndpoint(ctx, LoginRequest{Username: username, Password: password})
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	response := resp.(LoginResponse)
+	return model.TokenPair{
+		AccessToken:  response.Token,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    response.ExpiresAt,
+		MFAChallenge: response.MFAChallenge,
+	}, response.Err
+}
+
+// Refresh implements services.IUserService.
+func (s EndpointSet) Refresh(ctx context.Context, refreshToken string) (model.TokenPair, error) {
+	resp, err := s.RefreshEndpoint(ctx, RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	response := resp.(RefreshResponse)
+	return model.TokenPair{AccessToken: response.Token, RefreshToken: response.RefreshToken, ExpiresAt: response.ExpiresAt}, response.Err
+}
+
+// UpdatePassword implements services.IUserService.
+func (s EndpointSet) UpdatePassword(ctx context.Context, username, password, newPassword string) error {
+	resp, err := s.UpdatePasswordEndpoint(ctx, UpdatePasswordRequest{Username: username, Password: password, NewPassword: newPassword})
+	if err != nil {
+		return err
+	}
+	return resp.(UpdatePasswordResponse).Err
+}
+
+// GrantRole implements services.IUserService.
+func (s EndpointSet) GrantRole(ctx context.Context, username, role string) error {
+	resp, err := s.GrantRoleEndpoint(ctx, RoleRequest{Username: username, Role: role})
+	if err != nil {
+		return err
+	}
+	return resp.(RoleResponse).Err
+}
+
+// RevokeRole implements services.IUserService.
+func (s EndpointSet) RevokeRole(ctx context.Context, username, role string) error {
+	resp, err := s.RevokeRoleEndpoint(ctx, RoleRequest{Username: username, Role: role})
+	if err != nil {
+		return err
+	}
+	return resp.(RoleResponse).Err
+}
+
+// GetUser implements services.IUserService.
+func (s EndpointSet) GetUser(ctx context.Context, username string) (model.User, error) {
+	resp, err := s.GetUserEndpoint(ctx, GetUserRequest{Username: username})
+	if err != nil {
+		return model.User{}, err
+	}
+	response := resp.(GetUserResponse)
+	return response.User, response.Err
+}
+
+// ListUsers implements services.IUserService.
+func (s EndpointSet) ListUsers(ctx context.Context, query model.ListUsersQuery) (model.UserPage, error) {
+	resp, err := s.ListUsersEndpoint(ctx, ListUsersRequest{
+		Cursor:         query.Cursor,
+		Limit:          query.Limit,
+		UsernamePrefix: query.UsernamePrefix,
+		SortBy:         query.SortBy,
+		Descending:     query.Descending,
+	})
+	if err != nil {
+		return model.UserPage{}, err
+	}
+	response := resp.(ListUsersResponse)
+	return model.UserPage{Users: response.Users, NextCursor: response.NextCursor}, response.Err
+}
+
+// UpdateProfile implements services.IUserService.
+func (s EndpointSet) UpdateProfile(ctx context.Context, username, nickname string) (model.User, error) {
+	resp, err := s.UpdateProfileEndpoint(ctx, UpdateProfileRequest{Username: username, Nickname: nickname})
+	if err != nil {
+		return model.User{}, err
+	}
+	response := resp.(UpdateProfileResponse)
+	return response.User, response.Err
+}
+
+// DeleteUser implements services.IUserService.
+func (s EndpointSet) DeleteUser(ctx context.Context, username string) error {
+	resp, err := s.DeleteUserEndpoint(ctx, DeleteUserRequest{Username: username})
+	if err != nil {
+		return err
+	}
+	return resp.(DeleteUserResponse).Err
+}
+
+// UnlockUser implements services.IUserService.
+func (s EndpointSet) UnlockUser(ctx context.Context, username string) error {
+	resp, err := s.UnlockUserEndpoint(ctx, UnlockUserRequest{Username: username})
+	if err != nil {
+		return err
+	}
+	return resp.(UnlockUserResponse).Err
+}
+
+// EnrollMFA implements services.IUserService. The endpoint enrolls the user
+// authenticated by the token in ctx, username is not sent.
+func (s EndpointSet) EnrollMFA(ctx context.Context, username string) (model.MFAEnrollment, error) {
+	resp, err := s.EnrollMFAEndpoint(ctx, EnrollMFARequest{})
+	if err != nil {
+		return model.MFAEnrollment{}, err
+	}
+	response := resp.(EnrollMFAResponse)
+	return model.MFAEnrollment{Secret: response.Secret, URI: response.URI}, response.Err
+}
+
+// ConfirmMFA implements services.IUserService. Like EnrollMFA, it acts on the
+// user authenticated by the token in ctx.
+func (s EndpointSet) ConfirmMFA(ctx context.Context, username, code string) ([]string, error) {
+	resp, err := s.ConfirmMFAEndpoint(ctx, ConfirmMFARequest{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(ConfirmMFAResponse)
+	return response.RecoveryCodes, response.Err
+}
+
+// VerifyMFA implements services.IUserService.
+func (s EndpointSet) VerifyMFA(ctx context.Context, challenge, code string) (model.TokenPair, error) {
+	resp, err := s.VerifyMFAEndpoint(ctx, VerifyMFARequest{MFAChallenge: challenge, Code: code})
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	response := resp.(VerifyMFAResponse)
+	return model.TokenPair{AccessToken: response.Token, RefreshToken: response.RefreshToken, ExpiresAt: response.ExpiresAt}, response.Err
+}
+
+// RequestPasswordReset implements services.IUserService.
+func (s EndpointSet) RequestPasswordReset(ctx context.Context, email string) error {
+	resp, err := s.RequestPasswordResetEndpoint(ctx, RequestPasswordResetRequest{Email: email})
+	if err != nil {
+		return err
+	}
+	return resp.(RequestPasswordResetResponse).Err
+}
+
+// ResetPassword implements services.IUserService.
+func (s EndpointSet) ResetPassword(ctx context.Context, token, newPassword string) error {
+	resp, err := s.ResetPasswordEndpoint(ctx, ResetPasswordRequest{Token: token, NewPassword: newPassword})
+	if err != nil {
+		return err
+	}
+	return resp.(ResetPasswordResponse).Err
+}
+
+// VerifyEmail implements services.IUserService.
+func (s EndpointSet) VerifyEmail(ctx context.Context, token string) error {
+	resp, err := s.VerifyEmailEndpoint(ctx, VerifyEmailRequest{Token: token})
+	if err != nil {
+		return err
+	}
+	return resp.(VerifyEmailResponse).Err
+}
+
+// Valid implements services.IAuthService.
+func (s EndpointSet) Valid(ctx context.Context, token string) (bool, error) {
+	resp, err := s.ValidTokenEndpoint(ctx, ValidTokenEndpointRequest{Token: token})
+	if err != nil {
+		return false, err
+	}
+	response := resp.(ValidTokenEndpointResponse)
+	return response.IsValid, response.Err
+}
+
+// Claims implements services.IAuthService.
+func (s EndpointSet) Claims(ctx context.Context, token string) (*model.CustomerClaims, error) {
+	resp, err := s.ClaimsEndpoint(ctx, ClaimsRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	response := resp.(ClaimsResponse)
+	return response.Claims, response.Err
+}
+
+// Logout implements services.IAuthService.
+func (s EndpointSet) Logout(ctx context.Context, token, refreshToken string) error {
+	resp, err := s.LogoutEndpoint(ctx, LogoutRequest{Token: token, RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+	return resp.(LogoutResponse).Err
+}
+
+// JWKS implements services.IAuthService.
+func (s EndpointSet) JWKS(ctx context.Context) (model.JWKS, error) {
+	resp, err := s.JWKSEndpoint(ctx, JWKSRequest{})
+	if err != nil {
+		return model.JWKS{}, err
+	}
+	response := resp.(JWKSResponse)
+	return model.JWKS{Keys: response.Keys}, response.Err
+}
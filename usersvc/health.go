@@ -1,36 +1,18 @@
 package usersvc
 
 import (
-	"context"
-	"encoding/json"
-	"net/http"
+	"github.com/go-kit/kit/log"
 
-	"github.com/gorilla/mux"
-	"google.golang.org/grpc/health/grpc_health_v1"
+	"github.com/pascallin/go-kit-application/conn"
+	pb "github.com/pascallin/go-kit-application/pb/usersvc"
+	"github.com/pascallin/go-kit-application/pkg"
 )
 
-type GrpcHealthChecker struct{}
-
-func NewGrpHealthChecker() *GrpcHealthChecker {
-	return &GrpcHealthChecker{}
-}
-
-func (s *GrpcHealthChecker) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
-	return &grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
-	}, nil
-}
-
-func (h *GrpcHealthChecker) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
-	return nil
-}
-
-func NewHttpHealthCheckerHandler() http.Handler {
-	r := mux.NewRouter()
-	r.HandleFunc("/health", healthCheckHandler).Methods("GET")
-	return r
-}
-
-func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+// NewHealth returns the health of usersvc, which cannot serve without MongoDB
+// for the users, nor Redis for the tokens and the login throttling.
+func NewHealth(logger log.Logger) *pkg.Health {
+	health := pkg.NewHealth(logger, pb.User_ServiceDesc.ServiceName)
+	health.Add(pkg.HealthCheck{Name: "mongo", Check: conn.PingMongo, Critical: true})
+	health.Add(pkg.HealthCheck{Name: "redis", Check: conn.PingRedis, Critical: true})
+	return health
 }
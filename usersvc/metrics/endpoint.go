@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/middleware"
+)
+
+var (
+	_endpointMetrics *middleware.EndpointMetrics
+)
+
+// GetEndpointMetrics returns the RED metrics of the usersvc endpoints, their
+// duration histogram bucketed after the metrics configuration.
+func GetEndpointMetrics() middleware.EndpointMetrics {
+	if _endpointMetrics != nil {
+		return *_endpointMetrics
+	}
+	c := config.GetUserSvcConfig()
+	// Endpoint-level metrics.
+	m := middleware.NewEndpointMetrics(c.Name, config.GetMetricsConfig().DurationBuckets)
+	_endpointMetrics = &m
+
+	return m
+}
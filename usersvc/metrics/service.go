@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+var (
+	_serviceMetrics *services.Metrics
+	_mongoMetrics   metrics.Histogram
+)
+
+// GetServiceMetrics returns the business metrics of usersvc, recorded by
+// services.InstrumentingMiddleware.
+func GetServiceMetrics() services.Metrics {
+	if _serviceMetrics != nil {
+		return *_serviceMetrics
+	}
+	c := config.GetUserSvcConfig()
+	// Business-level metrics.
+	m := services.Metrics{
+		Registrations: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: c.Name,
+			Name:      "registrations_total",
+			Help:      "Total count of users registered.",
+		}, []string{}),
+		Logins: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: c.Name,
+			Name:      "logins_total",
+			Help:      "Total count of logins, by outcome and failure reason.",
+		}, []string{"outcome", "reason"}),
+		PasswordChanges: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: c.Name,
+			Name:      "password_changes_total",
+			Help:      "Total count of passwords changed, updated or reset.",
+		}, []string{"method"}),
+		TokenValidations: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: c.Name,
+			Name:      "token_validations_total",
+			Help:      "Total count of access tokens validated, by result.",
+		}, []string{"method", "result"}),
+	}
+	_serviceMetrics = &m
+
+	return m
+}
+
+// GetMongoMetrics returns the duration histogram of the MongoDB commands of
+// usersvc, bucketed after the metrics configuration.
+func GetMongoMetrics() metrics.Histogram {
+	if _mongoMetrics != nil {
+		return _mongoMetrics
+	}
+	c := config.GetUserSvcConfig()
+	_mongoMetrics = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "example",
+		Subsystem: c.Name,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command duration in seconds.",
+		Buckets:   config.GetMetricsConfig().DurationBuckets,
+	}, []string{"command", "outcome"})
+
+	return _mongoMetrics
+}
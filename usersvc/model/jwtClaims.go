@@ -4,7 +4,31 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	// MFAChallenge tokens prove the password step of a login, they are only
+	// exchanged for tokens along with a valid MFA code
+	MFAChallenge = "mfa"
+)
+
 type CustomerClaims struct {
 	Username string `json:"username"`
+	// TokenType tells access, refresh and MFA challenge tokens apart
+	TokenType string `json:"token_type,omitempty"`
+	// Family groups the refresh tokens rotated from the same login
+	Family      string   `json:"family,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.StandardClaims
 }
+
+// HasPermission reports whether the token grants permission.
+func (c CustomerClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
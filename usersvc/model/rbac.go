@@ -0,0 +1,50 @@
+package model
+
+import "sort"
+
+// Permissions checked by the endpoint authorization middleware.
+const (
+	PermUserRead  = "user:read"
+	PermUserWrite = "user:write"
+	PermUserAdmin = "user:admin"
+	PermAddsvcUse = "addsvc:use"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Roles maps every known role to the permissions it grants.
+var Roles = map[string][]string{
+	RoleAdmin: {PermUserRead, PermUserWrite, PermUserAdmin, PermAddsvcUse},
+	// users read and update their own profile without any permission
+	RoleUser: {PermAddsvcUse},
+}
+
+// Identity is who a token is issued to, with the authorizations it carries.
+type Identity struct {
+	Username    string
+	Roles       []string
+	Permissions []string
+}
+
+// EffectivePermissions returns the sorted union of the permissions granted by
+// roles and the directly granted permissions.
+func EffectivePermissions(roles, permissions []string) []string {
+	set := make(map[string]struct{})
+	for _, role := range roles {
+		for _, p := range Roles[role] {
+			set[p] = struct{}{}
+		}
+	}
+	for _, p := range permissions {
+		set[p] = struct{}{}
+	}
+	effective := make([]string, 0, len(set))
+	for p := range set {
+		effective = append(effective, p)
+	}
+	sort.Strings(effective)
+	return effective
+}
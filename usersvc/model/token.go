@@ -0,0 +1,20 @@
+package model
+
+// TokenPair is what a successful login or refresh hands out.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresAt is the access token expiry, in unix seconds
+	ExpiresAt int64 `json:"expires_at"`
+	// MFAChallenge is set instead of the tokens when the user has MFA
+	// enabled, the login is completed by VerifyMFA
+	MFAChallenge string `json:"mfa_challenge,omitempty"`
+}
+
+// MFAEnrollment is the secret of a pending MFA enrollment, to be added to an
+// authenticator app.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI of the secret, usually shown as a QR code
+	URI string `json:"uri"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// User is the public view of a user account, it never carries credentials.
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+	Email    string `json:"email,omitempty"`
+	// EmailVerified is whether the user proved owning Email
+	EmailVerified bool      `json:"email_verified"`
+	Roles         []string  `json:"roles"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Sort orders of ListUsers.
+const (
+	SortByUsername  = "username"
+	SortByCreatedAt = "created_at"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ListUsersQuery selects a page of users. Cursor is the NextCursor of the
+// previous page, and must be used with the same filter and sort order.
+type ListUsersQuery struct {
+	Cursor         string
+	Limit          int
+	UsernamePrefix string
+	SortBy         string
+	Descending     bool
+}
+
+// UserPage is a page of ListUsers. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// passwordResetTimeout bounds the lookup and the email of a password reset
+// request, done once the request has returned.
+const passwordResetTimeout = 30 * time.Second
+
+// RequestPasswordReset emails a password reset link to the user owning email.
+// The email is looked up and sent in the background, and nothing but an
+// invalid address is reported, so that neither the response nor its time
+// tell who has an account.
+func (s UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		// the request is over by the time this runs, its context with it
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetTimeout)
+		defer cancel()
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			level.Error(s.logger).Log("method", "RequestPasswordReset", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (s UserService) sendPasswordReset(ctx context.Context, email string) error {
+	var user User
+	err := s.db.Collection("users").FindOne(ctx, bson.M{"email": email, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		level.Debug(s.logger).Log("method", "RequestPasswordReset", "msg", "unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.accounts.Issue(ctx, PurposePasswordReset, user.Username, email)
+	if err != nil {
+		return err
+	}
+	return s.notifier.Notify(ctx, Notification{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to choose a new password:\n%s\n\nIf you did not ask for it, ignore this email, your password is unchanged.\n",
+			user.Username, s.accounts.Link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets the password of the user a reset token was issued for.
+// The new password is checked against the policy before the token is used, so
+// a rejected password can be corrected with the same link. The token can only
+// be used once, and the lockout of the user is lifted.
+func (s UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	found, err := s.accounts.Lookup(ctx, PurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+	user, err := s.findUserByUserName(ctx, found.Username)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return ErrInvalidAccountToken
+	}
+	if err := s.policy.Validate("new_password", user.Username, newPassword); err != nil {
+		return err
+	}
+	if s.reusedPassword(user, newPassword) {
+		return reusedPasswordError("new_password")
+	}
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return ErrUpdatePasswordFailed
+	}
+
+	redeemed, err := s.accounts.Redeem(ctx, PurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Collection("users").UpdateOne(ctx,
+		activeUser(redeemed.Username),
+		s.passwordUpdate(user, hashed),
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidAccountToken
+	}
+	if err := s.guard.Unlock(ctx, redeemed.Username); err != nil {
+		level.Error(s.logger).Log("method", "ResetPassword", "during", "unlock", "err", err)
+	}
+	// whoever knew the old password is logged out
+	if err := s.tokens.RevokeUser(ctx, redeemed.Username); err != nil {
+		level.Error(s.logger).Log("method", "ResetPassword", "during", "revoke tokens", "err", err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the email a verification token was sent to as verified,
+// provided it is still the email of the user.
+func (s UserService) VerifyEmail(ctx context.Context, token string) error {
+	redeemed, err := s.accounts.Redeem(ctx, PurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	filter := activeUser(redeemed.Username)
+	filter["email"] = redeemed.Email
+	result, err := s.db.Collection("users").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidAccountToken
+	}
+	return nil
+}
+
+func (s UserService) sendEmailVerification(ctx context.Context, username, email string) error {
+	token, err := s.accounts.Issue(ctx, PurposeEmailVerification, username, email)
+	if err != nil {
+		return err
+	}
+	return s.notifier.Notify(ctx, Notification{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to verify your email address:\n%s\n",
+			username, s.accounts.Link("/verify-email", token)),
+	})
+}
+
+// normalizeEmail accepts a bare address only, so it is safe to put in mail
+// headers, and lower cases it so lookups are case insensitive.
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+var ErrInvalidAccountToken = pkg.NewError(pkg.KindInvalidArgument, "invalid_account_token", "invalid or expired token")
+
+// Purposes of account tokens, a token is only valid for the purpose it was
+// issued for.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+// accountToken is an emailed token as stored in Mongo. Only the hash of the
+// token is stored, so a database leak does not leak usable tokens.
+type accountToken struct {
+	Hash      string     `bson:"hash"`
+	Purpose   string     `bson:"purpose"`
+	Username  string     `bson:"username"`
+	Email     string     `bson:"email"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+// AccountTokens issues and redeems the single-use, expiring tokens sent by
+// email to reset a password or verify an email address.
+type AccountTokens struct {
+	db         *mongo.Database
+	accountURL string
+	ttl        map[string]time.Duration
+}
+
+func NewAccountTokens(db *mongo.Database, c config.AccountConfig) *AccountTokens {
+	return &AccountTokens{
+		db:         db,
+		accountURL: c.AccountURL,
+		ttl: map[string]time.Duration{
+			PurposePasswordReset:     c.ResetTokenTTL,
+			PurposeEmailVerification: c.VerifyTokenTTL,
+		},
+	}
+}
+
+func NewAccountTokensFromConfig(db *mongo.Database) *AccountTokens {
+	return NewAccountTokens(db, config.GetAccountConfig())
+}
+
+func (a *AccountTokens) collection() *mongo.Collection {
+	return a.db.Collection("account_tokens")
+}
+
+// Issue returns a new token for purpose, bound to the user and its email.
+func (a *AccountTokens) Issue(ctx context.Context, purpose, username, email string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	_, err := a.collection().InsertOne(ctx, accountToken{
+		Hash:      hashAccountToken(token),
+		Purpose:   purpose,
+		Username:  username,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.ttl[purpose]),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Lookup returns what a valid token was issued for, without using it, so the
+// request can be validated before the token is spent.
+func (a *AccountTokens) Lookup(ctx context.Context, purpose, token string) (accountToken, error) {
+	var found accountToken
+	err := a.collection().FindOne(ctx, bson.M{
+		"hash":       hashAccountToken(token),
+		"purpose":    purpose,
+		"expires_at": bson.M{"$gt": time.Now()},
+		"used_at":    bson.M{"$exists": false},
+	}).Decode(&found)
+	if err == mongo.ErrNoDocuments {
+		return accountToken{}, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return accountToken{}, err
+	}
+	return found, nil
+}
+
+// Redeem marks a token used and returns what it was issued for. Tokens that
+// are unknown, expired, already used or issued for another purpose give
+// ErrInvalidAccountToken.
+func (a *AccountTokens) Redeem(ctx context.Context, purpose, token string) (accountToken, error) {
+	now := time.Now()
+	var redeemed accountToken
+	err := a.collection().FindOneAndUpdate(ctx,
+		bson.M{
+			"hash":       hashAccountToken(token),
+			"purpose":    purpose,
+			"expires_at": bson.M{"$gt": now},
+			"used_at":    bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&redeemed)
+	if err == mongo.ErrNoDocuments {
+		return accountToken{}, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return accountToken{}, err
+	}
+	return redeemed, nil
+}
+
+// Link returns the front end URL handling token at path.
+func (a *AccountTokens) Link(path, token string) string {
+	return a.accountURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
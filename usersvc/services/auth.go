@@ -2,50 +2,62 @@ package services
 
 import (
 	"context"
-	"errors"
 
 	"github.com/go-kit/log"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/pascallin/go-kit-application/config"
+	"github.com/go-kit/log/level"
+
+	"github.com/pascallin/go-kit-application/pkg"
 	"github.com/pascallin/go-kit-application/usersvc/model"
 )
 
 var (
-	ErrSignMethod   = errors.New("unexpected signing method")
-	ErrInvalidToken = errors.New("invalid token")
+	ErrSignMethod   = pkg.NewError(pkg.KindUnauthenticated, "unexpected_signing_method", "unexpected signing method")
+	ErrInvalidToken = pkg.NewError(pkg.KindUnauthenticated, "invalid_token", "invalid token")
 )
 
 type IAuthService interface {
 	Valid(ctx context.Context, token string) (bool, error)
+	Claims(ctx context.Context, token string) (*model.CustomerClaims, error)
+	Logout(ctx context.Context, token, refreshToken string) error
+	JWKS(ctx context.Context) (model.JWKS, error)
 }
 
 type AuthService struct {
+	tokens *TokenManager
+	keys   *KeySet
 	logger log.Logger
 }
 
-func NewAuthService(logger log.Logger) IAuthService {
+func NewAuthService(tokens *TokenManager, keys *KeySet, logger log.Logger) IAuthService {
 	return AuthService{
+		tokens: tokens,
+		keys:   keys,
 		logger: logger,
 	}
 }
 
 func (s AuthService) Valid(ctx context.Context, tokenStr string) (bool, error) {
-	s.logger.Log("tokenStr", tokenStr)
-
-	tokenClaims, err := jwt.ParseWithClaims(tokenStr, &model.CustomerClaims{}, func(token *jwt.Token) (i interface{}, e error) {
-		// if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		// 	return nil, ErrSignMethod
-		// }
-		return []byte(config.GetAppSecretConfig().JwtSecret), nil
-	})
+	claim, err := s.tokens.Validate(ctx, tokenStr)
 	if err != nil {
 		return false, err
 	}
+	level.Debug(s.logger).Log("username", claim.Username, "jti", claim.Id)
+	return true, nil
+}
 
-	if claim, ok := tokenClaims.Claims.(*model.CustomerClaims); ok && tokenClaims.Valid {
-		s.logger.Log("token", tokenStr, "claim", claim)
-		return true, nil
-	} else {
-		return false, ErrInvalidToken
-	}
+// Claims validates an access token like Valid, and returns what it carries.
+func (s AuthService) Claims(ctx context.Context, tokenStr string) (*model.CustomerClaims, error) {
+	return s.tokens.Validate(ctx, tokenStr)
+}
+
+// Logout revokes the access token, and the refresh token family if a refresh
+// token is given, so neither can be used again.
+func (s AuthService) Logout(ctx context.Context, token, refreshToken string) error {
+	return s.tokens.Revoke(ctx, token, refreshToken)
+}
+
+// JWKS returns the public keys tokens can be verified with, so other services
+// do not need to hold any signing secret.
+func (s AuthService) JWKS(_ context.Context) (model.JWKS, error) {
+	return s.keys.JWKS(), nil
 }
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/metrics"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+// Metrics are the business metrics of the user service.
+type Metrics struct {
+	// Registrations counts the users registered
+	Registrations metrics.Counter
+	// Logins counts the logins by outcome, success, mfa_challenge or
+	// failure, and by reason, the code of the error of the failures
+	Logins metrics.Counter
+	// PasswordChanges counts the passwords changed, by method
+	PasswordChanges metrics.Counter
+	// TokenValidations counts the access tokens validated, by method and
+	// result, valid, invalid or the code of the error
+	TokenValidations metrics.Counter
+}
+
+// Middleware describes a service (as opposed to endpoint) middleware.
+type Middleware func(Service) Service
+
+// InstrumentingMiddleware returns a service Middleware recording the business
+// events of the user and auth services in m.
+func InstrumentingMiddleware(m Metrics) Middleware {
+	return func(next Service) Service {
+		return Service{
+			UserService: userInstrumentingMiddleware{IUserService: next.UserService, m: m},
+			AuthService: authInstrumentingMiddleware{IAuthService: next.AuthService, m: m},
+		}
+	}
+}
+
+// userInstrumentingMiddleware records the methods it overrides, the others
+// are those of the IUserService it wraps.
+type userInstrumentingMiddleware struct {
+	IUserService
+	m Metrics
+}
+
+func (mw userInstrumentingMiddleware) Register(ctx context.Context, username, password, nickname, email string) (primitive.ObjectID, error) {
+	id, err := mw.IUserService.Register(ctx, username, password, nickname, email)
+	if err == nil {
+		mw.m.Registrations.Add(1)
+	}
+	return id, err
+}
+
+func (mw userInstrumentingMiddleware) Login(ctx context.Context, username, password string) (model.TokenPair, error) {
+	pair, err := mw.IUserService.Login(ctx, username, password)
+	mw.login(pair, err)
+	return pair, err
+}
+
+// VerifyMFA completes the logins which ended with an MFA challenge.
+func (mw userInstrumentingMiddleware) VerifyMFA(ctx context.Context, challenge, code string) (model.TokenPair, error) {
+	pair, err := mw.IUserService.VerifyMFA(ctx, challenge, code)
+	mw.login(pair, err)
+	return pair, err
+}
+
+func (mw userInstrumentingMiddleware) login(pair model.TokenPair, err error) {
+	outcome, reason := "success", "none"
+	switch {
+	case err != nil:
+		outcome, reason = "failure", pkg.ErrorOf(err).Code
+	case pair.MFAChallenge != "":
+		outcome = "mfa_challenge"
+	}
+	mw.m.Logins.With("outcome", outcome, "reason", reason).Add(1)
+}
+
+func (mw userInstrumentingMiddleware) UpdatePassword(ctx context.Context, username, password, newPassword string) error {
+	err := mw.IUserService.UpdatePassword(ctx, username, password, newPassword)
+	if err == nil {
+		mw.m.PasswordChanges.With("method", "update").Add(1)
+	}
+	return err
+}
+
+func (mw userInstrumentingMiddleware) ResetPassword(ctx context.Context, token, newPassword string) error {
+	err := mw.IUserService.ResetPassword(ctx, token, newPassword)
+	if err == nil {
+		mw.m.PasswordChanges.With("method", "reset").Add(1)
+	}
+	return err
+}
+
+// authInstrumentingMiddleware records the methods it overrides, the others
+// are those of the IAuthService it wraps.
+type authInstrumentingMiddleware struct {
+	IAuthService
+	m Metrics
+}
+
+func (mw authInstrumentingMiddleware) Valid(ctx context.Context, token string) (bool, error) {
+	ok, err := mw.IAuthService.Valid(ctx, token)
+	result := "valid"
+	if !ok {
+		result = "invalid"
+	}
+	mw.validation("Valid", result, err)
+	return ok, err
+}
+
+func (mw authInstrumentingMiddleware) Claims(ctx context.Context, token string) (*model.CustomerClaims, error) {
+	claims, err := mw.IAuthService.Claims(ctx, token)
+	mw.validation("Claims", "valid", err)
+	return claims, err
+}
+
+func (mw authInstrumentingMiddleware) validation(method, result string, err error) {
+	if err != nil {
+		result = pkg.ErrorOf(err).Code
+	}
+	mw.m.TokenValidations.With("method", method, "result", result).Add(1)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+// fakeLoginService answers the logins of alice with tokens, those of bob with
+// an MFA challenge, and fails the others.
+type fakeLoginService struct {
+	IUserService
+}
+
+func (fakeLoginService) Login(_ context.Context, username, _ string) (model.TokenPair, error) {
+	switch username {
+	case "alice":
+		return model.TokenPair{AccessToken: "token"}, nil
+	case "bob":
+		return model.TokenPair{MFAChallenge: "challenge"}, nil
+	case "locked":
+		return model.TokenPair{}, ErrAccountLocked
+	}
+	return model.TokenPair{}, ErrWrongUsernameOrPassword
+}
+
+type fakeValidService struct {
+	IAuthService
+}
+
+func (fakeValidService) Claims(_ context.Context, token string) (*model.CustomerClaims, error) {
+	if token == "revoked" {
+		return nil, ErrTokenRevoked
+	}
+	return &model.CustomerClaims{}, nil
+}
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	logins := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "logins_total"}, []string{"outcome", "reason"})
+	validations := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "token_validations_total"}, []string{"method", "result"})
+	svc := InstrumentingMiddleware(Metrics{
+		Logins:           prometheus.NewCounter(logins),
+		TokenValidations: prometheus.NewCounter(validations),
+	})(Service{UserService: fakeLoginService{}, AuthService: fakeValidService{}})
+
+	ctx := context.Background()
+	for _, username := range []string{"alice", "alice", "bob", "locked", "mallory"} {
+		svc.UserService.Login(ctx, username, "secret")
+	}
+	for _, token := range []string{"token", "revoked"} {
+		svc.AuthService.Claims(ctx, token)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		collector stdprometheus.Collector
+		want      float64
+	}{
+		{"logins", logins.WithLabelValues("success", "none"), 2},
+		{"mfa challenges", logins.WithLabelValues("mfa_challenge", "none"), 1},
+		{"locked accounts", logins.WithLabelValues("failure", "account_locked"), 1},
+		{"wrong passwords", logins.WithLabelValues("failure", "wrong_username_or_password"), 1},
+		{"valid tokens", validations.WithLabelValues("Claims", "valid"), 1},
+		{"revoked tokens", validations.WithLabelValues("Claims", "token_revoked"), 1},
+	} {
+		if got := testutil.ToFloat64(tc.collector); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+var (
+	ErrNoSigningKey   = errors.New("no signing key")
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrUnsupportedKey = errors.New("unsupported signing key")
+)
+
+// AllowedAlgorithms are the only JWT algorithms tokens may be signed with.
+// Symmetric algorithms and "none" are never accepted.
+var AllowedAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// SigningKey is an asymmetric key of the KeySet, identified by the kid
+// header of the tokens it signs.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Signer crypto.Signer
+	// RetiredAt is when the key stopped signing. Retired keys still verify
+	// tokens until the overlap window has passed.
+	RetiredAt time.Time
+}
+
+// KeySet holds the active signing key and the retired keys still accepted
+// for verification. Keys are loaded from the PEM files of a directory, the
+// last one in file name order being the active key, or generated in memory
+// when no directory is configured.
+type KeySet struct {
+	mu        sync.RWMutex
+	dir       string
+	algorithm string
+	overlap   time.Duration
+	active    *SigningKey
+	keys      map[string]*SigningKey
+	stop      chan struct{}
+}
+
+func NewKeySet(dir, algorithm string, overlap time.Duration) (*KeySet, error) {
+	ks := &KeySet{
+		dir:       dir,
+		algorithm: algorithm,
+		overlap:   overlap,
+		keys:      make(map[string]*SigningKey),
+	}
+	if err := ks.Rotate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewKeySetFromConfig returns the KeySet configured by the JWT_* environment
+// variables, rotating on the configured schedule.
+func NewKeySetFromConfig(logger log.Logger) (*KeySet, error) {
+	c := config.GetAppSecretConfig()
+	ks, err := NewKeySet(c.JwtKeysDir, c.JwtAlgorithm, c.JwtKeyOverlap)
+	if err != nil {
+		return nil, err
+	}
+	if c.JwtKeysDir == "" {
+		level.Warn(logger).Log("keyset", "memory", "msg", "JWT_KEYS_DIR is not set, signing keys are generated and not shared between instances")
+	}
+	if c.JwtKeyRotation > 0 {
+		ks.StartRotation(c.JwtKeyRotation, logger)
+	}
+	return ks, nil
+}
+
+// Rotate reloads the key directory, or generates a new key if there is none.
+// A previously active key is retired, as is a key removed from the
+// directory, and retired keys past the overlap window are dropped.
+func (ks *KeySet) Rotate() error {
+	var (
+		loaded []*SigningKey
+		err    error
+	)
+	if ks.dir != "" {
+		loaded, err = loadSigningKeys(ks.dir)
+	} else {
+		var key *SigningKey
+		key, err = generateSigningKey(ks.algorithm)
+		loaded = []*SigningKey{key}
+	}
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return ErrNoSigningKey
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	keys := make(map[string]*SigningKey, len(ks.keys)+len(loaded))
+	// keys no longer loaded, replaced or removed from the directory, verify
+	// the tokens they signed until the overlap window has passed
+	for id, key := range ks.keys {
+		keys[id] = key
+	}
+	for _, key := range loaded {
+		if existing, ok := ks.keys[key.ID]; ok {
+			key.RetiredAt = existing.RetiredAt
+		}
+		keys[key.ID] = key
+	}
+	active := loaded[len(loaded)-1]
+	active.RetiredAt = time.Time{}
+	for id, key := range keys {
+		if id != active.ID && key.RetiredAt.IsZero() {
+			key.RetiredAt = now
+		}
+		if !key.RetiredAt.IsZero() && now.Sub(key.RetiredAt) > ks.overlap {
+			delete(keys, id)
+		}
+	}
+	ks.keys = keys
+	ks.active = active
+	return nil
+}
+
+// StartRotation rotates the keys every interval until Stop is called.
+func (ks *KeySet) StartRotation(interval time.Duration, logger log.Logger) {
+	stop := make(chan struct{})
+	ks.mu.Lock()
+	ks.stop = stop
+	ks.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := ks.Rotate(); err != nil {
+					level.Error(logger).Log("keyset", "rotate", "err", err)
+					continue
+				}
+				level.Info(logger).Log("keyset", "rotate", "kid", ks.ActiveKeyID())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (ks *KeySet) Stop() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.stop != nil {
+		close(ks.stop)
+		ks.stop = nil
+	}
+}
+
+func (ks *KeySet) ActiveKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active.ID
+}
+
+// Sign signs claims with the active key, naming it in the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	key := ks.active
+	ks.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Signer)
+}
+
+// Keyfunc is a jwt.Keyfunc returning the public key named by the kid header,
+// provided the token algorithm is the one of that key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	var retiredAt time.Time
+	if ok {
+		retiredAt = key.RetiredAt
+	}
+	ks.mu.RUnlock()
+
+	if !ok || (!retiredAt.IsZero() && time.Since(retiredAt) > ks.overlap) {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrSignMethod
+	}
+	return key.Signer.Public(), nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set.
+func (ks *KeySet) JWKS() model.JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := model.JWKS{Keys: make([]model.JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := model.JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.Signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// loadSigningKeys reads the *.pem private keys of dir in file name order.
+func loadSigningKeys(dir string) ([]*SigningKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, errors.New(filepath.Base(file) + ": " + err.Error())
+		}
+		key, err := newSigningKey(signer)
+		if err != nil {
+			return nil, errors.New(filepath.Base(file) + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrUnsupportedKey
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, ErrUnsupportedKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrSignMethod
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(signer)
+}
+
+// newSigningKey picks the signing method from the key type, and derives the
+// key id from the public key, so every instance loading the same key file
+// agrees on it.
+func newSigningKey(signer crypto.Signer) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, ErrUnsupportedKey
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedKey
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &SigningKey{
+		ID:     base64.RawURLEncoding.EncodeToString(sum[:12]),
+		Method: method,
+		Signer: signer,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+func TestKeySet(t *testing.T) {
+	parse := func(ks *KeySet, tokenStr string) error {
+		parser := jwt.NewParser(jwt.WithValidMethods(AllowedAlgorithms))
+		_, err := parser.ParseWithClaims(tokenStr, &model.CustomerClaims{}, ks.Keyfunc)
+		return err
+	}
+	claims := model.CustomerClaims{Username: "pascal"}
+
+	t.Run("pem keys", func(t *testing.T) {
+		dir := t.TempDir()
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+		writePEM(t, filepath.Join(dir, "1-rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+		ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+		writePEM(t, filepath.Join(dir, "2-ec.pem"), "EC PRIVATE KEY", ecDER)
+		edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+		writePEM(t, filepath.Join(dir, "3-ed25519.pem"), "PRIVATE KEY", edDER)
+
+		ks, err := NewKeySet(dir, "", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwks := ks.JWKS()
+		if len(jwks.Keys) != 3 {
+			t.Fatalf("expected 3 keys, got %d", len(jwks.Keys))
+		}
+		algs := map[string]string{}
+		for _, k := range jwks.Keys {
+			algs[k.Alg] = k.Kty
+		}
+		if algs["RS256"] != "RSA" || algs["ES256"] != "EC" || algs["EdDSA"] != "OKP" {
+			t.Fatalf("unexpected jwks %+v", jwks)
+		}
+
+		tokenStr, err := ks.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _, _ := jwt.NewParser().ParseUnverified(tokenStr, &model.CustomerClaims{})
+		if token.Method.Alg() != "EdDSA" {
+			t.Fatalf("expected the last key file to sign, got %s", token.Method.Alg())
+		}
+		if err := parse(ks, tokenStr); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rotation overlap", func(t *testing.T) {
+		ks, err := NewKeySet("", "ES256", 50*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old, _ := ks.Sign(claims)
+		if err := ks.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := parse(ks, old); err != nil {
+			t.Fatalf("expected retired key to verify within the overlap window, got %v", err)
+		}
+		if len(ks.JWKS().Keys) != 2 {
+			t.Fatalf("expected active and retired keys in jwks")
+		}
+		time.Sleep(60 * time.Millisecond)
+		if err := parse(ks, old); err == nil {
+			t.Fatal("expected retired key to be rejected after the overlap window")
+		}
+		if err := ks.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if len(ks.JWKS().Keys) != 2 {
+			t.Fatalf("expected expired key to be dropped from jwks")
+		}
+	})
+
+	t.Run("key removed from the directory", func(t *testing.T) {
+		dir := t.TempDir()
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+		writePEM(t, filepath.Join(dir, "1-ec.pem"), "EC PRIVATE KEY", ecDER)
+		ks, err := NewKeySet(dir, "", 50*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old, _ := ks.Sign(claims)
+
+		_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+		edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+		writePEM(t, filepath.Join(dir, "2-ed25519.pem"), "PRIVATE KEY", edDER)
+		if err := os.Remove(filepath.Join(dir, "1-ec.pem")); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := parse(ks, old); err != nil {
+			t.Fatalf("expected the removed key to verify within the overlap window, got %v", err)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if err := ks.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := parse(ks, old); err == nil {
+			t.Fatal("expected the removed key to be rejected after the overlap window")
+		}
+		if len(ks.JWKS().Keys) != 1 {
+			t.Fatalf("expected the removed key to be dropped from jwks")
+		}
+	})
+
+	t.Run("stop while rotating", func(t *testing.T) {
+		ks, _ := NewKeySet("", "ES256", time.Hour)
+		ks.StartRotation(time.Millisecond, log.NewNopLogger())
+		time.Sleep(5 * time.Millisecond)
+		done := make(chan struct{})
+		go func() {
+			ks.Stop()
+			close(done)
+		}()
+		ks.Stop()
+		<-done
+	})
+
+	t.Run("algorithm allow list", func(t *testing.T) {
+		ks, _ := NewKeySet("", "RS256", time.Hour)
+		kid := ks.ActiveKeyID()
+
+		hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		hs.Header["kid"] = kid
+		hsToken, _ := hs.SignedString([]byte("secret"))
+		if err := parse(ks, hsToken); err == nil {
+			t.Fatal("expected HS256 token to be rejected")
+		}
+
+		none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+		none.Header["kid"] = kid
+		noneToken, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err := parse(ks, noneToken); err == nil {
+			t.Fatal("expected unsigned token to be rejected")
+		}
+
+		// an allowed algorithm, but not the one of the named key
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		es := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		es.Header["kid"] = kid
+		esToken, _ := es.SignedString(ecKey)
+		if err := parse(ks, esToken); !errors.Is(err, ErrSignMethod) {
+			t.Fatalf("expected ErrSignMethod, got %v", err)
+		}
+	})
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/conn"
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+var (
+	ErrAccountLocked  = pkg.NewRetryableError(pkg.KindLocked, "account_locked", "account locked, too many failed logins")
+	ErrLoginThrottled = pkg.NewRetryableError(pkg.KindResourceExhausted, "login_throttled", "too many login attempts, retry later")
+)
+
+// Attempts is the login attempt record of a username or a client IP.
+type Attempts struct {
+	Count int
+	Last  time.Time
+}
+
+// AttemptStore counts login attempts. Records expire ttl after the last
+// attempt added.
+type AttemptStore interface {
+	// Add counts one more attempt under key, atomically, and returns the
+	// record as it was before.
+	Add(ctx context.Context, key string, ttl time.Duration) (Attempts, error)
+	// Undo takes back one attempt counted under key.
+	Undo(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// NewAttemptStore returns an AttemptStore backed by the shared redis client,
+// or an in-memory one if redis is not configured.
+func NewAttemptStore(logger log.Logger) AttemptStore {
+	if rdb := conn.GetRedis(); rdb != nil {
+		return NewRedisAttemptStore(rdb)
+	}
+	level.Warn(logger).Log("attempt_store", "memory", "msg", "redis is not configured, failed logins are not shared between instances")
+	return NewMemoryAttemptStore()
+}
+
+// LoginGuard throttles logins per username and per client IP. Every failed
+// login of a username doubles the delay before the next attempt is allowed,
+// and the username gets locked once Threshold failures are reached. Client IPs
+// are only throttled past IPThreshold failures, since many users may share
+// one. Locks lift Window after the last attempt.
+//
+// Attempts are counted before the credentials are checked, and count as
+// failed until Succeeded or Passed takes them back, so that parallel attempts
+// cannot all get past the lockout. Refused attempts count as well.
+type LoginGuard struct {
+	store       AttemptStore
+	threshold   int
+	ipThreshold int
+	window      time.Duration
+	backoffBase time.Duration
+	backoffMax  time.Duration
+}
+
+func NewLoginGuard(store AttemptStore, c config.LockoutConfig) *LoginGuard {
+	return &LoginGuard{
+		store:       store,
+		threshold:   c.Threshold,
+		ipThreshold: c.IPThreshold,
+		window:      c.Window,
+		backoffBase: c.BackoffBase,
+		backoffMax:  c.BackoffMax,
+	}
+}
+
+func NewLoginGuardFromConfig(store AttemptStore) *LoginGuard {
+	return NewLoginGuard(store, config.GetLockoutConfig())
+}
+
+func usernameAttemptsKey(username string) string {
+	return "usersvc:login:user:" + username
+}
+
+// mfaAttemptsKey counts the MFA codes tried for username apart from its
+// passwords, since the right password clears the latter.
+func mfaAttemptsKey(username string) string {
+	return "usersvc:login:mfa:" + username
+}
+
+func ipAttemptsKey(ip string) string {
+	return "usersvc:login:ip:" + ip
+}
+
+// Attempt records a password attempt of username from ip, the client IP when
+// known, and returns ErrAccountLocked or ErrLoginThrottled if the password
+// may not be checked.
+func (g *LoginGuard) Attempt(ctx context.Context, username, ip string) error {
+	return g.attempt(ctx, usernameAttemptsKey(username), ip)
+}
+
+// AttemptMFA records an MFA code attempt of username from ip, like Attempt.
+func (g *LoginGuard) AttemptMFA(ctx context.Context, username, ip string) error {
+	return g.attempt(ctx, mfaAttemptsKey(username), ip)
+}
+
+func (g *LoginGuard) attempt(ctx context.Context, key, ip string) error {
+	now := time.Now()
+	if ip != "" && g.ipThreshold > 0 {
+		attempts, err := g.store.Add(ctx, ipAttemptsKey(ip), g.window)
+		if err != nil {
+			return err
+		}
+		if attempts.Count >= g.ipThreshold {
+			return ErrLoginThrottled
+		}
+	}
+
+	attempts, err := g.store.Add(ctx, key, g.window)
+	if err != nil {
+		return err
+	}
+	if attempts.Count == 0 {
+		return nil
+	}
+	if g.threshold > 0 && attempts.Count >= g.threshold {
+		return ErrAccountLocked
+	}
+	if now.Before(attempts.Last.Add(g.backoff(attempts.Count))) {
+		return ErrLoginThrottled
+	}
+	return nil
+}
+
+// Passed clears the password attempts of username, which gave the right
+// password but still has to give an MFA code, and takes back its attempt
+// from ip. The MFA attempts are kept.
+func (g *LoginGuard) Passed(ctx context.Context, username, ip string) error {
+	if err := g.store.Reset(ctx, usernameAttemptsKey(username)); err != nil {
+		return err
+	}
+	return g.release(ctx, ip)
+}
+
+// Succeeded clears the attempts of username, and takes back its attempt from
+// ip. The rest of the client IP record is kept, so one valid account cannot
+// be used to reset it.
+func (g *LoginGuard) Succeeded(ctx context.Context, username, ip string) error {
+	if err := g.Unlock(ctx, username); err != nil {
+		return err
+	}
+	return g.release(ctx, ip)
+}
+
+// Unlock lifts the lock of username before its window is over.
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	if err := g.store.Reset(ctx, usernameAttemptsKey(username)); err != nil {
+		return err
+	}
+	return g.store.Reset(ctx, mfaAttemptsKey(username))
+}
+
+func (g *LoginGuard) release(ctx context.Context, ip string) error {
+	if ip == "" || g.ipThreshold <= 0 {
+		return nil
+	}
+	return g.store.Undo(ctx, ipAttemptsKey(ip))
+}
+
+// backoff is the delay to wait after the count-th consecutive failure.
+func (g *LoginGuard) backoff(count int) time.Duration {
+	delay := g.backoffBase
+	for i := 1; i < count && delay < g.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > g.backoffMax {
+		delay = g.backoffMax
+	}
+	return delay
+}
+
+type redisAttemptStore struct {
+	client *redis.Client
+}
+
+func NewRedisAttemptStore(client *redis.Client) AttemptStore {
+	return redisAttemptStore{client: client}
+}
+
+var addAttemptScript = redis.NewScript(`
+local before = redis.call('HMGET', KEYS[1], 'count', 'last')
+redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HSET', KEYS[1], 'last', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return before
+`)
+
+var undoAttemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 and redis.call('HINCRBY', KEYS[1], 'count', -1) <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (s redisAttemptStore) Add(ctx context.Context, key string, ttl time.Duration) (Attempts, error) {
+	values, err := addAttemptScript.Run(ctx, s.client, []string{key}, time.Now().UnixMilli(), ttl.Milliseconds()).Slice()
+	if err != nil {
+		return Attempts{}, err
+	}
+	var attempts Attempts
+	if v, ok := values[0].(string); ok {
+		attempts.Count, _ = strconv.Atoi(v)
+	}
+	if v, ok := values[1].(string); ok {
+		ms, _ := strconv.ParseInt(v, 10, 64)
+		attempts.Last = time.UnixMilli(ms)
+	}
+	return attempts, nil
+}
+
+func (s redisAttemptStore) Undo(ctx context.Context, key string) error {
+	return undoAttemptScript.Run(ctx, s.client, []string{key}).Err()
+}
+
+func (s redisAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+type memoryAttempts struct {
+	Attempts
+	expiresAt time.Time
+}
+
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]memoryAttempts
+}
+
+// NewMemoryAttemptStore returns an AttemptStore that lives in the process
+// memory, for tests and single instance deployments.
+func NewMemoryAttemptStore() AttemptStore {
+	return &memoryAttemptStore{attempts: make(map[string]memoryAttempts)}
+}
+
+func (s *memoryAttemptStore) Add(_ context.Context, key string, ttl time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	a := s.attempts[key]
+	before := a.Attempts
+	a.Count++
+	a.Last = now
+	a.expiresAt = now.Add(ttl)
+	s.attempts[key] = a
+	return before, nil
+}
+
+func (s *memoryAttemptStore) Undo(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	if a.Count--; a.Count <= 0 || time.Now().After(a.expiresAt) {
+		delete(s.attempts, key)
+		return nil
+	}
+	s.attempts[key] = a
+	return nil
+}
+
+func (s *memoryAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep drops expired records, it must be called with the lock held.
+func (s *memoryAttemptStore) sweep(now time.Time) {
+	for k, a := range s.attempts {
+		if now.After(a.expiresAt) {
+			delete(s.attempts, k)
+		}
+	}
+}
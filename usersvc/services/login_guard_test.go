@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+// newTestLoginGuard returns a guard with no backoff, so tests can fail logins
+// back to back.
+func newTestLoginGuard() *LoginGuard {
+	return NewLoginGuard(NewMemoryAttemptStore(), config.LockoutConfig{
+		Threshold:   3,
+		IPThreshold: 10,
+		Window:      time.Minute,
+	})
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard()
+
+	for i := 0; i < 3; i++ {
+		if err := guard.Attempt(ctx, "pascal", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	if err := guard.Attempt(ctx, "pascal", "10.0.0.2"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	// other users are not affected
+	if err := guard.Attempt(ctx, "lin", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := guard.Unlock(ctx, "pascal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Attempt(ctx, "pascal", "10.0.0.1"); err != nil {
+		t.Fatalf("expected unlocked, got %v", err)
+	}
+}
+
+func TestLoginGuardSucceeded(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard()
+
+	for i := 0; i < 2; i++ {
+		guard.Attempt(ctx, "pascal", "10.0.0.1")
+	}
+	if err := guard.Succeeded(ctx, "pascal", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := guard.Attempt(ctx, "pascal", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+
+	// the right password clears the password attempts, not the MFA ones
+	for i := 0; i < 3; i++ {
+		guard.AttemptMFA(ctx, "lin", "")
+	}
+	if err := guard.Passed(ctx, "lin", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Attempt(ctx, "lin", ""); err != nil {
+		t.Fatalf("expected the password attempts cleared, got %v", err)
+	}
+	if err := guard.AttemptMFA(ctx, "lin", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+}
+
+// TestLoginGuardParallel checks that attempts made at once, before any of them
+// is known to fail, cannot get past the lockout or the backoff.
+func TestLoginGuardParallel(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  config.LockoutConfig
+		allowed int
+	}{
+		{"lockout", config.LockoutConfig{Threshold: 3, Window: time.Minute}, 3},
+		{"backoff", config.LockoutConfig{Threshold: 3, Window: time.Minute, BackoffBase: time.Second, BackoffMax: time.Minute}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			guard := NewLoginGuard(NewMemoryAttemptStore(), tc.config)
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				allowed int
+			)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if guard.Attempt(context.Background(), "pascal", "") == nil {
+						mu.Lock()
+						allowed++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if allowed != tc.allowed {
+				t.Fatalf("expected %d attempts allowed, got %d", tc.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestLoginGuardUnlocksAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config.LockoutConfig{Threshold: 1, Window: 20 * time.Millisecond})
+
+	guard.Attempt(ctx, "pascal", "")
+	if err := guard.Attempt(ctx, "pascal", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := guard.Attempt(ctx, "pascal", ""); err != nil {
+		t.Fatalf("expected unlocked, got %v", err)
+	}
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(NewMemoryAttemptStore(), config.LockoutConfig{
+		Threshold:   10,
+		Window:      time.Minute,
+		BackoffBase: time.Second,
+		BackoffMax:  5 * time.Second,
+	})
+
+	guard.Attempt(ctx, "pascal", "")
+	if err := guard.Attempt(ctx, "pascal", ""); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected ErrLoginThrottled, got %v", err)
+	}
+
+	for count, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 9: 5 * time.Second} {
+		if got := guard.backoff(count); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", count, got, want)
+		}
+	}
+}
+
+func TestLoginGuardThrottlesIP(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard()
+
+	// successful logins are taken back
+	for i := 0; i < 10; i++ {
+		guard.Attempt(ctx, "lin", "10.0.0.1")
+		guard.Succeeded(ctx, "lin", "10.0.0.1")
+	}
+	// spread over many usernames, so none of them gets locked
+	for i := 0; i < 10; i++ {
+		if err := guard.Attempt(ctx, string(rune('a'+i)), "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	if err := guard.Attempt(ctx, "pascal", "10.0.0.1"); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected ErrLoginThrottled, got %v", err)
+	}
+	if err := guard.Attempt(ctx, "pascal", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+}
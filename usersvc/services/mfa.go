@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+var (
+	ErrInvalidMFACode    = pkg.NewError(pkg.KindUnauthenticated, "invalid_mfa_code", "invalid MFA code")
+	ErrMFANotEnrolled    = pkg.NewError(pkg.KindInvalidArgument, "mfa_not_enrolled", "MFA enrollment not started")
+	ErrMFAAlreadyEnabled = pkg.NewError(pkg.KindAlreadyExists, "mfa_already_enabled", "MFA already enabled")
+)
+
+// UserMFA is the TOTP state of a user. Secrets have to be readable to check
+// codes, recovery codes are only stored hashed.
+type UserMFA struct {
+	Enabled bool   `bson:"enabled"`
+	Secret  string `bson:"secret,omitempty"`
+	// PendingSecret is the secret of an enrollment not confirmed yet
+	PendingSecret string   `bson:"pending_secret,omitempty"`
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// LastStep is the time step of the last code used, codes of that step or
+	// earlier ones are refused so a code cannot be replayed
+	LastStep int64 `bson:"last_step"`
+}
+
+// EnrollMFA starts an MFA enrollment, the returned secret only gets enabled
+// once ConfirmMFA is given a code generated from it.
+func (s UserService) EnrollMFA(ctx context.Context, username string) (model.MFAEnrollment, error) {
+	user, err := s.findUserByUserName(ctx, username)
+	if err != nil {
+		return model.MFAEnrollment{}, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return model.MFAEnrollment{}, ErrUserNotFound
+	}
+	if user.MFA != nil && user.MFA.Enabled {
+		return model.MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.totp.GenerateSecret()
+	if err != nil {
+		return model.MFAEnrollment{}, err
+	}
+	_, err = s.db.Collection("users").UpdateOne(ctx,
+		activeUser(username),
+		bson.M{"$set": bson.M{"mfa.pending_secret": secret}},
+	)
+	if err != nil {
+		return model.MFAEnrollment{}, err
+	}
+	return model.MFAEnrollment{Secret: secret, URI: s.totp.URI(username, secret)}, nil
+}
+
+// ConfirmMFA enables MFA with the pending secret if code matches it, and
+// returns the one-time recovery codes, which are never shown again.
+func (s UserService) ConfirmMFA(ctx context.Context, username, code string) ([]string, error) {
+	user, err := s.findUserByUserName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.MFA == nil || user.MFA.PendingSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := s.totp.Validate(user.MFA.PendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	// match on the pending secret, so a concurrent enrollment is not enabled
+	result, err := s.db.Collection("users").UpdateOne(ctx,
+		bson.M{"username": username, "mfa.pending_secret": user.MFA.PendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"mfa.enabled":        true,
+				"mfa.secret":         user.MFA.PendingSecret,
+				"mfa.recovery_codes": hashes,
+				"mfa.last_step":      step,
+			},
+			"$unset": bson.M{"mfa.pending_secret": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrMFANotEnrolled
+	}
+	return codes, nil
+}
+
+// VerifyMFA completes a login started by Login, exchanging its MFA challenge
+// and a TOTP or recovery code for a token pair. Wrong codes count as failed
+// logins, and the challenge can be retried until it expires.
+func (s UserService) VerifyMFA(ctx context.Context, challenge, code string) (model.TokenPair, error) {
+	claims, err := s.tokens.ParseChallenge(challenge)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	ip := middleware.ClientIPFromContext(ctx)
+	if err := s.guard.AttemptMFA(ctx, claims.Username, ip); err != nil {
+		return model.TokenPair{}, err
+	}
+
+	user, err := s.findUserByUserName(ctx, claims.Username)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if user == nil || user.DeletedAt != nil || user.MFA == nil || !user.MFA.Enabled {
+		return model.TokenPair{}, ErrInvalidToken
+	}
+	ok, err := s.useMFACode(ctx, user, code)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if !ok {
+		return model.TokenPair{}, ErrInvalidMFACode
+	}
+	if err := s.tokens.CompleteChallenge(ctx, claims); err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := s.guard.Succeeded(ctx, user.Username, ip); err != nil {
+		level.Error(s.logger).Log("method", "VerifyMFA", "during", "reset attempts", "err", err)
+	}
+	return s.tokens.Issue(ctx, user.identity(), "")
+}
+
+// useMFACode checks code as a TOTP code, then as a recovery code, and marks
+// it used. The updates are conditional, so concurrent requests cannot both
+// use the same code.
+func (s UserService) useMFACode(ctx context.Context, user *User, code string) (bool, error) {
+	var filter, update bson.M
+	if step, ok := s.totp.Validate(user.MFA.Secret, code, time.Now()); ok {
+		filter = bson.M{"username": user.Username, "mfa.last_step": bson.M{"$lt": step}}
+		update = bson.M{"$set": bson.M{"mfa.last_step": step}}
+	} else {
+		hashed := hashRecoveryCode(code)
+		filter = bson.M{"username": user.Username, "mfa.recovery_codes": hashed}
+		update = bson.M{"$pull": bson.M{"mfa.recovery_codes": hashed}}
+	}
+	result, err := s.db.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+var ErrUnknownNotifier = errors.New("unknown notifier")
+
+// Notification is a message to a user.
+type Notification struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notifications to users.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewNotifierFromConfig returns the notifier selected by NOTIFIER.
+func NewNotifierFromConfig(logger log.Logger) (Notifier, error) {
+	c := config.GetNotifierConfig()
+	switch c.Notifier {
+	case "log":
+		return NewLogNotifier(logger), nil
+	case "smtp":
+		var auth smtp.Auth
+		if c.SMTPUsername != "" {
+			auth = smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, c.SMTPHost)
+		}
+		return NewSMTPNotifier(net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort)), c.SMTPFrom, auth), nil
+	}
+	return nil, ErrUnknownNotifier
+}
+
+type logNotifier struct {
+	logger log.Logger
+}
+
+// NewLogNotifier returns a Notifier which only logs notifications, for
+// development. The logs contain the tokens sent, never use it in production.
+func NewLogNotifier(logger log.Logger) Notifier {
+	return logNotifier{logger: logger}
+}
+
+func (n logNotifier) Notify(_ context.Context, msg Notification) error {
+	return level.Info(n.logger).Log("notifier", "log", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+}
+
+// SMTPNotifier sends notifications as plain text emails, upgrading the
+// connection with STARTTLS when the server offers it.
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPNotifier(addr, from string, auth smtp.Auth) *SMTPNotifier {
+	return &SMTPNotifier{addr: addr, from: from, auth: auth}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Notification) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	host, _, _ := net.SplitHostPort(n.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *SMTPNotifier) message(msg Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
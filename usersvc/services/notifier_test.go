@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records the notifications instead of sending them.
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, msg Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func (n *fakeNotifier) last() Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.sent) == 0 {
+		return Notification{}
+	}
+	return n.sent[len(n.sent)-1]
+}
+
+// notifierFunc is a Notifier calling itself.
+type notifierFunc func(ctx context.Context, n Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+// fakeSMTPServer accepts a single SMTP session on a local port, and returns
+// the envelope and data it received.
+func fakeSMTPServer(t *testing.T) (addr string, received <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan []string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		var lines []string
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP fake")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+				lines = append(lines, line)
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 end with <CRLF>.<CRLF>")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 OK queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				out <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+		out <- lines
+	}()
+	return l.Addr().String(), out
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	notifier := NewSMTPNotifier(addr, "no-reply@example.com", nil)
+
+	err := notifier.Notify(context.Background(), Notification{
+		To:      "pascal@example.com",
+		Subject: "Reset your password",
+		Body:    "follow\nthis link",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := <-received
+	session := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@example.com>",
+		"RCPT TO:<pascal@example.com>",
+		"To: pascal@example.com",
+		"Subject: Reset your password",
+		"follow\nthis link",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("expected %q in the session:\n%s", want, session)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+var (
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash        = errors.New("malformed password hash")
+)
+
+// PasswordHasher hashes and verifies user passwords. Encoded hashes carry
+// their algorithm and parameters, so a hasher can verify hashes produced by
+// an older configuration and report when they should be upgraded.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether encoded was produced by another algorithm
+	// or with other parameters than the ones this hasher would use now.
+	NeedsRehash(encoded string) bool
+}
+
+// NewPasswordHasher returns a PasswordHasher that hashes new passwords with
+// the named algorithm, and verifies hashes of every supported algorithm,
+// including the legacy unsalted MD5 digests.
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	var primary PasswordHasher
+	switch algorithm {
+	case "bcrypt":
+		primary = NewBcryptHasher()
+	case "scrypt":
+		primary = NewScryptHasher()
+	case "argon2id":
+		primary = NewArgon2idHasher()
+	default:
+		return nil, ErrUnknownHashAlgorithm
+	}
+	return passwordHasher{primary: primary}, nil
+}
+
+// NewPasswordHasherFromConfig returns the PasswordHasher configured by the
+// PASSWORD_HASH_ALGORITHM environment variable.
+func NewPasswordHasherFromConfig() (PasswordHasher, error) {
+	return NewPasswordHasher(config.GetPasswordConfig().Algorithm)
+}
+
+type passwordHasher struct {
+	primary PasswordHasher
+}
+
+func (h passwordHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+func (h passwordHasher) Verify(encoded, password string) (bool, error) {
+	switch {
+	case isBcryptHash(encoded):
+		return NewBcryptHasher().Verify(encoded, password)
+	case strings.HasPrefix(encoded, scryptPrefix):
+		return NewScryptHasher().Verify(encoded, password)
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		return NewArgon2idHasher().Verify(encoded, password)
+	case isLegacyMD5Hash(encoded):
+		return verifyLegacyMD5(encoded, password), nil
+	}
+	return false, ErrUnknownHashAlgorithm
+}
+
+func (h passwordHasher) NeedsRehash(encoded string) bool {
+	return h.primary.NeedsRehash(encoded)
+}
+
+// BcryptHasher hashes passwords with bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() BcryptHasher {
+	return BcryptHasher{Cost: 12}
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	return true, nil
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcryptHash(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+const scryptPrefix = "$scrypt$"
+
+// ScryptHasher hashes passwords with scrypt, N being the CPU/memory cost
+// (a power of two), encoded as $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>.
+type ScryptHasher struct {
+	N, R, P int
+	SaltLen int
+	KeyLen  int
+}
+
+func NewScryptHasher() ScryptHasher {
+	return ScryptHasher{N: 1 << 15, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+}
+
+func (h ScryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, h.N, h.R, h.P, h.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sln=%d,r=%d,p=%d$%s$%s", scryptPrefix, log2(h.N), h.R, h.P, b64(salt), b64(key)), nil
+}
+
+func (h ScryptHasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+	other, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h ScryptHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return true
+	}
+	return params.N != h.N || params.R != h.R || params.P != h.P || len(salt) != h.SaltLen || len(key) != h.KeyLen
+}
+
+func decodeScrypt(encoded string) (params ScryptHasher, salt, key []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, scryptPrefix), "$")
+	if !strings.HasPrefix(encoded, scryptPrefix) || len(parts) != 3 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	var ln int
+	if _, err := fmt.Sscanf(parts[0], "ln=%d,r=%d,p=%d", &ln, &params.R, &params.P); err != nil || ln < 1 || ln > 30 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	params.N = 1 << ln
+	if salt, err = unb64(parts[1]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if key, err = unb64(parts[2]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idHasher hashes passwords with argon2id, encoded in the PHC string
+// format $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLen     int
+	KeyLen      uint32
+}
+
+func NewArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLen: 16, KeyLen: 32}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism, b64(salt), b64(key)), nil
+}
+
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory || params.Iterations != h.Iterations || params.Parallelism != h.Parallelism ||
+		len(salt) != h.SaltLen || uint32(len(key)) != h.KeyLen
+}
+
+func decodeArgon2id(encoded string) (params Argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, argon2idPrefix), "$")
+	if !strings.HasPrefix(encoded, argon2idPrefix) || len(parts) != 4 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil ||
+		params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if salt, err = unb64(parts[2]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if key, err = unb64(parts[3]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+// Legacy hashes are unsalted hex MD5 digests written before the hashers were
+// introduced. They are only ever verified, and upgraded on the next login.
+
+func isLegacyMD5Hash(encoded string) bool {
+	if len(encoded) != hex.EncodedLen(md5.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func verifyLegacyMD5(encoded, password string) bool {
+	p := md5.Sum([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(encoded)), []byte(hex.EncodeToString(p[:]))) == 1
+}
+
+func randomSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func log2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
+
+func b64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func unb64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pascallin/go-kit-application/config"
+)
+
+// Codes of the password policy violations.
+const (
+	ViolationTooShort       = "too_short"
+	ViolationTooLong        = "too_long"
+	ViolationMissingLower   = "missing_lower"
+	ViolationMissingUpper   = "missing_upper"
+	ViolationMissingDigit   = "missing_digit"
+	ViolationMissingSymbol  = "missing_symbol"
+	ViolationContainsName   = "contains_username"
+	ViolationCommonPassword = "common_password"
+	ViolationReusedPassword = "reused_password"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordList))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			m[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return m
+}()
+
+// PasswordPolicy is the strength a new password must have. The reuse of
+// previous passwords is checked by UserService, which knows their hashes.
+type PasswordPolicy struct {
+	// MinLength counts characters, MaxLength counts the UTF-8 bytes
+	MinLength        int
+	MaxLength        int
+	RequireLower     bool
+	RequireUpper     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUsername bool
+	DisallowCommon   bool
+	// History is how many previous passwords cannot be used again
+	History int
+}
+
+func NewPasswordPolicyFromConfig() PasswordPolicy {
+	c := config.GetPasswordConfig()
+	return PasswordPolicy{
+		MinLength:        c.MinLength,
+		MaxLength:        c.MaxLength,
+		RequireLower:     c.RequireLower,
+		RequireUpper:     c.RequireUpper,
+		RequireDigit:     c.RequireDigit,
+		RequireSymbol:    c.RequireSymbol,
+		DisallowUsername: c.DisallowUsername,
+		DisallowCommon:   c.DisallowCommon,
+		History:          c.History,
+	}
+}
+
+// Validate checks password, sent in field for the user named username, and
+// returns a *ValidationError listing every rule it breaks.
+func (p PasswordPolicy) Validate(field, username, password string) error {
+	verr := &ValidationError{}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		verr.add(field, ViolationTooShort, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	// the hashers take bytes, bcrypt refuses more than 72 of them
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		verr.add(field, ViolationTooLong, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		verr.add(field, ViolationMissingLower, "must contain a lower case letter")
+	}
+	if p.RequireUpper && !upper {
+		verr.add(field, ViolationMissingUpper, "must contain an upper case letter")
+	}
+	if p.RequireDigit && !digit {
+		verr.add(field, ViolationMissingDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		verr.add(field, ViolationMissingSymbol, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.DisallowUsername && username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		verr.add(field, ViolationContainsName, "must not contain the username")
+	}
+	if p.DisallowCommon {
+		if _, ok := commonPasswords[lowered]; ok {
+			verr.add(field, ViolationCommonPassword, "is too common")
+		}
+	}
+	return verr.err()
+}
+
+// reusedPassword reports whether password matches the current hash of user or
+// one of the hashes kept in its history.
+func (s UserService) reusedPassword(user *User, password string) bool {
+	if s.policy.History <= 0 {
+		return false
+	}
+	for _, encoded := range append([]string{user.Password}, user.PasswordHistory...) {
+		if ok, _ := s.hasher.Verify(encoded, password); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordUpdate returns the update setting the password of user to hashed,
+// keeping the replaced hash in the history.
+func (s UserService) passwordUpdate(user *User, hashed string) bson.M {
+	update := bson.M{"$set": bson.M{"password": hashed}}
+	if s.policy.History > 1 {
+		// the current password counts as one of the last History ones
+		update["$push"] = bson.M{"password_history": bson.M{
+			"$each":  bson.A{user.Password},
+			"$slice": -(s.policy.History - 1),
+		}}
+	}
+	return update
+}
+
+func reusedPasswordError(field string) error {
+	verr := &ValidationError{}
+	verr.add(field, ViolationReusedPassword, "must not be one of the last passwords")
+	return verr
+}
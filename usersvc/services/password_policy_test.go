@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        16,
+		RequireLower:     true,
+		RequireUpper:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUsername: true,
+		DisallowCommon:   true,
+	}
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"valid", "Str0ng-pass", nil},
+		{"too short", "S0-p", []string{ViolationTooShort}},
+		{"too long", "Str0ng-pass-Str0ng-pass", []string{ViolationTooLong}},
+		{"too long in bytes", "Str0ng-pässwörd", []string{ViolationTooLong}},
+		{"multibyte within bytes", "Str0ng-päss", nil},
+		{"no lower case", "STR0NG-PASS", []string{ViolationMissingLower}},
+		{"no upper case", "str0ng-pass", []string{ViolationMissingUpper}},
+		{"no digit", "Strong-pass", []string{ViolationMissingDigit}},
+		{"no symbol", "Str0ngpass", []string{ViolationMissingSymbol}},
+		{"contains username", "My-Pascal-1", []string{ViolationContainsName}},
+		{"common", "P@ssw0rd", []string{ViolationCommonPassword}},
+		{"several", "pascal", []string{ViolationTooShort, ViolationMissingUpper, ViolationMissingDigit, ViolationMissingSymbol, ViolationContainsName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate("password", "pascal", tt.password)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrValidation) {
+				t.Fatalf("expected ErrValidation, got %v", err)
+			}
+			var verr *ValidationError
+			errors.As(err, &verr)
+			if len(verr.Violations) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, verr.Violations)
+			}
+			for i, code := range tt.want {
+				if v := verr.Violations[i]; v.Code != code || v.Field != "password" {
+					t.Fatalf("expected %s on password, got %+v", code, v)
+				}
+			}
+		})
+	}
+}
+
+// TestPasswordPolicyBcryptLimit checks that every password the default policy
+// accepts can be hashed by bcrypt, whatever its characters.
+func TestPasswordPolicyBcryptLimit(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 72}
+	hasher := BcryptHasher{Cost: bcrypt.MinCost}
+
+	fits := "Pä1" + strings.Repeat("ö", 34) // 72 bytes, 37 characters
+	if err := policy.Validate("password", "", fits); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := hasher.Hash(fits); err != nil {
+		t.Fatalf("expected bcrypt to hash an accepted password, got %v", err)
+	}
+
+	var verr *ValidationError
+	err := policy.Validate("password", "", fits+"ö")
+	if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Code != ViolationTooLong {
+		t.Fatalf("expected %s, got %v", ViolationTooLong, err)
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	var (
+		bcryptHasher   = BcryptHasher{Cost: bcrypt.MinCost}
+		scryptHasher   = ScryptHasher{N: 1 << 10, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+		argon2idHasher = Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLen: 16, KeyLen: 32}
+	)
+
+	for _, tc := range []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"bcrypt", bcryptHasher},
+		{"scrypt", scryptHasher},
+		{"argon2id", argon2idHasher},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := passwordHasher{primary: tc.hasher}
+			encoded, err := h.Hash("foobar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := h.Verify(encoded, "foobar"); err != nil || !ok {
+				t.Fatalf("expected password to match, got %v, %v", ok, err)
+			}
+			if ok, err := h.Verify(encoded, "foobaz"); err != nil || ok {
+				t.Fatalf("expected password not to match, got %v, %v", ok, err)
+			}
+			if h.NeedsRehash(encoded) {
+				t.Fatalf("expected %q not to need rehash", encoded)
+			}
+			// hashes of every other algorithm remain verifiable, but get upgraded
+			for _, other := range []PasswordHasher{bcryptHasher, scryptHasher, argon2idHasher} {
+				if other == tc.hasher {
+					continue
+				}
+				encoded, err := other.Hash("foobar")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok, err := h.Verify(encoded, "foobar"); err != nil || !ok {
+					t.Fatalf("expected %q to match, got %v, %v", encoded, ok, err)
+				}
+				if !h.NeedsRehash(encoded) {
+					t.Fatalf("expected %q to need rehash", encoded)
+				}
+			}
+		})
+	}
+
+	t.Run("legacy md5", func(t *testing.T) {
+		h := passwordHasher{primary: bcryptHasher}
+		if ok, err := h.Verify("3858f62230ac3c915f300c664312c63f", "foobar"); err != nil || !ok {
+			t.Fatalf("expected password to match, got %v, %v", ok, err)
+		}
+		if ok, _ := h.Verify("3858f62230ac3c915f300c664312c63f", "foobaz"); ok {
+			t.Fatal("expected password not to match")
+		}
+		if !h.NeedsRehash("3858f62230ac3c915f300c664312c63f") {
+			t.Fatal("expected legacy hash to need rehash")
+		}
+	})
+
+	t.Run("parameter change", func(t *testing.T) {
+		encoded, _ := scryptHasher.Hash("foobar")
+		stronger := scryptHasher
+		stronger.N = 1 << 11
+		if !stronger.NeedsRehash(encoded) {
+			t.Fatal("expected hash with old parameters to need rehash")
+		}
+	})
+
+	t.Run("malformed hash", func(t *testing.T) {
+		h := passwordHasher{primary: bcryptHasher}
+		for _, encoded := range []string{"", "fake", "$scrypt$ln=10$abc", "$argon2id$v=19$m=1,t=0,p=1$a$b"} {
+			if ok, err := h.Verify(encoded, "foobar"); err == nil || ok {
+				t.Fatalf("expected %q to be rejected, got %v, %v", encoded, ok, err)
+			}
+		}
+	})
+}
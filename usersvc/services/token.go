@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+var (
+	ErrTokenRevoked       = pkg.NewError(pkg.KindUnauthenticated, "token_revoked", "token revoked")
+	ErrRefreshTokenReused = pkg.NewError(pkg.KindUnauthenticated, "refresh_token_reused", "refresh token reused")
+)
+
+// challengeTTL is how long the user has to enter the MFA code after the
+// password.
+const challengeTTL = 5 * time.Minute
+
+// TokenManager issues, validates, rotates and revokes the access and refresh
+// tokens of users.
+type TokenManager struct {
+	store      TokenStore
+	keys       *KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenManager(store TokenStore, keys *KeySet, accessTTL, refreshTTL time.Duration) *TokenManager {
+	return &TokenManager{
+		store:      store,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+func NewTokenManagerFromConfig(store TokenStore, keys *KeySet) *TokenManager {
+	c := config.GetAppSecretConfig()
+	return NewTokenManager(store, keys, c.AccessTokenTTL, c.RefreshTokenTTL)
+}
+
+// Issue returns a new access and refresh token pair for identity. The refresh
+// token joins family, or starts a new family when family is empty. Only the
+// access token carries roles and permissions, they are looked up again when
+// the refresh token is redeemed.
+func (m *TokenManager) Issue(ctx context.Context, identity model.Identity, family string) (model.TokenPair, error) {
+	now := time.Now()
+	if family == "" {
+		family = newTokenID()
+	}
+	access := model.CustomerClaims{
+		Username:    identity.Username,
+		TokenType:   model.AccessToken,
+		Roles:       identity.Roles,
+		Permissions: identity.Permissions,
+		StandardClaims: jwt.StandardClaims{
+			Id:        newTokenID(),
+			Subject:   identity.Username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(m.accessTTL).Unix(),
+		},
+	}
+	refresh := model.CustomerClaims{
+		Username:  identity.Username,
+		TokenType: model.RefreshToken,
+		Family:    family,
+		StandardClaims: jwt.StandardClaims{
+			Id:        newTokenID(),
+			Subject:   identity.Username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(m.refreshTTL).Unix(),
+		},
+	}
+
+	accessToken, err := m.sign(access)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	refreshToken, err := m.sign(refresh)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := m.store.SaveRefresh(ctx, family, refresh.Id, m.refreshTTL); err != nil {
+		return model.TokenPair{}, err
+	}
+	return model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    access.ExpiresAt,
+	}, nil
+}
+
+// Validate parses an access token and checks it has not been revoked.
+func (m *TokenManager) Validate(ctx context.Context, tokenStr string) (*model.CustomerClaims, error) {
+	claims, err := m.parse(tokenStr, model.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := m.store.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	if err := m.checkUser(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Redeem consumes a refresh token, so it can be exchanged exactly once for a
+// new token pair of the same family. Presenting an already rotated refresh
+// token means it has leaked, so the whole family gets revoked.
+func (m *TokenManager) Redeem(ctx context.Context, refreshToken string) (*model.CustomerClaims, error) {
+	claims, err := m.parse(refreshToken, model.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkUser(ctx, claims); err != nil {
+		return nil, err
+	}
+	current, err := m.store.ConsumeRefresh(ctx, claims.Family, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	switch current {
+	case claims.Id:
+		return claims, nil
+	case "":
+		return nil, ErrTokenRevoked
+	default:
+		if err := m.store.RevokeRefreshFamily(ctx, claims.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+}
+
+// Revoke revokes an access token until it expires, and the refresh token
+// family of refreshToken if it is not empty.
+func (m *TokenManager) Revoke(ctx context.Context, accessToken, refreshToken string) error {
+	access, err := m.parse(accessToken, model.AccessToken)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Revoke(ctx, access.Id, time.Until(time.Unix(access.ExpiresAt, 0))); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	refresh, err := m.parse(refreshToken, model.RefreshToken)
+	if err != nil {
+		return err
+	}
+	if refresh.Username != access.Username {
+		return ErrInvalidToken
+	}
+	return m.store.RevokeRefreshFamily(ctx, refresh.Family)
+}
+
+// RevokeUser revokes every access token and refresh token family of
+// username issued so far, once its password changed for instance.
+func (m *TokenManager) RevokeUser(ctx context.Context, username string) error {
+	// no token issued now lives longer than the refresh tokens
+	return m.store.RevokeUser(ctx, username, time.Now(), m.refreshTTL)
+}
+
+// checkUser rejects the tokens issued before the tokens of their user were
+// revoked. Token times are in seconds, those issued in the second of the
+// revocation are kept so the user can log in again right away.
+func (m *TokenManager) checkUser(ctx context.Context, claims *model.CustomerClaims) error {
+	revokedAt, err := m.store.UserRevokedAt(ctx, claims.Username)
+	if err != nil {
+		return err
+	}
+	if claims.IssuedAt < revokedAt.Unix() {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// IssueChallenge returns an MFA challenge token for username, to be
+// exchanged once for a token pair by CompleteChallenge.
+func (m *TokenManager) IssueChallenge(ctx context.Context, username string) (string, error) {
+	now := time.Now()
+	claims := model.CustomerClaims{
+		Username:  username,
+		TokenType: model.MFAChallenge,
+		StandardClaims: jwt.StandardClaims{
+			Id:        newTokenID(),
+			Subject:   username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(challengeTTL).Unix(),
+		},
+	}
+	token, err := m.sign(claims)
+	if err != nil {
+		return "", err
+	}
+	if err := m.store.SaveRefresh(ctx, challengeFamily(claims.Id), claims.Id, challengeTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ParseChallenge returns the claims of an MFA challenge token not used yet.
+func (m *TokenManager) ParseChallenge(tokenStr string) (*model.CustomerClaims, error) {
+	return m.parse(tokenStr, model.MFAChallenge)
+}
+
+// CompleteChallenge consumes an MFA challenge, so it cannot complete
+// another login.
+func (m *TokenManager) CompleteChallenge(ctx context.Context, claims *model.CustomerClaims) error {
+	current, err := m.store.ConsumeRefresh(ctx, challengeFamily(claims.Id), claims.Id)
+	if err != nil {
+		return err
+	}
+	if current != claims.Id {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// challengeFamily keeps MFA challenges apart from the refresh token families
+// in the store, challenges being single use like refresh tokens.
+func challengeFamily(jti string) string {
+	return "mfa:" + jti
+}
+
+func (m *TokenManager) sign(claims model.CustomerClaims) (string, error) {
+	tokenString, err := m.keys.Sign(claims)
+	if err != nil {
+		return "", errors.New("generate token error: " + err.Error())
+	}
+	return tokenString, nil
+}
+
+func (m *TokenManager) parse(tokenStr, tokenType string) (*model.CustomerClaims, error) {
+	claims := &model.CustomerClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(AllowedAlgorithms))
+	token, err := parser.ParseWithClaims(tokenStr, claims, m.keys.Keyfunc)
+	if err != nil || !token.Valid || claims.TokenType != tokenType || claims.Id == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pascallin/go-kit-application/conn"
+)
+
+// consumedRefresh marks a refresh token family whose current token has been
+// redeemed, while the rotated token is being issued.
+const consumedRefresh = "-"
+
+// TokenStore keeps the server side token state: revoked access token ids, the
+// current refresh token id of each refresh token family, and when the tokens
+// of each user were last revoked.
+type TokenStore interface {
+	Revoke(ctx context.Context, jti string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	SaveRefresh(ctx context.Context, family, jti string, ttl time.Duration) error
+	// ConsumeRefresh atomically marks jti as redeemed if it is the current
+	// token of the family, and returns the previous current token id, which
+	// is empty when the family is unknown, revoked or expired.
+	ConsumeRefresh(ctx context.Context, family, jti string) (string, error)
+	RevokeRefreshFamily(ctx context.Context, family string) error
+	// RevokeUser revokes the tokens of username issued before at, for ttl.
+	RevokeUser(ctx context.Context, username string, at time.Time, ttl time.Duration) error
+	// UserRevokedAt returns when the tokens of username were last revoked,
+	// the zero time if they were not.
+	UserRevokedAt(ctx context.Context, username string) (time.Time, error)
+}
+
+// NewTokenStore returns a TokenStore backed by the shared redis client, so
+// every instance sees the tokens revoked by the others.
+func NewTokenStore() (TokenStore, error) {
+	rdb := conn.GetRedis()
+	if rdb == nil {
+		return nil, conn.ErrRedisNotConnected
+	}
+	return NewRedisTokenStore(rdb), nil
+}
+
+type redisTokenStore struct {
+	client *redis.Client
+}
+
+func NewRedisTokenStore(client *redis.Client) TokenStore {
+	return redisTokenStore{client: client}
+}
+
+func revokedKey(jti string) string {
+	return "usersvc:token:revoked:" + jti
+}
+
+func refreshKey(family string) string {
+	return "usersvc:token:refresh:" + family
+}
+
+func userRevokedKey(username string) string {
+	return "usersvc:token:user-revoked:" + username
+}
+
+func (s redisTokenStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	return s.client.Set(ctx, revokedKey(jti), 1, ttl).Err()
+}
+
+func (s redisTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, revokedKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s redisTokenStore) SaveRefresh(ctx context.Context, family, jti string, ttl time.Duration) error {
+	return s.client.Set(ctx, refreshKey(family), jti, ttl).Err()
+}
+
+var consumeRefreshScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return ''
+end
+if current == ARGV[1] then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ttl)
+	else
+		redis.call('SET', KEYS[1], ARGV[2])
+	end
+end
+return current
+`)
+
+func (s redisTokenStore) ConsumeRefresh(ctx context.Context, family, jti string) (string, error) {
+	return consumeRefreshScript.Run(ctx, s.client, []string{refreshKey(family)}, jti, consumedRefresh).Text()
+}
+
+func (s redisTokenStore) RevokeRefreshFamily(ctx context.Context, family string) error {
+	return s.client.Del(ctx, refreshKey(family)).Err()
+}
+
+func (s redisTokenStore) RevokeUser(ctx context.Context, username string, at time.Time, ttl time.Duration) error {
+	return s.client.Set(ctx, userRevokedKey(username), at.Unix(), ttl).Err()
+}
+
+func (s redisTokenStore) UserRevokedAt(ctx context.Context, username string) (time.Time, error) {
+	sec, err := s.client.Get(ctx, userRevokedKey(username)).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+type memoryTokenStore struct {
+	mu       sync.Mutex
+	revoked  map[string]memoryEntry
+	families map[string]memoryEntry
+	users    map[string]memoryEntry
+}
+
+// NewMemoryTokenStore returns a TokenStore that lives in the process memory,
+// for tests.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		revoked:  make(map[string]memoryEntry),
+		families: make(map[string]memoryEntry),
+		users:    make(map[string]memoryEntry),
+	}
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (s *memoryTokenStore) Revoke(_ context.Context, jti string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.revoked[jti] = memoryEntry{expiresAt: expiry(ttl)}
+	return nil
+}
+
+func (s *memoryTokenStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.revoked[jti]
+	return ok && !e.expired(time.Now()), nil
+}
+
+func (s *memoryTokenStore) SaveRefresh(_ context.Context, family, jti string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.families[family] = memoryEntry{value: jti, expiresAt: expiry(ttl)}
+	return nil
+}
+
+func (s *memoryTokenStore) ConsumeRefresh(_ context.Context, family, jti string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.families[family]
+	if !ok || e.expired(time.Now()) {
+		return "", nil
+	}
+	if e.value == jti {
+		s.families[family] = memoryEntry{value: consumedRefresh, expiresAt: e.expiresAt}
+	}
+	return e.value, nil
+}
+
+func (s *memoryTokenStore) RevokeRefreshFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.families, family)
+	return nil
+}
+
+func (s *memoryTokenStore) RevokeUser(_ context.Context, username string, at time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.users[username] = memoryEntry{value: strconv.FormatInt(at.Unix(), 10), expiresAt: expiry(ttl)}
+	return nil
+}
+
+func (s *memoryTokenStore) UserRevokedAt(_ context.Context, username string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.users[username]
+	if !ok || e.expired(time.Now()) {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// sweep drops expired entries, it must be called with the lock held.
+func (s *memoryTokenStore) sweep() {
+	now := time.Now()
+	for k, e := range s.revoked {
+		if e.expired(now) {
+			delete(s.revoked, k)
+		}
+	}
+	for k, e := range s.families {
+		if e.expired(now) {
+			delete(s.families, k)
+		}
+	}
+	for k, e := range s.users {
+		if e.expired(now) {
+			delete(s.users, k)
+		}
+	}
+}
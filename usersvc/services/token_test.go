@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pascallin/go-kit-application/usersvc/model"
+)
+
+func TestTokenManager(t *testing.T) {
+	ctx := context.Background()
+	keys, err := NewKeySet("", "ES256", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newManager := func() *TokenManager {
+		return NewTokenManager(NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+	}
+
+	t.Run("issue and validate", func(t *testing.T) {
+		m := newManager()
+		pair, err := m.Issue(ctx, model.Identity{Username: "pascal"}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := m.Validate(ctx, pair.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Username != "pascal" {
+			t.Fatalf("expected username pascal, got %q", claims.Username)
+		}
+		if _, err := m.Validate(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected refresh token to be rejected as access token, got %v", err)
+		}
+	})
+
+	t.Run("refresh rotation and reuse detection", func(t *testing.T) {
+		m := newManager()
+		first, _ := m.Issue(ctx, model.Identity{Username: "pascal"}, "")
+		claims, err := m.Redeem(ctx, first.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := m.Issue(ctx, model.Identity{Username: claims.Username}, claims.Family)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Redeem(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+		}
+		// the reuse revoked the whole family, including the rotated token
+		if _, err := m.Redeem(ctx, second.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		m := newManager()
+		pair, _ := m.Issue(ctx, model.Identity{Username: "pascal"}, "")
+		if err := m.Revoke(ctx, pair.AccessToken, pair.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Validate(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+		if _, err := m.Redeem(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+	})
+
+	t.Run("revoke user", func(t *testing.T) {
+		m := newManager()
+		pair, _ := m.Issue(ctx, model.Identity{Username: "pascal"}, "")
+		other, _ := m.Issue(ctx, model.Identity{Username: "lin"}, "")
+		// as if the tokens had been issued a second before
+		if err := m.store.RevokeUser(ctx, "pascal", time.Now().Add(time.Second), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Validate(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+		if _, err := m.Redeem(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+		if _, err := m.Validate(ctx, other.AccessToken); err != nil {
+			t.Fatalf("expected the tokens of another user kept, got %v", err)
+		}
+
+		// tokens issued right after the revocation are valid
+		if err := m.RevokeUser(ctx, "lin"); err != nil {
+			t.Fatal(err)
+		}
+		fresh, _ := m.Issue(ctx, model.Identity{Username: "lin"}, "")
+		if _, err := m.Validate(ctx, fresh.AccessToken); err != nil {
+			t.Fatalf("expected a token issued after the revocation valid, got %v", err)
+		}
+	})
+
+	t.Run("foreign signature", func(t *testing.T) {
+		otherKeys, _ := NewKeySet("", "ES256", time.Hour)
+		other := NewTokenManager(NewMemoryTokenStore(), otherKeys, time.Hour, 24*time.Hour)
+		pair, _ := other.Issue(ctx, model.Identity{Username: "pascal"}, "")
+		if _, err := newManager().Validate(ctx, pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1
+	key := []byte("12345678901234567890")
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		if code := hotp(key, tc.unix/30, 8); code != tc.code {
+			t.Errorf("%d: expected %s, got %s", tc.unix, tc.code, code)
+		}
+	}
+}
+
+func TestTOTPValidate(t *testing.T) {
+	totp := TOTP{Issuer: "test", Skew: 1}
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+
+	step, ok := totp.Validate(secret, "005924", now)
+	if !ok || step != 1234567890/30 {
+		t.Fatalf("expected the current code to be valid, got %d %v", step, ok)
+	}
+	// one step of drift either way is tolerated, two are not
+	if _, ok := totp.Validate(secret, "005924", now.Add(30*time.Second)); !ok {
+		t.Error("expected the previous step to be valid")
+	}
+	if _, ok := totp.Validate(secret, "005924", now.Add(-30*time.Second)); !ok {
+		t.Error("expected the next step to be valid")
+	}
+	if _, ok := totp.Validate(secret, "005924", now.Add(time.Minute)); ok {
+		t.Error("expected a code two steps old to be invalid")
+	}
+	if _, ok := totp.Validate(secret, "00592", now); ok {
+		t.Error("expected a short code to be invalid")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	totp := TOTP{Issuer: "go kit"}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := totp.URI("pascal", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/go%20kit:pascal?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes", recoveryCodeCount)
+	}
+	if hashRecoveryCode(" "+strings.ToUpper(codes[0])+" ") != hashes[0] {
+		t.Error("expected recovery codes to be case and space insensitive")
+	}
+}
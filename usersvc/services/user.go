@@ -2,14 +2,16 @@ package services
 
 import (
 	"context"
-	"crypto/md5"
-	"errors"
-	"fmt"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/pascallin/go-kit-application/config"
+	"github.com/go-kit/log/level"
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
 	"github.com/pascallin/go-kit-application/usersvc/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,34 +20,108 @@ import (
 )
 
 var (
-	ErrWrongPassword           = errors.New("wrong password")
-	ErrExistedUsername         = errors.New("username existed")
-	ErrWrongUsernameOrPassword = errors.New("username or password not match")
-	ErrUpdatePasswordFailed    = errors.New("update password fail")
+	ErrExistedUsername         = pkg.NewError(pkg.KindAlreadyExists, "username_existed", "username existed")
+	ErrWrongUsernameOrPassword = pkg.NewError(pkg.KindUnauthenticated, "wrong_username_or_password", "username or password not match")
+	ErrUpdatePasswordFailed    = pkg.NewError(pkg.KindInternal, "update_password_failed", "update password fail")
+	ErrUserNotFound            = pkg.NewError(pkg.KindNotFound, "user_not_found", "user not found")
+	ErrUnknownRole             = pkg.NewError(pkg.KindInvalidArgument, "unknown_role", "unknown role")
+	ErrInvalidCursor           = pkg.NewError(pkg.KindInvalidArgument, "invalid_cursor", "invalid cursor")
+	ErrInvalidSort             = pkg.NewError(pkg.KindInvalidArgument, "invalid_sort", "invalid sort order")
+	ErrInvalidEmail            = pkg.NewError(pkg.KindInvalidArgument, "invalid_email", "invalid email")
+	ErrExistedEmail            = pkg.NewError(pkg.KindAlreadyExists, "email_existed", "email existed")
 )
 
 type IUserService interface {
-	Register(ctx context.Context, username, password, nickname string) (primitive.ObjectID, error)
-	Login(ctx context.Context, username string, password string) (token string, err error)
+	Register(ctx context.Context, username, password, nickname, email string) (primitive.ObjectID, error)
+	Login(ctx context.Context, username string, password string) (model.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (model.TokenPair, error)
 	UpdatePassword(ctx context.Context, username, password, newPassword string) error
+	GrantRole(ctx context.Context, username, role string) error
+	RevokeRole(ctx context.Context, username, role string) error
+	GetUser(ctx context.Context, username string) (model.User, error)
+	ListUsers(ctx context.Context, query model.ListUsersQuery) (model.UserPage, error)
+	UpdateProfile(ctx context.Context, username, nickname string) (model.User, error)
+	DeleteUser(ctx context.Context, username string) error
+	UnlockUser(ctx context.Context, username string) error
+	EnrollMFA(ctx context.Context, username string) (model.MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, username, code string) (recoveryCodes []string, err error)
+	VerifyMFA(ctx context.Context, challenge, code string) (model.TokenPair, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
 }
 
 type UserService struct {
-	db     *mongo.Database
-	logger log.Logger
+	db       *mongo.Database
+	hasher   PasswordHasher
+	tokens   *TokenManager
+	guard    *LoginGuard
+	totp     TOTP
+	accounts *AccountTokens
+	notifier Notifier
+	policy   PasswordPolicy
+	logger   log.Logger
+	// background tracks the password reset emails still being sent
+	background *sync.WaitGroup
 }
 
-func NewUserService(db *mongo.Database, logger log.Logger) IUserService {
+func NewUserService(db *mongo.Database, hasher PasswordHasher, tokens *TokenManager, guard *LoginGuard, totp TOTP, accounts *AccountTokens, notifier Notifier, policy PasswordPolicy, logger log.Logger) IUserService {
 	return UserService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		hasher:     hasher,
+		tokens:     tokens,
+		guard:      guard,
+		totp:       totp,
+		accounts:   accounts,
+		notifier:   notifier,
+		policy:     policy,
+		logger:     logger,
+		background: &sync.WaitGroup{},
 	}
 }
 
 type User struct {
-	Username string `bson:"username" json:"username"`
-	Nickname string `bson:"nickname" json:"nickname"`
-	Password string `bson:"password" json:"password"`
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username string             `bson:"username" json:"username"`
+	Nickname string             `bson:"nickname" json:"nickname"`
+	Password string             `bson:"password" json:"password"`
+	// PasswordHistory holds the hashes of the previous passwords, newest last
+	PasswordHistory []string `bson:"password_history,omitempty" json:"-"`
+	Email           string   `bson:"email,omitempty" json:"email,omitempty"`
+	// EmailVerified is set once the user followed the verification link
+	EmailVerified bool     `bson:"email_verified" json:"email_verified"`
+	Roles         []string `bson:"roles" json:"roles"`
+	// Permissions are granted directly, on top of the ones of the roles
+	Permissions []string `bson:"permissions,omitempty" json:"permissions,omitempty"`
+	// DeletedAt is set when the user is deleted, the document is kept so the
+	// username stays taken, but the user can no longer log in
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	MFA       *UserMFA   `bson:"mfa,omitempty" json:"-"`
+}
+
+// activeUser filters the user named username, unless deleted.
+func activeUser(username string) bson.M {
+	return bson.M{"username": username, "deleted_at": bson.M{"$exists": false}}
+}
+
+func (u User) profile() model.User {
+	return model.User{
+		ID:            u.ID.Hex(),
+		Username:      u.Username,
+		Nickname:      u.Nickname,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Roles:         u.Roles,
+		CreatedAt:     u.ID.Timestamp(),
+	}
+}
+
+func (u User) identity() model.Identity {
+	return model.Identity{
+		Username:    u.Username,
+		Roles:       u.Roles,
+		Permissions: model.EffectivePermissions(u.Roles, u.Permissions),
+	}
 }
 
 func (s UserService) findUserByUserName(ctx context.Context, username string) (user *User, err error) {
@@ -62,39 +138,76 @@ func (s UserService) findUserByUserName(ctx context.Context, username string) (u
 	return user, nil
 }
 
-func (s UserService) Login(ctx context.Context, username string, password string) (token string, err error) {
+func (s UserService) Login(ctx context.Context, username string, password string) (model.TokenPair, error) {
+	ip := middleware.ClientIPFromContext(ctx)
+	if err := s.guard.Attempt(ctx, username, ip); err != nil {
+		return model.TokenPair{}, err
+	}
+
 	user, err := s.findUserByUserName(ctx, username)
 	if err != nil {
-		return "", err
+		return model.TokenPair{}, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		// unknown usernames count too, so they cannot be told apart
+		s.dummyHash(password)
+		return model.TokenPair{}, ErrWrongUsernameOrPassword
 	}
 
-	p := md5.Sum([]byte(password))
+	ok, err := s.hasher.Verify(user.Password, password)
+	if err != nil {
+		level.Error(s.logger).Log("method", "Login", "username", username, "err", err)
+	}
+	if !ok {
+		return model.TokenPair{}, ErrWrongUsernameOrPassword
+	}
+	s.upgradePasswordHash(ctx, user, password)
 
-	if user.Password != fmt.Sprintf("%x", p) {
-		return "", ErrWrongPassword
+	if user.MFA != nil && user.MFA.Enabled {
+		if err := s.guard.Passed(ctx, username, ip); err != nil {
+			level.Error(s.logger).Log("method", "Login", "during", "reset attempts", "err", err)
+		}
+		challenge, err := s.tokens.IssueChallenge(ctx, user.Username)
+		if err != nil {
+			return model.TokenPair{}, err
+		}
+		return model.TokenPair{MFAChallenge: challenge}, nil
+	}
+	if err := s.guard.Succeeded(ctx, username, ip); err != nil {
+		level.Error(s.logger).Log("method", "Login", "during", "reset attempts", "err", err)
 	}
 
-	claims := model.CustomerClaims{
-		Username: user.Username,
-		StandardClaims: jwt.StandardClaims{
-			Audience:  "",
-			ExpiresAt: time.Now().Add(3600 * time.Second).Unix(),
-			Id:        "",
-			IssuedAt:  0,
-			Issuer:    "",
-			NotBefore: 0,
-			Subject:   "",
-		},
+	return s.tokens.Issue(ctx, user.identity(), "")
+}
+
+// Refresh exchanges a refresh token for a new token pair, rotating the refresh
+// token. The user is looked up again, so removed users cannot refresh.
+func (s UserService) Refresh(ctx context.Context, refreshToken string) (model.TokenPair, error) {
+	claims, err := s.tokens.Redeem(ctx, refreshToken)
+	if err != nil {
+		return model.TokenPair{}, err
 	}
-	gentoken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := gentoken.SignedString([]byte(config.GetAppSecretConfig().JwtSecret))
+	user, err := s.findUserByUserName(ctx, claims.Username)
 	if err != nil {
-		return "", errors.New("generate token error: " + err.Error())
+		return model.TokenPair{}, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return model.TokenPair{}, ErrInvalidToken
 	}
-	return tokenString, nil
+	return s.tokens.Issue(ctx, user.identity(), claims.Family)
 }
 
-func (s UserService) Register(ctx context.Context, username, password, nickname string) (id primitive.ObjectID, err error) {
+// Register creates a user. The email is optional, when given it must be
+// unique, and a verification link is sent to it.
+func (s UserService) Register(ctx context.Context, username, password, nickname, email string) (id primitive.ObjectID, err error) {
+	if email != "" {
+		if email, err = normalizeEmail(email); err != nil {
+			return primitive.NilObjectID, err
+		}
+	}
+	if err := s.policy.Validate("password", username, password); err != nil {
+		return primitive.NilObjectID, err
+	}
 	existUser, err := s.findUserByUserName(ctx, username)
 
 	if err != nil {
@@ -103,49 +216,302 @@ func (s UserService) Register(ctx context.Context, username, password, nickname
 	if existUser != nil {
 		return primitive.NilObjectID, ErrExistedUsername
 	}
-	p := md5.Sum([]byte(password))
+	if email != "" {
+		n, err := s.db.Collection("users").CountDocuments(ctx, bson.M{"email": email})
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		if n > 0 {
+			return primitive.NilObjectID, ErrExistedEmail
+		}
+	}
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
 	insertResult, err := s.db.Collection("users").InsertOne(ctx, User{
-		username,
-		nickname,
-		fmt.Sprintf("%x", p),
+		Username: username,
+		Nickname: nickname,
+		Password: hashed,
+		Email:    email,
+		Roles:    []string{model.RoleUser},
 	})
 	if err != nil {
-		s.logger.Log("err", err)
+		level.Error(s.logger).Log("err", err)
 		return primitive.NilObjectID, err
 	}
 
 	id = insertResult.InsertedID.(primitive.ObjectID)
+	if email != "" {
+		// the user exists by now, a verification link can be sent again later
+		if err := s.sendEmailVerification(ctx, username, email); err != nil {
+			level.Error(s.logger).Log("method", "Register", "during", "email verification", "err", err)
+		}
+	}
 	return id, nil
 }
 
 func (s UserService) UpdatePassword(ctx context.Context, username, password, newPassword string) (err error) {
-	var user User
-	p := md5.Sum([]byte(password))
-	err = s.db.Collection("users").
-		FindOne(ctx, bson.M{
-			"username": username,
-			"password": fmt.Sprintf("%x", p),
-		}).Err()
+	// the current password is checked like a login, so that changing it is
+	// no way around the lockout
+	ip := middleware.ClientIPFromContext(ctx)
+	if err := s.guard.Attempt(ctx, username, ip); err != nil {
+		return err
+	}
+	existUser, err := s.findUserByUserName(ctx, username)
+	if err != nil {
+		return ErrUpdatePasswordFailed
+	}
+	if existUser == nil || existUser.DeletedAt != nil {
+		s.dummyHash(password)
+		return ErrWrongUsernameOrPassword
+	}
+	ok, err := s.hasher.Verify(existUser.Password, password)
+	if err != nil {
+		level.Error(s.logger).Log("method", "UpdatePassword", "username", username, "err", err)
+	}
+	if !ok {
+		return ErrWrongUsernameOrPassword
+	}
+	if err := s.guard.Succeeded(ctx, username, ip); err != nil {
+		level.Error(s.logger).Log("method", "UpdatePassword", "during", "reset attempts", "err", err)
+	}
+	if err := s.policy.Validate("new_password", username, newPassword); err != nil {
+		return err
+	}
+	if s.reusedPassword(existUser, newPassword) {
+		return reusedPasswordError("new_password")
+	}
+	hashed, err := s.hasher.Hash(newPassword)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return ErrWrongUsernameOrPassword
-		}
 		return ErrUpdatePasswordFailed
 	}
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	np := md5.Sum([]byte(newPassword))
+	var user User
 	after := options.After
 	err = s.db.Collection("users").
 		FindOneAndUpdate(ctx,
-			bson.M{"username": username},
-			bson.M{"$set": bson.M{"password": fmt.Sprintf("%x", np)}},
+			activeUser(username),
+			s.passwordUpdate(existUser, hashed),
+			&options.FindOneAndUpdateOptions{
+				ReturnDocument: &after,
+			},
+		).Decode(&user)
+	if err != nil {
+		level.Error(s.logger).Log("method", "UpdatePassword", "username", username, "err", err)
+		return ErrUpdatePasswordFailed
+	}
+	// whoever knew the old password is logged out
+	if err := s.tokens.RevokeUser(ctx, username); err != nil {
+		level.Error(s.logger).Log("method", "UpdatePassword", "during", "revoke tokens", "err", err)
+	}
+	return nil
+}
+
+// GrantRole adds role to the roles of a user. It takes effect on the tokens
+// issued from then on, including refreshed ones.
+func (s UserService) GrantRole(ctx context.Context, username, role string) error {
+	if _, ok := model.Roles[role]; !ok {
+		return ErrUnknownRole
+	}
+	return s.updateRoles(ctx, username, bson.M{"$addToSet": bson.M{"roles": role}})
+}
+
+// RevokeRole removes role from the roles of a user.
+func (s UserService) RevokeRole(ctx context.Context, username, role string) error {
+	if _, ok := model.Roles[role]; !ok {
+		return ErrUnknownRole
+	}
+	return s.updateRoles(ctx, username, bson.M{"$pull": bson.M{"roles": role}})
+}
+
+func (s UserService) updateRoles(ctx context.Context, username string, update bson.M) error {
+	result, err := s.db.Collection("users").UpdateOne(ctx, activeUser(username), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s UserService) GetUser(ctx context.Context, username string) (model.User, error) {
+	var user User
+	err := s.db.Collection("users").FindOne(ctx, activeUser(username)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return model.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	return user.profile(), nil
+}
+
+// userCursor is the position after the last user of a page, in sort order.
+// Users are ordered by _id after the sort key, so the order is total.
+type userCursor struct {
+	Username string             `json:"u,omitempty"`
+	ID       primitive.ObjectID `json:"id"`
+}
+
+func (c userCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeUserCursor(s string) (userCursor, error) {
+	var c userCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID.IsZero() {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ListUsers returns a page of the users not deleted, optionally only the ones
+// whose username starts with UsernamePrefix, sorted by username or creation
+// time.
+func (s UserService) ListUsers(ctx context.Context, query model.ListUsersQuery) (model.UserPage, error) {
+	if query.SortBy == "" {
+		query.SortBy = model.SortByCreatedAt
+	}
+	if query.SortBy != model.SortByUsername && query.SortBy != model.SortByCreatedAt {
+		return model.UserPage{}, ErrInvalidSort
+	}
+	if query.Limit <= 0 {
+		query.Limit = model.DefaultPageSize
+	}
+	if query.Limit > model.MaxPageSize {
+		query.Limit = model.MaxPageSize
+	}
+
+	direction, after := 1, "$gt"
+	if query.Descending {
+		direction, after = -1, "$lt"
+	}
+	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
+	if query.UsernamePrefix != "" {
+		filter["username"] = bson.M{"$regex": "^" + regexp.QuoteMeta(query.UsernamePrefix)}
+	}
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if query.SortBy == model.SortByUsername {
+		sort = bson.D{{Key: "username", Value: direction}, {Key: "_id", Value: direction}}
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeUserCursor(query.Cursor)
+		if err != nil {
+			return model.UserPage{}, err
+		}
+		if query.SortBy == model.SortByUsername {
+			filter["$or"] = bson.A{
+				bson.M{"username": bson.M{after: cursor.Username}},
+				bson.M{"username": cursor.Username, "_id": bson.M{after: cursor.ID}},
+			}
+		} else {
+			filter["_id"] = bson.M{after: cursor.ID}
+		}
+	}
+
+	// fetch one more user than asked to know whether there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(int64(query.Limit + 1))
+	cur, err := s.db.Collection("users").Find(ctx, filter, opts)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+	var users []User
+	if err := cur.All(ctx, &users); err != nil {
+		return model.UserPage{}, err
+	}
+
+	page := model.UserPage{Users: make([]model.User, 0, len(users))}
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+		last := users[len(users)-1]
+		next := userCursor{ID: last.ID}
+		if query.SortBy == model.SortByUsername {
+			next.Username = last.Username
+		}
+		page.NextCursor = next.encode()
+	}
+	for _, user := range users {
+		page.Users = append(page.Users, user.profile())
+	}
+	return page, nil
+}
+
+func (s UserService) UpdateProfile(ctx context.Context, username, nickname string) (model.User, error) {
+	var user User
+	after := options.After
+	err := s.db.Collection("users").
+		FindOneAndUpdate(ctx,
+			activeUser(username),
+			bson.M{"$set": bson.M{"nickname": nickname}},
 			&options.FindOneAndUpdateOptions{
 				ReturnDocument: &after,
 			},
 		).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return model.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	return user.profile(), nil
+}
+
+// DeleteUser soft deletes a user, and revokes the access and refresh tokens
+// issued to it.
+func (s UserService) DeleteUser(ctx context.Context, username string) error {
+	result, err := s.db.Collection("users").UpdateOne(ctx,
+		activeUser(username),
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+	)
 	if err != nil {
-		return errors.New("update password fail: " + err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	if err := s.tokens.RevokeUser(ctx, username); err != nil {
+		level.Error(s.logger).Log("method", "DeleteUser", "during", "revoke tokens", "err", err)
 	}
 	return nil
 }
+
+// UnlockUser clears the failed logins of a user, lifting a lockout.
+func (s UserService) UnlockUser(ctx context.Context, username string) error {
+	return s.guard.Unlock(ctx, username)
+}
+
+// dummyHash hashes the password of an unknown user and throws the hash
+// away, so that the user takes as long to be rejected as a wrong password.
+func (s UserService) dummyHash(password string) {
+	if _, err := s.hasher.Hash(password); err != nil {
+		level.Error(s.logger).Log("during", "dummy hash", "err", err)
+	}
+}
+
+// upgradePasswordHash re-hashes a just verified password with the configured
+// algorithm when the stored hash is a legacy or outdated one. The login has
+// already succeeded at this point, so failures are only logged.
+func (s UserService) upgradePasswordHash(ctx context.Context, user *User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		level.Error(s.logger).Log("method", "Login", "during", "rehash", "err", err)
+		return
+	}
+	// match on the old hash, so a concurrent password change is never overwritten
+	_, err = s.db.Collection("users").UpdateOne(ctx,
+		bson.M{"username": user.Username, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hashed}},
+	)
+	if err != nil {
+		level.Error(s.logger).Log("method", "Login", "during", "rehash", "err", err)
+	}
+}
@@ -5,31 +5,61 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pascallin/go-kit-application/config"
+	"github.com/pascallin/go-kit-application/usersvc/model"
 )
 
 func TestUserService(t *testing.T) {
 	logger := log.NewLogfmtLogger(os.Stderr)
+	hasher := passwordHasher{primary: BcryptHasher{Cost: bcrypt.MinCost}}
+	keys, err := NewKeySet("", "ES256", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := NewTokenManager(NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+	totp := TOTP{Issuer: "test", Skew: 1}
+	accountConfig := config.AccountConfig{AccountURL: "http://localhost", ResetTokenTTL: time.Hour, VerifyTokenTTL: time.Hour}
+	notifier := &fakeNotifier{}
+	policy := PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        72,
+		RequireLower:     true,
+		RequireUpper:     true,
+		RequireDigit:     true,
+		DisallowUsername: true,
+		DisallowCommon:   true,
+		History:          3,
+	}
 
 	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
 
 	mt.Run("login succeed", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		docs := bson.D{
-			{Key: "_id", Value: "123"},
+			{Key: "_id", Value: primitive.NewObjectID()},
 			{Key: "username", Value: "pascal"},
 			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
 			{Key: "Nickname", Value: "lin"},
 		}
 
 		mt.AddMockResponses(mtest.CreateCursorResponse(1, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
+		killCursors := mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.NextBatch)
+		// legacy md5 hash gets upgraded after a successful login
+		update := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		mt.AddMockResponses(killCursors, update)
 
 		token, err := svc.Login(context.Background(), "pascal", "foobar")
 		if err != nil {
@@ -38,28 +68,45 @@ func TestUserService(t *testing.T) {
 		t.Log(token)
 	})
 
+	mt.Run("login with unknown username", func(mt *mtest.T) {
+		db := mt.DB
+		hasher := &countingHasher{PasswordHasher: hasher}
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch))
+
+		_, err := svc.Login(context.Background(), "nobody", "foobar")
+		if !errors.Is(err, ErrWrongUsernameOrPassword) {
+			t.Fatalf("expected ErrWrongUsernameOrPassword, got %v", err)
+		}
+		if hasher.hashed != 1 {
+			t.Fatalf("expected the password hashed anyway, hashed %d times", hasher.hashed)
+		}
+	})
+
 	mt.Run("login with wrong password", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		docs := bson.D{
-			{Key: "_id", Value: "123"},
+			{Key: "_id", Value: primitive.NewObjectID()},
 			{Key: "username", Value: "pascal"},
-			{Key: "password", Value: "fake"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
 			{Key: "Nickname", Value: "lin"},
 		}
 
 		mt.AddMockResponses(mtest.CreateCursorResponse(1, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
 
-		_, err := svc.Login(context.Background(), "pascal", "foobar")
-		if err != nil && !errors.Is(err, ErrWrongPassword) {
-			t.Fatalf("expected ErrWrongPassword")
+		// the same error as an unknown username
+		_, err := svc.Login(context.Background(), "pascal", "wrong")
+		if !errors.Is(err, ErrWrongUsernameOrPassword) {
+			t.Fatalf("expected ErrWrongUsernameOrPassword, got %v", err)
 		}
 	})
 
 	mt.Run("register succeed", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		find := mtest.CreateCursorResponse(1, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch)
 		killCursors := mtest.CreateCursorResponse(
@@ -71,7 +118,7 @@ func TestUserService(t *testing.T) {
 			killCursors,
 		)
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		id, err := svc.Register(context.Background(), "pascal", "foobar", "lin")
+		id, err := svc.Register(context.Background(), "pascal", "Secret-2021", "lin", "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -80,10 +127,10 @@ func TestUserService(t *testing.T) {
 
 	mt.Run("register error with existed user", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		docs := bson.D{
-			{Key: "_id", Value: "123"},
+			{Key: "_id", Value: primitive.NewObjectID()},
 			{Key: "username", Value: "pascal"},
 			{Key: "password", Value: "fake"},
 			{Key: "Nickname", Value: "lin"},
@@ -91,7 +138,7 @@ func TestUserService(t *testing.T) {
 		mt.AddMockResponses(mtest.CreateCursorResponse(1, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
 
-		_, err := svc.Register(context.Background(), "pascal", "foobar", "lin")
+		_, err := svc.Register(context.Background(), "pascal", "Secret-2021", "lin", "")
 		if err != nil && !errors.Is(err, ErrExistedUsername) {
 			t.Fatalf("expected ErrExistedUsername")
 		}
@@ -99,10 +146,11 @@ func TestUserService(t *testing.T) {
 
 	mt.Run("update password succeed", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		tokens := NewTokenManager(NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		docs := bson.D{
-			{Key: "_id", Value: "123"},
+			{Key: "_id", Value: primitive.NewObjectID()},
 			{Key: "username", Value: "pascal"},
 			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
 			{Key: "Nickname", Value: "lin"},
@@ -121,15 +169,38 @@ func TestUserService(t *testing.T) {
 			{Key: "value", Value: docs},
 		}...))
 
-		err := svc.UpdatePassword(context.Background(), "pascal", "foobar", "foo")
+		err := svc.UpdatePassword(context.Background(), "pascal", "foobar", "Secret-2021")
 		if err != nil {
 			t.Fatal(err)
 		}
+		if at, _ := tokens.store.UserRevokedAt(context.Background(), "pascal"); at.IsZero() {
+			t.Fatal("expected the tokens of the user revoked")
+		}
+	})
+
+	mt.Run("update password failing to save", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		docs := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+		}
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs))
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted at shutdown"}))
+
+		// the cause is logged, not returned
+		err := svc.UpdatePassword(context.Background(), "pascal", "foobar", "Secret-2021")
+		if err != ErrUpdatePasswordFailed {
+			t.Fatalf("expected ErrUpdatePasswordFailed, got %v", err)
+		}
 	})
 
 	mt.Run("update password with wrong password", func(mt *mtest.T) {
 		db := mt.DB
-		svc := NewUserService(db, logger)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
 
 		find := mtest.CreateCursorResponse(1, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch)
 		killCursors := mtest.CreateCursorResponse(
@@ -147,4 +218,579 @@ func TestUserService(t *testing.T) {
 		}
 	})
 
+	mt.Run("update password locks out after wrong passwords", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		user := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+		}
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		for i := 0; i < 3; i++ {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user))
+			err := svc.UpdatePassword(context.Background(), "pascal", "fake", "Secret-2021")
+			if !errors.Is(err, ErrWrongUsernameOrPassword) {
+				t.Fatalf("attempt %d: expected ErrWrongUsernameOrPassword, got %v", i+1, err)
+			}
+		}
+		// no mock response, the user is not even looked up
+		err := svc.UpdatePassword(context.Background(), "pascal", "foobar", "Secret-2021")
+		if !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+		_, err = svc.Login(context.Background(), "pascal", "foobar")
+		if !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("expected the logins locked too, got %v", err)
+		}
+	})
+
+	mt.Run("register with a weak password", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		_, err := svc.Register(context.Background(), "pascal", "pascal", "lin", "")
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("expected a ValidationError, got %v", err)
+		}
+		codes := map[string]bool{}
+		for _, v := range verr.Violations {
+			if v.Field != "password" {
+				t.Fatalf("expected violations of password, got %s", v.Field)
+			}
+			codes[v.Code] = true
+		}
+		for _, code := range []string{ViolationTooShort, ViolationMissingUpper, ViolationMissingDigit, ViolationContainsName} {
+			if !codes[code] {
+				t.Fatalf("expected %s in %v", code, verr.Violations)
+			}
+		}
+	})
+
+	mt.Run("update password reusing a previous password", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		previous, err := hasher.Hash("Secret-2020")
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+			{Key: "password_history", Value: bson.A{previous}},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
+		err = svc.UpdatePassword(context.Background(), "pascal", "foobar", "Secret-2020")
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Violations[0].Code != ViolationReusedPassword {
+			t.Fatalf("expected a reused password violation, got %v", err)
+		}
+	})
+
+	mt.Run("update password keeps the history", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		docs := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: docs}),
+		)
+		mt.ClearEvents()
+		if err := svc.UpdatePassword(context.Background(), "pascal", "foobar", "Secret-2021"); err != nil {
+			t.Fatal(err)
+		}
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("update").Document()
+		push := update.Lookup("$push", "password_history").Document()
+		if slice := push.Lookup("$slice").Int32(); slice != -2 {
+			t.Fatalf("expected to keep the last 2 hashes, got %d", slice)
+		}
+		if old := push.Lookup("$each").Array().Index(0).Value().StringValue(); old != "3858f62230ac3c915f300c664312c63f" {
+			t.Fatalf("expected the replaced hash to be pushed, got %s", old)
+		}
+	})
+
+	mt.Run("grant role succeed", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		if err := svc.GrantRole(context.Background(), "pascal", "admin"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	mt.Run("grant unknown role", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		err := svc.GrantRole(context.Background(), "pascal", "root")
+		if !errors.Is(err, ErrUnknownRole) {
+			t.Fatalf("expected ErrUnknownRole, got %v", err)
+		}
+	})
+
+	mt.Run("revoke role of unknown user", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		err := svc.RevokeRole(context.Background(), "nobody", "admin")
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+	mt.Run("login of deleted user", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		hashed, _ := hasher.Hash("foobar")
+		docs := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: hashed},
+			{Key: "deleted_at", Value: time.Now()},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
+
+		_, err := svc.Login(context.Background(), "pascal", "foobar")
+		if !errors.Is(err, ErrWrongUsernameOrPassword) {
+			t.Fatalf("expected ErrWrongUsernameOrPassword, got %v", err)
+		}
+	})
+
+	mt.Run("get user succeed", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		id := primitive.NewObjectID()
+		docs := bson.D{
+			{Key: "_id", Value: id},
+			{Key: "username", Value: "pascal"},
+			{Key: "nickname", Value: "lin"},
+			{Key: "password", Value: "secret"},
+			{Key: "roles", Value: bson.A{"user"}},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, docs))
+
+		user, err := svc.GetUser(context.Background(), "pascal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != id.Hex() || user.Nickname != "lin" || !user.CreatedAt.Equal(id.Timestamp()) {
+			t.Fatalf("unexpected user %+v", user)
+		}
+	})
+
+	mt.Run("get unknown user", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch))
+
+		_, err := svc.GetUser(context.Background(), "nobody")
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	mt.Run("list users pages with a cursor", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		users := []bson.D{
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "username", Value: "pa"}},
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "username", Value: "pascal"}},
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "username", Value: "paul"}},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, users...))
+
+		page, err := svc.ListUsers(context.Background(), model.ListUsersQuery{
+			Limit:          2,
+			UsernamePrefix: "pa",
+			SortBy:         model.SortByUsername,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 2 || page.NextCursor == "" {
+			t.Fatalf("expected a full page and a next cursor, got %+v", page)
+		}
+
+		// the next page is what is after the last user of this one
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, users[2]))
+		page, err = svc.ListUsers(context.Background(), model.ListUsersQuery{
+			Cursor:         page.NextCursor,
+			Limit:          2,
+			UsernamePrefix: "pa",
+			SortBy:         model.SortByUsername,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || page.NextCursor != "" {
+			t.Fatalf("expected the last page, got %+v", page)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if _, err := filter.LookupErr("$or"); err != nil {
+			t.Fatal("expected the cursor to be part of the filter")
+		}
+	})
+
+	mt.Run("list users with invalid cursor", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		_, err := svc.ListUsers(context.Background(), model.ListUsersQuery{Cursor: "garbage"})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor, got %v", err)
+		}
+		_, err = svc.ListUsers(context.Background(), model.ListUsersQuery{SortBy: "password"})
+		if !errors.Is(err, ErrInvalidSort) {
+			t.Fatalf("expected ErrInvalidSort, got %v", err)
+		}
+	})
+
+	mt.Run("update profile succeed", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "nickname", Value: "pl"},
+		}}))
+
+		user, err := svc.UpdateProfile(context.Background(), "pascal", "pl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Nickname != "pl" {
+			t.Fatalf("expected nickname pl, got %s", user.Nickname)
+		}
+	})
+
+	mt.Run("delete user succeed", func(mt *mtest.T) {
+		db := mt.DB
+		tokens := NewTokenManager(NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		if err := svc.DeleteUser(context.Background(), "pascal"); err != nil {
+			t.Fatal(err)
+		}
+		if at, _ := tokens.store.UserRevokedAt(context.Background(), "pascal"); at.IsZero() {
+			t.Fatal("expected the tokens of the user revoked")
+		}
+	})
+
+	mt.Run("delete unknown user", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		err := svc.DeleteUser(context.Background(), "nobody")
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+	mt.Run("login of locked user", func(mt *mtest.T) {
+		db := mt.DB
+		guard := newTestLoginGuard()
+		svc := NewUserService(db, hasher, tokens, guard, totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		for i := 0; i < 3; i++ {
+			guard.Attempt(context.Background(), "pascal", "")
+		}
+		// no mock response, the user is not even looked up
+		_, err := svc.Login(context.Background(), "pascal", "foobar")
+		if !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+
+		if err := svc.UnlockUser(context.Background(), "pascal"); err != nil {
+			t.Fatal(err)
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch))
+		_, err = svc.Login(context.Background(), "pascal", "foobar")
+		if !errors.Is(err, ErrWrongUsernameOrPassword) {
+			t.Fatalf("expected ErrWrongUsernameOrPassword, got %v", err)
+		}
+	})
+	mt.Run("login with mfa enabled", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		hashed, _ := hasher.Hash("foobar")
+		secret, _ := totp.GenerateSecret()
+		user := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: hashed},
+			{Key: "mfa", Value: bson.D{
+				{Key: "enabled", Value: true},
+				{Key: "secret", Value: secret},
+				{Key: "recovery_codes", Value: bson.A{hashRecoveryCode("abcdef-123456")}},
+			}},
+		}
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user))
+
+		pair, err := svc.Login(context.Background(), "pascal", "foobar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pair.MFAChallenge == "" || pair.AccessToken != "" {
+			t.Fatalf("expected an MFA challenge only, got %+v", pair)
+		}
+
+		// a wrong code leaves the challenge usable
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		_, err = svc.VerifyMFA(context.Background(), pair.MFAChallenge, "000000")
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected ErrInvalidMFACode, got %v", err)
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		tokenPair, err := svc.VerifyMFA(context.Background(), pair.MFAChallenge, "ABCDEF-123456")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokenPair.AccessToken == "" {
+			t.Fatal("expected an access token")
+		}
+
+		// the challenge is single use
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		_, err = svc.VerifyMFA(context.Background(), pair.MFAChallenge, "ABCDEF-123456")
+		if !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got %v", err)
+		}
+	})
+
+	mt.Run("enroll and confirm mfa", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "username", Value: "pascal"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		enrollment, err := svc.EnrollMFA(context.Background(), "pascal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+			t.Fatalf("unexpected uri %s", enrollment.URI)
+		}
+
+		key, _ := totpEncoding.DecodeString(enrollment.Secret)
+		code := hotp(key, time.Now().Unix()/30, totpDigits)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "username", Value: "pascal"},
+				{Key: "mfa", Value: bson.D{{Key: "pending_secret", Value: enrollment.Secret}}},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		codes, err := svc.ConfirmMFA(context.Background(), "pascal", code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(codes) != recoveryCodeCount {
+			t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+		}
+	})
+	mt.Run("register with email sends a verification link", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 0}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		if _, err := svc.Register(context.Background(), "pascal", "Secret-2021", "lin", "Pascal@Example.com"); err != nil {
+			t.Fatal(err)
+		}
+		sent := notifier.last()
+		if sent.To != "pascal@example.com" || !strings.Contains(sent.Body, "http://localhost/verify-email?token=") {
+			t.Fatalf("unexpected notification %+v", sent)
+		}
+
+		_, err := svc.Register(context.Background(), "lin", "foobar", "lin", "not an email")
+		if !errors.Is(err, ErrInvalidEmail) {
+			t.Fatalf("expected ErrInvalidEmail, got %v", err)
+		}
+	})
+
+	mt.Run("reset password with an emailed token", func(mt *mtest.T) {
+		db := mt.DB
+		tokens := NewTokenManager(NewMemoryTokenStore(), keys, time.Hour, 24*time.Hour)
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		ns := fmt.Sprintf("%s.users", mt.DB.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "username", Value: "pascal"},
+				{Key: "email", Value: "pascal@example.com"},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := svc.RequestPasswordReset(context.Background(), "pascal@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		svc.(UserService).background.Wait()
+		link := notifier.last().Body
+		token := link[strings.Index(link, "token=")+len("token="):]
+		token = token[:strings.IndexAny(token, "\n")]
+
+		tokenDoc := bson.D{
+			{Key: "purpose", Value: PurposePasswordReset},
+			{Key: "username", Value: "pascal"},
+		}
+		userDoc := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "username", Value: "pascal"},
+			{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+		}
+		tokenNS := fmt.Sprintf("%s.account_tokens", mt.DB.Name())
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, tokenNS, mtest.FirstBatch, tokenDoc),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, userDoc),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: tokenDoc}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		if err := svc.ResetPassword(context.Background(), token, "New-password-1"); err != nil {
+			t.Fatal(err)
+		}
+		if at, _ := tokens.store.UserRevokedAt(context.Background(), "pascal"); at.IsZero() {
+			t.Fatal("expected the tokens of the user revoked")
+		}
+		// only the hash of the token is looked up
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if hash := filter.Lookup("hash").StringValue(); hash != hashAccountToken(token) {
+			t.Fatalf("expected the token hash in the filter, got %s", hash)
+		}
+
+		// the token has been used
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tokenNS, mtest.FirstBatch))
+		err := svc.ResetPassword(context.Background(), token, "New-password-1")
+		if !errors.Is(err, ErrInvalidAccountToken) {
+			t.Fatalf("expected ErrInvalidAccountToken, got %v", err)
+		}
+	})
+
+	mt.Run("reset password rejected by the policy keeps the token", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, fmt.Sprintf("%s.account_tokens", mt.DB.Name()), mtest.FirstBatch, bson.D{
+				{Key: "purpose", Value: PurposePasswordReset},
+				{Key: "username", Value: "pascal"},
+			}),
+			mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "username", Value: "pascal"},
+				{Key: "password", Value: "3858f62230ac3c915f300c664312c63f"},
+			}),
+		)
+		err := svc.ResetPassword(context.Background(), "token", "weak")
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("expected ErrValidation, got %v", err)
+		}
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "findAndModify" {
+				t.Fatal("expected the token not to be redeemed")
+			}
+		}
+	})
+
+	mt.Run("request password reset of unknown email", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		before := notifier.last()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch))
+		if err := svc.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		svc.(UserService).background.Wait()
+		if notifier.last() != before {
+			t.Fatal("expected nothing to be sent")
+		}
+	})
+
+	mt.Run("request password reset failing to send", func(mt *mtest.T) {
+		db := mt.DB
+		failing := notifierFunc(func(context.Context, Notification) error { return errors.New("smtp down") })
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), failing, policy, logger)
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, fmt.Sprintf("%s.users", mt.DB.Name()), mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "username", Value: "pascal"},
+				{Key: "email", Value: "pascal@example.com"},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+		// known emails are answered like the unknown ones
+		if err := svc.RequestPasswordReset(context.Background(), "pascal@example.com"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		svc.(UserService).background.Wait()
+	})
+
+	mt.Run("verify email", func(mt *mtest.T) {
+		db := mt.DB
+		svc := NewUserService(db, hasher, tokens, newTestLoginGuard(), totp, NewAccountTokens(db, accountConfig), notifier, policy, logger)
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "purpose", Value: PurposeEmailVerification},
+				{Key: "username", Value: "pascal"},
+				{Key: "email", Value: "pascal@example.com"},
+			}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		if err := svc.VerifyEmail(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// countingHasher counts the passwords hashed by the PasswordHasher it wraps.
+type countingHasher struct {
+	PasswordHasher
+	hashed int
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashed++
+	return h.PasswordHasher.Hash(password)
 }
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/pascallin/go-kit-application/pkg"
+)
+
+// ErrValidation matches every *ValidationError with errors.Is.
+var ErrValidation = pkg.NewError(pkg.KindInvalidArgument, "validation_failed", "validation failed")
+
+// FieldViolation describes why the value of a request field was rejected.
+type FieldViolation = pkg.FieldViolation
+
+// ValidationError lists the fields of a request which were rejected.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Field+": "+v.Message)
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Unwrap returns e as a pkg.Error, for the transports to send the violations
+// along with ErrValidation.
+func (e *ValidationError) Unwrap() error {
+	return &pkg.Error{
+		Kind:    ErrValidation.Kind,
+		Code:    ErrValidation.Code,
+		Message: ErrValidation.Message,
+		Fields:  e.Violations,
+	}
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Code: code, Message: message})
+}
+
+// err returns e if any violation was added, nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -10,6 +10,6 @@ import (
 )
 
 func InitializeService(db *mongo.Database, logger log.Logger) (Service, error) {
-	wire.Build(NewService, NewUserService, NewAuthService)
+	wire.Build(NewService, NewUserService, NewAuthService, NewPasswordHasherFromConfig, NewTokenManagerFromConfig, NewTokenStore, NewKeySetFromConfig, NewLoginGuardFromConfig, NewAttemptStore, NewTOTPFromConfig, NewAccountTokensFromConfig, NewNotifierFromConfig, NewPasswordPolicyFromConfig)
 	return Service{}, nil
 }
@@ -11,11 +11,37 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+import (
+	_ "embed"
+)
+
 // Injectors from wire.go:
 
 func InitializeService(db *mongo.Database, logger log.Logger) (Service, error) {
-	iUserService := NewUserService(db, logger)
-	iAuthService := NewAuthService(logger)
+	servicesPasswordHasher, err := NewPasswordHasherFromConfig()
+	if err != nil {
+		return Service{}, err
+	}
+	tokenStore, err := NewTokenStore()
+	if err != nil {
+		return Service{}, err
+	}
+	keySet, err := NewKeySetFromConfig(logger)
+	if err != nil {
+		return Service{}, err
+	}
+	tokenManager := NewTokenManagerFromConfig(tokenStore, keySet)
+	attemptStore := NewAttemptStore(logger)
+	loginGuard := NewLoginGuardFromConfig(attemptStore)
+	totp := NewTOTPFromConfig()
+	accountTokens := NewAccountTokensFromConfig(db)
+	notifier, err := NewNotifierFromConfig(logger)
+	if err != nil {
+		return Service{}, err
+	}
+	passwordPolicy := NewPasswordPolicyFromConfig()
+	iUserService := NewUserService(db, servicesPasswordHasher, tokenManager, loginGuard, totp, accountTokens, notifier, passwordPolicy, logger)
+	iAuthService := NewAuthService(tokenManager, keySet, logger)
 	service := NewService(iUserService, iAuthService)
 	return service, nil
 }
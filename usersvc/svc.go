@@ -2,8 +2,6 @@ package usersvc
 
 import (
 	"context"
-	"fmt"
-	"net"
 	"net/http"
 
 	"github.com/go-kit/kit/log"
@@ -15,42 +13,51 @@ import (
 
 	"github.com/pascallin/go-kit-application/config"
 	"github.com/pascallin/go-kit-application/conn"
+	"github.com/pascallin/go-kit-application/middleware"
 	pb "github.com/pascallin/go-kit-application/pb/usersvc"
 	"github.com/pascallin/go-kit-application/pkg"
 	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/metrics"
 	"github.com/pascallin/go-kit-application/usersvc/services"
 	"github.com/pascallin/go-kit-application/usersvc/transports"
 )
 
-func GrpcServe(logger log.Logger) error {
-	c := config.GetUserSvcConfig()
+// NewService builds the user service. It is built once and shared by the gRPC
+// and HTTP servers, so both see the same token state, and records the
+// business metrics and the MongoDB command durations.
+func NewService(logger log.Logger) (services.Service, error) {
+	conn.SetMongoMonitor(conn.NewMongoMonitor(metrics.GetMongoMetrics()))
 	db, err := conn.GetMongo(context.Background())
 	if err != nil {
-		return err
+		return services.Service{}, err
 	}
-
-	zipkinTracer, tracer, err := pkg.InitTracer(c.Name)
+	service, err := services.InitializeService(db.DB, logger)
 	if err != nil {
-		return err
+		return services.Service{}, err
 	}
+	return services.InstrumentingMiddleware(metrics.GetServiceMetrics())(service), nil
+}
 
-	service, err := services.InitializeService(db.DB, logger)
+// NewGrpcServer builds the usersvc gRPC server, with the health service.
+func NewGrpcServer(service services.Service, health *pkg.Health, logger log.Logger) (*grpc.Server, error) {
+	c := config.GetUserSvcConfig()
+
+	tracer, err := pkg.InitTracer(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	endpoints := endpoints.New(service, logger, tracer, zipkinTracer)
-	grpcServer := transports.NewGRPCServer(endpoints, logger)
 
-	grpcAddr := fmt.Sprintf(":%d", c.GrpcPort)
-	grpcListener, err := net.Listen("tcp", grpcAddr)
+	proxies, err := config.ParseNetworks(c.TrustedProxies)
 	if err != nil {
-		logger.Log("transport", "gRPC", "during", "Listen", "err", err)
-		return err
+		return nil, err
 	}
 
-	logger.Log("transport", "gRPC", "addr", c.GrpcPort)
+	endpoints := endpoints.New(service, logger, metrics.GetEndpointMetrics().With("transport", "grpc"), tracer)
+	grpcServer := transports.NewGRPCServer(endpoints, proxies, tracer, logger)
+
 	server := grpc.NewServer(
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+			middleware.GRPCRequestID,
 			kitgrpc.Interceptor,
 			grpc_recovery.UnaryServerInterceptor(),
 		)),
@@ -58,9 +65,9 @@ func GrpcServe(logger log.Logger) error {
 
 	pb.RegisterUserServer(server, grpcServer)
 	// heath check register
-	grpc_health_v1.RegisterHealthServer(server, NewGrpHealthChecker())
+	grpc_health_v1.RegisterHealthServer(server, health.GRPCServer())
 
-	return server.Serve(grpcListener)
+	return server, nil
 }
 
 // @title user service
@@ -69,26 +76,19 @@ func GrpcServe(logger log.Logger) error {
 // @securityDefinitions.apikey  ServiceApiKey
 // @in                          header
 // @name                        x-api-key
-func HttpServe(logger log.Logger) error {
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+func NewHttpHandler(service services.Service, logger log.Logger) (http.Handler, error) {
 	c := config.GetUserSvcConfig()
-	db, err := conn.GetMongo(context.Background())
-	if err != nil {
-		return err
-	}
-
-	service, err := services.InitializeService(db.DB, logger)
+	tracer, err := pkg.InitTracer(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	httpHandler := transports.MakeHandler(service, logger)
-
-	// The HTTP listener mounts the Go kit HTTP handler we created.
-	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.HttpPort))
+	proxies, err := config.ParseNetworks(c.TrustedProxies)
 	if err != nil {
-		logger.Log("transport", "HTTP", "during", "Listen", "err", err)
-		return err
+		return nil, err
 	}
-
-	logger.Log("transport", "HTTP", "addr", fmt.Sprintf(":%d", c.HttpPort))
-	return http.Serve(httpListener, httpHandler)
+	endpoints := endpoints.New(service, logger, metrics.GetEndpointMetrics().With("transport", "http"), tracer)
+	return transports.MakeHandler(endpoints, proxies, tracer, logger), nil
 }
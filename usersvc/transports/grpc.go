@@ -2,27 +2,51 @@ package transports
 
 import (
 	"context"
-	"errors"
 
-	"github.com/go-kit/kit/transport"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/transport/grpc"
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/pascallin/go-kit-application/middleware"
 	pb "github.com/pascallin/go-kit-application/pb/usersvc"
+	"github.com/pascallin/go-kit-application/pkg"
 	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/model"
 )
 
 type grpcServer struct {
-	register       grpc.Handler
-	login          grpc.Handler
-	updatePassword grpc.Handler
-	validToken     grpc.Handler
+	register             grpc.Handler
+	login                grpc.Handler
+	updatePassword       grpc.Handler
+	validToken           grpc.Handler
+	refresh              grpc.Handler
+	logout               grpc.Handler
+	grantRole            grpc.Handler
+	revokeRole           grpc.Handler
+	getUser              grpc.Handler
+	listUsers            grpc.Handler
+	updateProfile        grpc.Handler
+	deleteUser           grpc.Handler
+	unlockUser           grpc.Handler
+	enrollMFA            grpc.Handler
+	confirmMFA           grpc.Handler
+	verifyMFA            grpc.Handler
+	requestPasswordReset grpc.Handler
+	resetPassword        grpc.Handler
+	verifyEmail          grpc.Handler
+	claims               grpc.Handler
+	jwks                 grpc.Handler
 	pb.UnimplementedUserServer
 }
 
-func NewGRPCServer(endpoints endpoints.EndpointSet, logger log.Logger) pb.UserServer {
+// NewGRPCServer makes the endpoints available as a gRPC UserServer, the
+// x-forwarded-for metadata being trusted from the proxies only.
+func NewGRPCServer(endpoints endpoints.EndpointSet, proxies middleware.TrustedProxies, tracer trace.Tracer, logger log.Logger) pb.UserServer {
 	options := []grpc.ServerOption{
-		grpc.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		grpc.ServerErrorHandler(middleware.NewLogErrorHandler(logger)),
+		grpc.ServerBefore(kitjwt.GRPCToContext(), proxies.GRPCClientIPToContext),
+		middleware.GRPCServerTrace(tracer),
 	}
 	return &grpcServer{
 		register: grpc.NewServer(
@@ -49,13 +73,115 @@ func NewGRPCServer(endpoints endpoints.EndpointSet, logger log.Logger) pb.UserSe
 			encodeGRPCValidTokenResponse,
 			options...,
 		),
+		refresh: grpc.NewServer(
+			endpoints.RefreshEndpoint,
+			decodeGRPCRefreshRequest,
+			encodeGRPCRefreshResponse,
+			options...,
+		),
+		logout: grpc.NewServer(
+			endpoints.LogoutEndpoint,
+			decodeGRPCLogoutRequest,
+			encodeGRPCLogoutResponse,
+			options...,
+		),
+		grantRole: grpc.NewServer(
+			endpoints.GrantRoleEndpoint,
+			decodeGRPCRoleRequest,
+			encodeGRPCRoleResponse,
+			options...,
+		),
+		revokeRole: grpc.NewServer(
+			endpoints.RevokeRoleEndpoint,
+			decodeGRPCRoleRequest,
+			encodeGRPCRoleResponse,
+			options...,
+		),
+		getUser: grpc.NewServer(
+			endpoints.GetUserEndpoint,
+			decodeGRPCGetUserRequest,
+			encodeGRPCGetUserResponse,
+			options...,
+		),
+		listUsers: grpc.NewServer(
+			endpoints.ListUsersEndpoint,
+			decodeGRPCListUsersRequest,
+			encodeGRPCListUsersResponse,
+			options...,
+		),
+		updateProfile: grpc.NewServer(
+			endpoints.UpdateProfileEndpoint,
+			decodeGRPCUpdateProfileRequest,
+			encodeGRPCUpdateProfileResponse,
+			options...,
+		),
+		deleteUser: grpc.NewServer(
+			endpoints.DeleteUserEndpoint,
+			decodeGRPCDeleteUserRequest,
+			encodeGRPCDeleteUserResponse,
+			options...,
+		),
+		unlockUser: grpc.NewServer(
+			endpoints.UnlockUserEndpoint,
+			decodeGRPCUnlockUserRequest,
+			encodeGRPCUnlockUserResponse,
+			options...,
+		),
+		enrollMFA: grpc.NewServer(
+			endpoints.EnrollMFAEndpoint,
+			decodeGRPCEnrollMFARequest,
+			encodeGRPCEnrollMFAResponse,
+			options...,
+		),
+		confirmMFA: grpc.NewServer(
+			endpoints.ConfirmMFAEndpoint,
+			decodeGRPCConfirmMFARequest,
+			encodeGRPCConfirmMFAResponse,
+			options...,
+		),
+		verifyMFA: grpc.NewServer(
+			endpoints.VerifyMFAEndpoint,
+			decodeGRPCVerifyMFARequest,
+			encodeGRPCVerifyMFAResponse,
+			options...,
+		),
+		requestPasswordReset: grpc.NewServer(
+			endpoints.RequestPasswordResetEndpoint,
+			decodeGRPCRequestPasswordResetRequest,
+			encodeGRPCRequestPasswordResetResponse,
+			options...,
+		),
+		resetPassword: grpc.NewServer(
+			endpoints.ResetPasswordEndpoint,
+			decodeGRPCResetPasswordRequest,
+			encodeGRPCResetPasswordResponse,
+			options...,
+		),
+		verifyEmail: grpc.NewServer(
+			endpoints.VerifyEmailEndpoint,
+			decodeGRPCVerifyEmailRequest,
+			encodeGRPCVerifyEmailResponse,
+			options...,
+		),
+		claims: grpc.NewServer(
+			endpoints.ClaimsEndpoint,
+			decodeGRPCClaimsRequest,
+			encodeGRPCClaimsResponse,
+			options...,
+		),
+		jwks: grpc.NewServer(
+			endpoints.JWKSEndpoint,
+			decodeGRPCJWKSRequest,
+			encodeGRPCJWKSResponse,
+			options...,
+		),
 	}
 }
 
 func (s *grpcServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
 	_, rep, err := s.register.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 	return rep.(*pb.RegisterResponse), nil
 }
@@ -66,18 +192,22 @@ func decodeGRPCRegisterRequest(_ context.Context, grpcReq interface{}) (interfac
 		Username: req.Username,
 		Password: req.Password,
 		Nickname: req.Nickname,
+		Email:    req.Email,
 	}, nil
 }
 
 func encodeGRPCRegisterResponse(_ context.Context, response interface{}) (interface{}, error) {
 	res := response.(endpoints.RegisterResponse)
-	return &pb.RegisterResponse{Id: res.Id, Err: res.Err}, nil
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.RegisterResponse{Id: res.Id}, nil
 }
 
 func (s *grpcServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
 	_, rep, err := s.login.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 	return rep.(*pb.LoginResponse), nil
 }
@@ -92,13 +222,16 @@ func decodeGRPCLoginRequest(_ context.Context, grpcReq interface{}) (interface{}
 
 func encodeGRPCLoginResponse(_ context.Context, response interface{}) (interface{}, error) {
 	res := response.(endpoints.LoginResponse)
-	return &pb.LoginResponse{Token: res.Token, Err: err2str(res.Err)}, nil
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.LoginResponse{Token: res.Token, RefreshToken: res.RefreshToken, ExpiresAt: res.ExpiresAt, MfaChallenge: res.MFAChallenge}, nil
 }
 
 func (s *grpcServer) UpdatePassword(ctx context.Context, req *pb.UpdatePasswordRequest) (*pb.UpdatePasswordResponse, error) {
 	_, rep, err := s.updatePassword.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 	return rep.(*pb.UpdatePasswordResponse), nil
 }
@@ -115,14 +248,17 @@ func decodeGRPCUpdatePasswordRequest(_ context.Context, grpcReq interface{}) (in
 func (s *grpcServer) ValidToken(ctx context.Context, req *pb.ValidTokenReq) (*pb.ValidTokenRes, error) {
 	_, rep, err := s.validToken.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, pkg.GRPCError(err)
 	}
 	return rep.(*pb.ValidTokenRes), nil
 }
 
 func encodeGRPCUpdatePasswordResponse(_ context.Context, response interface{}) (interface{}, error) {
 	res := response.(endpoints.UpdatePasswordResponse)
-	return &pb.UpdatePasswordResponse{Err: err2str(res.Err)}, nil
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.UpdatePasswordResponse{}, nil
 }
 
 func decodeGRPCValidTokenRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
@@ -134,19 +270,406 @@ func decodeGRPCValidTokenRequest(_ context.Context, grpcReq interface{}) (interf
 
 func encodeGRPCValidTokenResponse(_ context.Context, response interface{}) (interface{}, error) {
 	res := response.(endpoints.ValidTokenEndpointResponse)
-	return &pb.ValidTokenRes{IsValid: res.IsValid, Err: err2str(res.Err)}, nil
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.ValidTokenRes{IsValid: res.IsValid}, nil
+}
+
+func (s *grpcServer) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	_, rep, err := s.refresh.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.RefreshResponse), nil
+}
+
+func decodeGRPCRefreshRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.RefreshRequest)
+	return endpoints.RefreshRequest{
+		RefreshToken: req.RefreshToken,
+	}, nil
+}
+
+func encodeGRPCRefreshResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.RefreshResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.RefreshResponse{Token: res.Token, RefreshToken: res.RefreshToken, ExpiresAt: res.ExpiresAt}, nil
+}
+
+func (s *grpcServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	_, rep, err := s.logout.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.LogoutResponse), nil
+}
+
+func decodeGRPCLogoutRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.LogoutRequest)
+	return endpoints.LogoutRequest{
+		Token:        req.Token,
+		RefreshToken: req.RefreshToken,
+	}, nil
+}
+
+func encodeGRPCLogoutResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.LogoutResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.LogoutResponse{}, nil
+}
+
+func (s *grpcServer) GrantRole(ctx context.Context, req *pb.RoleRequest) (*pb.RoleResponse, error) {
+	_, rep, err := s.grantRole.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.RoleResponse), nil
+}
+
+func (s *grpcServer) RevokeRole(ctx context.Context, req *pb.RoleRequest) (*pb.RoleResponse, error) {
+	_, rep, err := s.revokeRole.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.RoleResponse), nil
+}
+
+func decodeGRPCRoleRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.RoleRequest)
+	return endpoints.RoleRequest{
+		Username: req.Username,
+		Role:     req.Role,
+	}, nil
+}
+
+func encodeGRPCRoleResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.RoleResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.RoleResponse{}, nil
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	_, rep, err := s.getUser.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.GetUserResponse), nil
+}
+
+func decodeGRPCGetUserRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetUserRequest)
+	return endpoints.GetUserRequest{Username: req.Username}, nil
+}
+
+func encodeGRPCGetUserResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.GetUserResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.GetUserResponse{User: user2pb(res.User)}, nil
+}
+
+func (s *grpcServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	_, rep, err := s.listUsers.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.ListUsersResponse), nil
+}
+
+func decodeGRPCListUsersRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ListUsersRequest)
+	return endpoints.ListUsersRequest{
+		Cursor:         req.Cursor,
+		Limit:          int(req.Limit),
+		UsernamePrefix: req.UsernamePrefix,
+		SortBy:         req.SortBy,
+		Descending:     req.Descending,
+	}, nil
+}
+
+func encodeGRPCListUsersResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.ListUsersResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	users := make([]*pb.UserProfile, 0, len(res.Users))
+	for _, user := range res.Users {
+		users = append(users, user2pb(user))
+	}
+	return &pb.ListUsersResponse{Users: users, NextCursor: res.NextCursor}, nil
+}
+
+func (s *grpcServer) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
+	_, rep, err := s.updateProfile.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.UpdateProfileResponse), nil
+}
+
+func decodeGRPCUpdateProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.UpdateProfileRequest)
+	return endpoints.UpdateProfileRequest{
+		Username: req.Username,
+		Nickname: req.Nickname,
+	}, nil
+}
+
+func encodeGRPCUpdateProfileResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.UpdateProfileResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.UpdateProfileResponse{User: user2pb(res.User)}, nil
+}
+
+func (s *grpcServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	_, rep, err := s.deleteUser.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.DeleteUserResponse), nil
+}
+
+func decodeGRPCDeleteUserRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.DeleteUserRequest)
+	return endpoints.DeleteUserRequest{Username: req.Username}, nil
+}
+
+func encodeGRPCDeleteUserResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.DeleteUserResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.DeleteUserResponse{}, nil
+}
+
+func (s *grpcServer) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	_, rep, err := s.unlockUser.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.UnlockUserResponse), nil
+}
+
+func decodeGRPCUnlockUserRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.UnlockUserRequest)
+	return endpoints.UnlockUserRequest{Username: req.Username}, nil
+}
+
+func encodeGRPCUnlockUserResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.UnlockUserResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.UnlockUserResponse{}, nil
+}
+
+func (s *grpcServer) EnrollMFA(ctx context.Context, req *pb.EnrollMFARequest) (*pb.EnrollMFAResponse, error) {
+	_, rep, err := s.enrollMFA.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.EnrollMFAResponse), nil
 }
 
-func str2err(s string) error {
-	if s == "" {
-		return nil
+func decodeGRPCEnrollMFARequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.EnrollMFARequest{}, nil
+}
+
+func encodeGRPCEnrollMFAResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.EnrollMFAResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.EnrollMFAResponse{Secret: res.Secret, Uri: res.URI}, nil
+}
+
+func (s *grpcServer) ConfirmMFA(ctx context.Context, req *pb.ConfirmMFARequest) (*pb.ConfirmMFAResponse, error) {
+	_, rep, err := s.confirmMFA.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.ConfirmMFAResponse), nil
+}
+
+func decodeGRPCConfirmMFARequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ConfirmMFARequest)
+	return endpoints.ConfirmMFARequest{Code: req.Code}, nil
+}
+
+func encodeGRPCConfirmMFAResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.ConfirmMFAResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.ConfirmMFAResponse{RecoveryCodes: res.RecoveryCodes}, nil
+}
+
+func (s *grpcServer) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
+	_, rep, err := s.verifyMFA.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.VerifyMFAResponse), nil
+}
+
+func decodeGRPCVerifyMFARequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.VerifyMFARequest)
+	return endpoints.VerifyMFARequest{
+		MFAChallenge: req.MfaChallenge,
+		Code:         req.Code,
+	}, nil
+}
+
+func encodeGRPCVerifyMFAResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.VerifyMFAResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.VerifyMFAResponse{Token: res.Token, RefreshToken: res.RefreshToken, ExpiresAt: res.ExpiresAt}, nil
+}
+
+func (s *grpcServer) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	_, rep, err := s.requestPasswordReset.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.RequestPasswordResetResponse), nil
+}
+
+func decodeGRPCRequestPasswordResetRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.RequestPasswordResetRequest)
+	return endpoints.RequestPasswordResetRequest{Email: req.Email}, nil
+}
+
+func encodeGRPCRequestPasswordResetResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.RequestPasswordResetResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.RequestPasswordResetResponse{}, nil
+}
+
+func (s *grpcServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	_, rep, err := s.resetPassword.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.ResetPasswordResponse), nil
+}
+
+func decodeGRPCResetPasswordRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ResetPasswordRequest)
+	return endpoints.ResetPasswordRequest{
+		Token:       req.Token,
+		NewPassword: req.NewPassword,
+	}, nil
+}
+
+func encodeGRPCResetPasswordResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.ResetPasswordResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+func (s *grpcServer) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	_, rep, err := s.verifyEmail.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.VerifyEmailResponse), nil
+}
+
+func decodeGRPCVerifyEmailRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.VerifyEmailRequest)
+	return endpoints.VerifyEmailRequest{Token: req.Token}, nil
+}
+
+func encodeGRPCVerifyEmailResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.VerifyEmailResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	return &pb.VerifyEmailResponse{}, nil
+}
+
+func (s *grpcServer) Claims(ctx context.Context, req *pb.ClaimsRequest) (*pb.ClaimsResponse, error) {
+	_, rep, err := s.claims.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.ClaimsResponse), nil
+}
+
+func decodeGRPCClaimsRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ClaimsRequest)
+	return endpoints.ClaimsRequest{Token: req.Token}, nil
+}
+
+func encodeGRPCClaimsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.ClaimsResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	if res.Claims == nil {
+		return &pb.ClaimsResponse{}, nil
+	}
+	return &pb.ClaimsResponse{
+		Username:    res.Claims.Username,
+		TokenType:   res.Claims.TokenType,
+		Roles:       res.Claims.Roles,
+		Permissions: res.Claims.Permissions,
+		Id:          res.Claims.Id,
+		Issuer:      res.Claims.Issuer,
+		Subject:     res.Claims.Subject,
+		ExpiresAt:   res.Claims.ExpiresAt,
+		IssuedAt:    res.Claims.IssuedAt,
+	}, nil
+}
+
+func (s *grpcServer) JWKS(ctx context.Context, req *pb.JWKSRequest) (*pb.JWKSResponse, error) {
+	_, rep, err := s.jwks.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, pkg.GRPCError(err)
+	}
+	return rep.(*pb.JWKSResponse), nil
+}
+
+func decodeGRPCJWKSRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.JWKSRequest{}, nil
+}
+
+func encodeGRPCJWKSResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(endpoints.JWKSResponse)
+	if res.Err != nil {
+		return nil, pkg.GRPCError(res.Err)
+	}
+	keys := make([]*pb.JWK, 0, len(res.Keys))
+	for _, k := range res.Keys {
+		keys = append(keys, &pb.JWK{Kty: k.Kty, Kid: k.Kid, Use: k.Use, Alg: k.Alg, N: k.N, E: k.E, Crv: k.Crv, X: k.X, Y: k.Y})
 	}
-	return errors.New(s)
+	return &pb.JWKSResponse{Keys: keys}, nil
 }
 
-func err2str(err error) string {
-	if err == nil {
-		return ""
+func user2pb(user model.User) *pb.UserProfile {
+	return &pb.UserProfile{
+		Id:            user.ID,
+		Username:      user.Username,
+		Nickname:      user.Nickname,
+		Roles:         user.Roles,
+		CreatedAt:     user.CreatedAt.Unix(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
 	}
-	return err.Error()
 }
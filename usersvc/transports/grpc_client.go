@@ -0,0 +1,337 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/log"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	pb "github.com/pascallin/go-kit-application/pb/usersvc"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+// NewGRPCClient returns a Service backed by a usersvc gRPC server at the other
+// end of the conn. The caller is responsible for constructing the conn, and
+// eventually closing the underlying transport. The bearer token and the
+// client address in the context are forwarded, so protected methods and login
+// throttling work as if called directly, and so is the request ID.
+func NewGRPCClient(conn *grpc.ClientConn, tracer trace.Tracer, logger log.Logger) services.Service {
+	// a single limiter for all the methods of the remote instance, and a
+	// breaker per method, following the runtime configuration of
+	// usersvc.client and usersvc.client.<method>
+	limiter := pkg.RuntimeLimiter("usersvc.client", pkg.LimitSettings{RPS: 100, Burst: 200})
+
+	options := []grpctransport.ClientOption{
+		grpctransport.ClientBefore(
+			kitjwt.ContextToGRPC(),
+			middleware.ClaimsToGRPC,
+			middleware.ClientIPToGRPC,
+			middleware.RequestIDToGRPC,
+		),
+		middleware.GRPCClientTrace(tracer),
+	}
+
+	client := func(method string, enc grpctransport.EncodeRequestFunc, dec grpctransport.DecodeResponseFunc, reply interface{}) endpoint.Endpoint {
+		var e endpoint.Endpoint
+		e = grpctransport.NewClient(conn, "pb.User", method, enc, dec, reply, options...).Endpoint()
+		e = clientErrorMiddleware(e)
+		e = pkg.RuntimeTimeout("usersvc.client."+method, 0)(e)
+		e = limiter(e)
+		e = pkg.RuntimeBreaker("usersvc.client."+method, gobreaker.Settings{
+			Name:    "usersvc." + method + "@" + conn.Target(),
+			Timeout: 30 * time.Second,
+			// rejected requests say nothing of the health of the instance
+			IsSuccessful: func(err error) bool {
+				return !pkg.IsServerError(err)
+			},
+		})(e)
+		return e
+	}
+
+	return endpoints.EndpointSet{
+		RegisterEndpoint:             client("Register", encodeGRPCRegisterRequest, decodeGRPCRegisterResponse, pb.RegisterResponse{}),
+		LoginEndpoint:                client("Login", encodeGRPCLoginRequest, decodeGRPCLoginResponse, pb.LoginResponse{}),
+		UpdatePasswordEndpoint:       client("UpdatePassword", encodeGRPCUpdatePasswordRequest, decodeGRPCUpdatePasswordResponse, pb.UpdatePasswordResponse{}),
+		ValidTokenEndpoint:           client("ValidToken", encodeGRPCValidTokenRequest, decodeGRPCValidTokenResponse, pb.ValidTokenRes{}),
+		RefreshEndpoint:              client("Refresh", encodeGRPCRefreshRequest, decodeGRPCRefreshResponse, pb.RefreshResponse{}),
+		LogoutEndpoint:               client("Logout", encodeGRPCLogoutRequest, decodeGRPCLogoutResponse, pb.LogoutResponse{}),
+		GrantRoleEndpoint:            client("GrantRole", encodeGRPCRoleRequest, decodeGRPCRoleResponse, pb.RoleResponse{}),
+		RevokeRoleEndpoint:           client("RevokeRole", encodeGRPCRoleRequest, decodeGRPCRoleResponse, pb.RoleResponse{}),
+		GetUserEndpoint:              client("GetUser", encodeGRPCGetUserRequest, decodeGRPCGetUserResponse, pb.GetUserResponse{}),
+		ListUsersEndpoint:            client("ListUsers", encodeGRPCListUsersRequest, decodeGRPCListUsersResponse, pb.ListUsersResponse{}),
+		UpdateProfileEndpoint:        client("UpdateProfile", encodeGRPCUpdateProfileRequest, decodeGRPCUpdateProfileResponse, pb.UpdateProfileResponse{}),
+		DeleteUserEndpoint:           client("DeleteUser", encodeGRPCDeleteUserRequest, decodeGRPCDeleteUserResponse, pb.DeleteUserResponse{}),
+		UnlockUserEndpoint:           client("UnlockUser", encodeGRPCUnlockUserRequest, decodeGRPCUnlockUserResponse, pb.UnlockUserResponse{}),
+		EnrollMFAEndpoint:            client("EnrollMFA", encodeGRPCEnrollMFARequest, decodeGRPCEnrollMFAResponse, pb.EnrollMFAResponse{}),
+		ConfirmMFAEndpoint:           client("ConfirmMFA", encodeGRPCConfirmMFARequest, decodeGRPCConfirmMFAResponse, pb.ConfirmMFAResponse{}),
+		VerifyMFAEndpoint:            client("VerifyMFA", encodeGRPCVerifyMFARequest, decodeGRPCVerifyMFAResponse, pb.VerifyMFAResponse{}),
+		RequestPasswordResetEndpoint: client("RequestPasswordReset", encodeGRPCRequestPasswordResetRequest, decodeGRPCRequestPasswordResetResponse, pb.RequestPasswordResetResponse{}),
+		ResetPasswordEndpoint:        client("ResetPassword", encodeGRPCResetPasswordRequest, decodeGRPCResetPasswordResponse, pb.ResetPasswordResponse{}),
+		VerifyEmailEndpoint:          client("VerifyEmail", encodeGRPCVerifyEmailRequest, decodeGRPCVerifyEmailResponse, pb.VerifyEmailResponse{}),
+		ClaimsEndpoint:               client("Claims", encodeGRPCClaimsRequest, decodeGRPCClaimsResponse, pb.ClaimsResponse{}),
+		JWKSEndpoint:                 client("JWKS", encodeGRPCJWKSRequest, decodeGRPCJWKSResponse, pb.JWKSResponse{}),
+	}.Service()
+}
+
+// clientErrorMiddleware turns the status errors made by pkg.GRPCError back
+// into the errors they were made from, so errors.Is matches the errors of
+// the services, and the validation errors into a *services.ValidationError.
+func clientErrorMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := next(ctx, request)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		return response, nil
+	}
+}
+
+func statusError(err error) error {
+	err = pkg.ErrorFromGRPC(err)
+	var e *pkg.Error
+	if errors.As(err, &e) && errors.Is(e, services.ErrValidation) && len(e.Fields) > 0 {
+		return &services.ValidationError{Violations: e.Fields}
+	}
+	return err
+}
+
+func encodeGRPCRegisterRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.RegisterRequest)
+	return &pb.RegisterRequest{Username: req.Username, Password: req.Password, Nickname: req.Nickname, Email: req.Email}, nil
+}
+
+func decodeGRPCRegisterResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.RegisterResponse)
+	return endpoints.RegisterResponse{Id: reply.Id}, nil
+}
+
+func encodeGRPCLoginRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.LoginRequest)
+	return &pb.LoginRequest{Username: req.Username, Password: req.Password}, nil
+}
+
+func decodeGRPCLoginResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.LoginResponse)
+	return endpoints.LoginResponse{Token: reply.Token, RefreshToken: reply.RefreshToken, ExpiresAt: reply.ExpiresAt, MFAChallenge: reply.MfaChallenge}, nil
+}
+
+func encodeGRPCUpdatePasswordRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.UpdatePasswordRequest)
+	return &pb.UpdatePasswordRequest{Username: req.Username, Password: req.Password, NewPassword: req.NewPassword}, nil
+}
+
+func decodeGRPCUpdatePasswordResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.UpdatePasswordResponse{}, nil
+}
+
+func encodeGRPCValidTokenRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.ValidTokenEndpointRequest)
+	return &pb.ValidTokenReq{Token: req.Token}, nil
+}
+
+func decodeGRPCValidTokenResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ValidTokenRes)
+	return endpoints.ValidTokenEndpointResponse{IsValid: reply.IsValid}, nil
+}
+
+func encodeGRPCRefreshRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.RefreshRequest)
+	return &pb.RefreshRequest{RefreshToken: req.RefreshToken}, nil
+}
+
+func decodeGRPCRefreshResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.RefreshResponse)
+	return endpoints.RefreshResponse{Token: reply.Token, RefreshToken: reply.RefreshToken, ExpiresAt: reply.ExpiresAt}, nil
+}
+
+func encodeGRPCLogoutRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.LogoutRequest)
+	return &pb.LogoutRequest{Token: req.Token, RefreshToken: req.RefreshToken}, nil
+}
+
+func decodeGRPCLogoutResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.LogoutResponse{}, nil
+}
+
+func encodeGRPCRoleRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.RoleRequest)
+	return &pb.RoleRequest{Username: req.Username, Role: req.Role}, nil
+}
+
+func decodeGRPCRoleResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.RoleResponse{}, nil
+}
+
+func encodeGRPCGetUserRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.GetUserRequest)
+	return &pb.GetUserRequest{Username: req.Username}, nil
+}
+
+func decodeGRPCGetUserResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetUserResponse)
+	return endpoints.GetUserResponse{User: pb2user(reply.User)}, nil
+}
+
+func encodeGRPCListUsersRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.ListUsersRequest)
+	return &pb.ListUsersRequest{
+		Cursor:         req.Cursor,
+		Limit:          int32(req.Limit),
+		UsernamePrefix: req.UsernamePrefix,
+		SortBy:         req.SortBy,
+		Descending:     req.Descending,
+	}, nil
+}
+
+func decodeGRPCListUsersResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ListUsersResponse)
+	users := make([]model.User, 0, len(reply.Users))
+	for _, user := range reply.Users {
+		users = append(users, pb2user(user))
+	}
+	return endpoints.ListUsersResponse{Users: users, NextCursor: reply.NextCursor}, nil
+}
+
+func encodeGRPCUpdateProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.UpdateProfileRequest)
+	return &pb.UpdateProfileRequest{Username: req.Username, Nickname: req.Nickname}, nil
+}
+
+func decodeGRPCUpdateProfileResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.UpdateProfileResponse)
+	return endpoints.UpdateProfileResponse{User: pb2user(reply.User)}, nil
+}
+
+func encodeGRPCDeleteUserRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.DeleteUserRequest)
+	return &pb.DeleteUserRequest{Username: req.Username}, nil
+}
+
+func decodeGRPCDeleteUserResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.DeleteUserResponse{}, nil
+}
+
+func encodeGRPCUnlockUserRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.UnlockUserRequest)
+	return &pb.UnlockUserRequest{Username: req.Username}, nil
+}
+
+func decodeGRPCUnlockUserResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.UnlockUserResponse{}, nil
+}
+
+func encodeGRPCEnrollMFARequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.EnrollMFARequest{}, nil
+}
+
+func decodeGRPCEnrollMFAResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.EnrollMFAResponse)
+	return endpoints.EnrollMFAResponse{Secret: reply.Secret, URI: reply.Uri}, nil
+}
+
+func encodeGRPCConfirmMFARequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.ConfirmMFARequest)
+	return &pb.ConfirmMFARequest{Code: req.Code}, nil
+}
+
+func decodeGRPCConfirmMFAResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ConfirmMFAResponse)
+	return endpoints.ConfirmMFAResponse{RecoveryCodes: reply.RecoveryCodes}, nil
+}
+
+func encodeGRPCVerifyMFARequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.VerifyMFARequest)
+	return &pb.VerifyMFARequest{MfaChallenge: req.MFAChallenge, Code: req.Code}, nil
+}
+
+func decodeGRPCVerifyMFAResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.VerifyMFAResponse)
+	return endpoints.VerifyMFAResponse{Token: reply.Token, RefreshToken: reply.RefreshToken, ExpiresAt: reply.ExpiresAt}, nil
+}
+
+func encodeGRPCRequestPasswordResetRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.RequestPasswordResetRequest)
+	return &pb.RequestPasswordResetRequest{Email: req.Email}, nil
+}
+
+func decodeGRPCRequestPasswordResetResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.RequestPasswordResetResponse{}, nil
+}
+
+func encodeGRPCResetPasswordRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.ResetPasswordRequest)
+	return &pb.ResetPasswordRequest{Token: req.Token, NewPassword: req.NewPassword}, nil
+}
+
+func decodeGRPCResetPasswordResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.ResetPasswordResponse{}, nil
+}
+
+func encodeGRPCVerifyEmailRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.VerifyEmailRequest)
+	return &pb.VerifyEmailRequest{Token: req.Token}, nil
+}
+
+func decodeGRPCVerifyEmailResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return endpoints.VerifyEmailResponse{}, nil
+}
+
+func encodeGRPCClaimsRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(endpoints.ClaimsRequest)
+	return &pb.ClaimsRequest{Token: req.Token}, nil
+}
+
+func decodeGRPCClaimsResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ClaimsResponse)
+	claims := &model.CustomerClaims{
+		Username:    reply.Username,
+		TokenType:   reply.TokenType,
+		Roles:       reply.Roles,
+		Permissions: reply.Permissions,
+	}
+	claims.Id = reply.Id
+	claims.Issuer = reply.Issuer
+	claims.Subject = reply.Subject
+	claims.ExpiresAt = reply.ExpiresAt
+	claims.IssuedAt = reply.IssuedAt
+	return endpoints.ClaimsResponse{Claims: claims}, nil
+}
+
+func encodeGRPCJWKSRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.JWKSRequest{}, nil
+}
+
+func decodeGRPCJWKSResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.JWKSResponse)
+	keys := make([]model.JWK, 0, len(reply.Keys))
+	for _, k := range reply.Keys {
+		keys = append(keys, model.JWK{Kty: k.Kty, Kid: k.Kid, Use: k.Use, Alg: k.Alg, N: k.N, E: k.E, Crv: k.Crv, X: k.X, Y: k.Y})
+	}
+	return endpoints.JWKSResponse{Keys: keys}, nil
+}
+
+func pb2user(user *pb.UserProfile) model.User {
+	if user == nil {
+		return model.User{}
+	}
+	return model.User{
+		ID:            user.Id,
+		Username:      user.Username,
+		Nickname:      user.Nickname,
+		Roles:         user.Roles,
+		CreatedAt:     time.Unix(user.CreatedAt, 0).UTC(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}
+}
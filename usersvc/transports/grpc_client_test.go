@@ -0,0 +1,143 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	pb "github.com/pascallin/go-kit-application/pb/usersvc"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/model"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+// fakeUserService implements the methods the tests call, the others panic.
+type fakeUserService struct {
+	services.IUserService
+	id primitive.ObjectID
+}
+
+func (f fakeUserService) Register(_ context.Context, username, password, nickname, email string) (primitive.ObjectID, error) {
+	return f.id, nil
+}
+
+func (f fakeUserService) Login(ctx context.Context, username, password string) (model.TokenPair, error) {
+	if middleware.ClientIPFromContext(ctx) != "203.0.113.7" {
+		return model.TokenPair{}, errors.New("client address not forwarded")
+	}
+	return model.TokenPair{}, services.ErrAccountLocked
+}
+
+func (f fakeUserService) UpdatePassword(_ context.Context, username, password, newPassword string) error {
+	return &services.ValidationError{Violations: []services.FieldViolation{
+		{Field: "new_password", Code: services.ViolationTooShort, Message: "must be at least 8 characters"},
+	}}
+}
+
+func (f fakeUserService) GetUser(_ context.Context, username string) (model.User, error) {
+	return model.User{Username: username, Roles: []string{model.RoleUser}}, nil
+}
+
+type fakeAuthService struct {
+	services.IAuthService
+}
+
+func (fakeAuthService) Claims(_ context.Context, token string) (*model.CustomerClaims, error) {
+	switch token {
+	case "reader":
+		return &model.CustomerClaims{Username: "reader", Permissions: []string{model.PermUserRead}}, nil
+	case "nobody":
+		return &model.CustomerClaims{Username: "nobody"}, nil
+	case "pascal":
+		return &model.CustomerClaims{Username: "pascal"}, nil
+	}
+	return nil, services.ErrInvalidToken
+}
+
+func newTestGRPCClient(t *testing.T) services.Service {
+	logger := log.NewNopLogger()
+	tracer := noop.NewTracerProvider().Tracer("")
+	service := services.NewService(fakeUserService{id: primitive.NewObjectID()}, fakeAuthService{})
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterUserServer(server, NewGRPCServer(endpoints.New(service, logger, middleware.NopEndpointMetrics(), tracer), nil, tracer, logger))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewGRPCClient(conn, tracer, logger)
+}
+
+func TestGRPCClient(t *testing.T) {
+	client := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	t.Run("register", func(t *testing.T) {
+		id, err := client.UserService.Register(ctx, "pascal", "Secret-2021", "lin", "")
+		if err != nil || id.IsZero() {
+			t.Fatalf("expected an id, got %v %v", id, err)
+		}
+	})
+
+	t.Run("business errors keep their identity", func(t *testing.T) {
+		ctx := middleware.ContextWithClientIP(ctx, "203.0.113.7")
+		_, err := client.UserService.Login(ctx, "pascal", "Secret-2021")
+		if !errors.Is(err, services.ErrAccountLocked) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+		if !pkg.IsRetryable(err) || pkg.HTTPStatus(err) != http.StatusLocked {
+			t.Fatalf("expected a retryable locked error, got %+v", err)
+		}
+	})
+
+	t.Run("validation errors keep their fields", func(t *testing.T) {
+		err := client.UserService.UpdatePassword(ctx, "pascal", "foobar", "short")
+		var verr *services.ValidationError
+		if !errors.As(err, &verr) || verr.Violations[0].Field != "new_password" || verr.Violations[0].Code != services.ViolationTooShort {
+			t.Fatalf("expected the new_password violation, got %v", err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"protected method without token", "", middleware.ErrUnauthenticated},
+		{"protected method without permission", "nobody", middleware.ErrForbidden},
+		{"protected method with permission", "reader", nil},
+		{"protected method on own account", "pascal", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := ctx
+			if tc.token != "" {
+				ctx = context.WithValue(ctx, kitjwt.JWTContextKey, tc.token)
+			}
+			user, err := client.UserService.GetUser(ctx, "pascal")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil && user.Username != "pascal" {
+				t.Fatalf("expected pascal, got %+v", user)
+			}
+		})
+	}
+}
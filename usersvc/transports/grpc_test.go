@@ -0,0 +1,43 @@
+package transports
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+func TestEncodeGRPCValidationError(t *testing.T) {
+	verr := &services.ValidationError{Violations: []services.FieldViolation{
+		{Field: "new_password", Code: services.ViolationReusedPassword, Message: "must not be one of the last passwords"},
+	}}
+	_, err := encodeGRPCUpdatePasswordResponse(context.Background(), endpoints.UpdatePasswordResponse{Err: verr})
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	var (
+		info *errdetails.ErrorInfo
+		br   *errdetails.BadRequest
+	)
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = d
+		case *errdetails.BadRequest:
+			br = d
+		}
+	}
+	if info == nil || info.Reason != "validation_failed" || info.Domain != pkg.ErrorDomain {
+		t.Fatalf("expected the validation_failed error info, got %v", st.Details())
+	}
+	if br == nil || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "new_password" {
+		t.Fatalf("expected the new_password violation, got %v", st.Details())
+	}
+}
@@ -4,23 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 
-	kittransport "github.com/go-kit/kit/transport"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 	kitlog "github.com/go-kit/log"
 	"github.com/gorilla/mux"
 	"github.com/swaggo/http-swagger"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
 	_ "github.com/pascallin/go-kit-application/usersvc/docs"
 	"github.com/pascallin/go-kit-application/usersvc/endpoints"
-	"github.com/pascallin/go-kit-application/usersvc/services"
 )
 
-func MakeHandler(s services.Service, logger kitlog.Logger) http.Handler {
+// ErrBadRequest is returned when a request body cannot be decoded.
+var ErrBadRequest = pkg.NewError(pkg.KindInvalidArgument, "bad_request", "bad request")
+
+// MakeHandler returns the HTTP handler serving the endpoints of set, as built
+// by endpoints.New for the local service. The X-Forwarded-For header is
+// trusted from the proxies only.
+func MakeHandler(set endpoints.EndpointSet, proxies middleware.TrustedProxies, tracer trace.Tracer, logger kitlog.Logger) http.Handler {
 	opts := []kithttp.ServerOption{
-		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorHandler(middleware.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(middleware.ErrorEncoder),
+		kithttp.ServerBefore(kitjwt.HTTPToContext(), proxies.HTTPClientIPToContext),
+		middleware.HTTPServerTrace(tracer),
 	}
 
 	r := mux.NewRouter()
@@ -32,69 +44,627 @@ func MakeHandler(s services.Service, logger kitlog.Logger) http.Handler {
 		// httpSwagger.DomID("#swagger-ui"),
 	)).Methods(http.MethodGet)
 
-	r.Handle("/user/v1/register", registerHandler(s, opts, logger)).Methods("POST")
+	r.Handle("/user/v1/register", registerHandler(set.RegisterEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/login", loginHandler(set.LoginEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/password", updatePasswordHandler(set.UpdatePasswordEndpoint, opts)).Methods("PUT")
+	r.Handle("/user/v1/token/valid", validTokenHandler(set.ValidTokenEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/token/refresh", refreshHandler(set.RefreshEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/logout", logoutHandler(set.LogoutEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/roles/grant", grantRoleHandler(set.GrantRoleEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/roles/revoke", revokeRoleHandler(set.RevokeRoleEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/users", listUsersHandler(set.ListUsersEndpoint, opts)).Methods("GET")
+	r.Handle("/user/v1/users/{username}", getUserHandler(set.GetUserEndpoint, opts)).Methods("GET")
+	r.Handle("/user/v1/users/{username}", updateProfileHandler(set.UpdateProfileEndpoint, opts)).Methods("PATCH")
+	r.Handle("/user/v1/users/{username}", deleteUserHandler(set.DeleteUserEndpoint, opts)).Methods("DELETE")
+	r.Handle("/user/v1/users/{username}/unlock", unlockUserHandler(set.UnlockUserEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/mfa/enroll", enrollMFAHandler(set.EnrollMFAEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/mfa/confirm", confirmMFAHandler(set.ConfirmMFAEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/mfa/verify", verifyMFAHandler(set.VerifyMFAEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/password/reset/request", requestPasswordResetHandler(set.RequestPasswordResetEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/password/reset", resetPasswordHandler(set.ResetPasswordEndpoint, opts)).Methods("POST")
+	r.Handle("/user/v1/email/verify", verifyEmailHandler(set.VerifyEmailEndpoint, opts)).Methods("POST")
+	r.Handle("/.well-known/jwks.json", jwksHandler(set.JWKSEndpoint, opts)).Methods("GET")
 
-	return r
+	return middleware.RequestID(r)
 }
 
 // user register godoc
 // @Summary user register
 // @Schemes
-// @Description create subscription
+// @Description create a user
 // @Tags user
 // @Accept json
 // @Produce json
 // @security  ServiceApiKey
-// @Success 200 {object} endpoints.RegisterRequest
+// @Param   data     body    endpoints.RegisterRequest     true        "data"
+// @Success 200 {object} endpoints.RegisterResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 409 {object} middleware.Problem
 // @Router /user/v1/register [post]
-// @Param   data     body    endpoints.RegisterResponse     true        "data"
-func registerHandler(s services.Service, opts []kithttp.ServerOption, logger kitlog.Logger) *kithttp.Server {
+func registerHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
 	return kithttp.NewServer(
-		middleware.LoggingMiddleware(kitlog.With(logger, "method", "user register"))(endpoints.MakeRegisterEndpoint(s)),
+		e,
 		decodeRegisterRequest,
 		encodeResponse,
 		opts...,
 	)
 }
 
-type errorer interface {
-	error() error
+// user login godoc
+// @Summary user login
+// @Schemes
+// @Description exchange username and password for an access and refresh token pair, or an MFA challenge for users with MFA enabled
+// @Tags user
+// @Accept json
+// @Produce json
+// @security  ServiceApiKey
+// @Param   data     body    endpoints.LoginRequest     true        "data"
+// @Success 200 {object} endpoints.LoginResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 423 {object} middleware.Problem
+// @Failure 429 {object} middleware.Problem
+// @Router /user/v1/login [post]
+func loginHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeLoginRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// user update password godoc
+// @Summary user update password
+// @Schemes
+// @Description change the password of a user, given the current one, revoking the tokens issued so far
+// @Tags user
+// @Accept json
+// @Produce json
+// @security  ServiceApiKey
+// @Param   data     body    endpoints.UpdatePasswordRequest     true        "data"
+// @Success 200 {object} endpoints.UpdatePasswordResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Router /user/v1/password [put]
+func updatePasswordHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeUpdatePasswordRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// token validation godoc
+// @Summary token validation
+// @Schemes
+// @Description check an access token, given in the body or as a Bearer Authorization header
+// @Tags auth
+// @Accept json
+// @Produce json
+// @security  ServiceApiKey
+// @Param   data     body    endpoints.ValidTokenEndpointRequest     false        "data"
+// @Success 200 {object} endpoints.ValidTokenEndpointResponse
+// @Failure 401 {object} middleware.Problem
+// @Router /user/v1/token/valid [post]
+func validTokenHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeValidTokenRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// token refresh godoc
+// @Summary token refresh
+// @Schemes
+// @Description exchange a refresh token for a new token pair, the refresh token can only be used once
+// @Tags auth
+// @Accept json
+// @Produce json
+// @security  ServiceApiKey
+// @Param   data     body    endpoints.RefreshRequest     true        "data"
+// @Success 200 {object} endpoints.RefreshResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Router /user/v1/token/refresh [post]
+func refreshHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeRefreshRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// user logout godoc
+// @Summary user logout
+// @Schemes
+// @Description revoke an access token, and its refresh token if given
+// @Tags auth
+// @Accept json
+// @Produce json
+// @security  ServiceApiKey
+// @Param   data     body    endpoints.LogoutRequest     true        "data"
+// @Success 200 {object} endpoints.LogoutResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Router /user/v1/logout [post]
+func logoutHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeLogoutRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// token signing keys godoc
+// @Summary token signing keys
+// @Schemes
+// @Description public keys to verify the tokens issued by usersvc with, as a JSON Web Key Set
+// @Tags auth
+// @Produce json
+// @Success 200 {object} endpoints.JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func jwksHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		kithttp.NopRequestDecoder,
+		encodeJWKSResponse,
+		opts...,
+	)
+}
+
+// grant role godoc
+// @Summary grant role
+// @Schemes
+// @Description grant a role to a user, requires the user:admin permission
+// @Tags user
+// @Accept json
+// @Produce json
+// @security  BearerAuth
+// @Param   data     body    endpoints.RoleRequest     true        "data"
+// @Success 200 {object} endpoints.RoleResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Failure 404 {object} middleware.Problem
+// @Router /user/v1/roles/grant [post]
+func grantRoleHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeRoleRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// revoke role godoc
+// @Summary revoke role
+// @Schemes
+// @Description revoke a role from a user, requires the user:admin permission
+// @Tags user
+// @Accept json
+// @Produce json
+// @security  BearerAuth
+// @Param   data     body    endpoints.RoleRequest     true        "data"
+// @Success 200 {object} endpoints.RoleResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Failure 404 {object} middleware.Problem
+// @Router /user/v1/roles/revoke [post]
+func revokeRoleHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeRoleRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// get user godoc
+// @Summary get user
+// @Schemes
+// @Description get the profile of a user, requires the user:read permission unless it is the caller's own
+// @Tags user
+// @Produce json
+// @security  BearerAuth
+// @Param   username     path    string     true        "username"
+// @Success 200 {object} endpoints.GetUserResponse
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Failure 404 {object} middleware.Problem
+// @Router /user/v1/users/{username} [get]
+func getUserHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeGetUserRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// list users godoc
+// @Summary list users
+// @Schemes
+// @Description list the users page by page, requires the user:read permission
+// @Tags user
+// @Produce json
+// @security  BearerAuth
+// @Param   cursor     query    string     false        "next_cursor of the previous page"
+// @Param   limit      query    int        false        "page size, 20 by default and at most 100"
+// @Param   prefix     query    string     false        "username prefix"
+// @Param   sort       query    string     false        "username or created_at"
+// @Param   order      query    string     false        "asc or desc"
+// @Success 200 {object} endpoints.ListUsersResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Router /user/v1/users [get]
+func listUsersHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeListUsersRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// update profile godoc
+// @Summary update profile
+// @Schemes
+// @Description update the profile of a user, requires the user:write permission unless it is the caller's own
+// @Tags user
+// @Accept json
+// @Produce json
+// @security  BearerAuth
+// @Param   username     path    string     true        "username"
+// @Param   data     body    endpoints.UpdateProfileRequest     true        "data"
+// @Success 200 {object} endpoints.UpdateProfileResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Failure 404 {object} middleware.Problem
+// @Router /user/v1/users/{username} [patch]
+func updateProfileHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeUpdateProfileRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// delete user godoc
+// @Summary delete user
+// @Schemes
+// @Description delete a user, who can no longer log in, revoking the tokens issued to it, requires the user:write permission
+// @Tags user
+// @Produce json
+// @security  BearerAuth
+// @Param   username     path    string     true        "username"
+// @Success 200 {object} endpoints.DeleteUserResponse
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Failure 404 {object} middleware.Problem
+// @Router /user/v1/users/{username} [delete]
+func deleteUserHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeDeleteUserRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// unlock user godoc
+// @Summary unlock user
+// @Schemes
+// @Description lift the lockout of a user after too many failed logins, requires the user:admin permission
+// @Tags user
+// @Produce json
+// @security  BearerAuth
+// @Param   username     path    string     true        "username"
+// @Success 200 {object} endpoints.UnlockUserResponse
+// @Failure 401 {object} middleware.Problem
+// @Failure 403 {object} middleware.Problem
+// @Router /user/v1/users/{username}/unlock [post]
+func unlockUserHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeUnlockUserRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// mfa enroll godoc
+// @Summary mfa enroll
+// @Schemes
+// @Description start the TOTP enrollment of the caller, returning the secret and its otpauth URI
+// @Tags mfa
+// @Produce json
+// @security  BearerAuth
+// @Success 200 {object} endpoints.EnrollMFAResponse
+// @Failure 401 {object} middleware.Problem
+// @Failure 409 {object} middleware.Problem
+// @Router /user/v1/mfa/enroll [post]
+func enrollMFAHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeEnrollMFARequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// mfa confirm godoc
+// @Summary mfa confirm
+// @Schemes
+// @Description enable MFA for the caller with a first code, returning the one-time recovery codes
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @security  BearerAuth
+// @Param   data     body    endpoints.ConfirmMFARequest     true        "data"
+// @Success 200 {object} endpoints.ConfirmMFAResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Router /user/v1/mfa/confirm [post]
+func confirmMFAHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeConfirmMFARequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// mfa verify godoc
+// @Summary mfa verify
+// @Schemes
+// @Description complete a login, exchanging its MFA challenge and a TOTP or recovery code for a token pair
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param   data     body    endpoints.VerifyMFARequest     true        "data"
+// @Success 200 {object} endpoints.VerifyMFAResponse
+// @Failure 400 {object} middleware.Problem
+// @Failure 401 {object} middleware.Problem
+// @Failure 423 {object} middleware.Problem
+// @Failure 429 {object} middleware.Problem
+// @Router /user/v1/mfa/verify [post]
+func verifyMFAHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeVerifyMFARequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// request password reset godoc
+// @Summary request password reset
+// @Schemes
+// @Description email a password reset link, succeeds whether or not the email belongs to a user
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param   data     body    endpoints.RequestPasswordResetRequest     true        "data"
+// @Success 200 {object} endpoints.RequestPasswordResetResponse
+// @Failure 400 {object} middleware.Problem
+// @Router /user/v1/password/reset/request [post]
+func requestPasswordResetHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeRequestPasswordResetRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// reset password godoc
+// @Summary reset password
+// @Schemes
+// @Description set a new password with the token of a password reset link, revoking the tokens issued so far
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param   data     body    endpoints.ResetPasswordRequest     true        "data"
+// @Success 200 {object} endpoints.ResetPasswordResponse
+// @Failure 400 {object} middleware.Problem
+// @Router /user/v1/password/reset [post]
+func resetPasswordHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeResetPasswordRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// verify email godoc
+// @Summary verify email
+// @Schemes
+// @Description verify the email of a user with the token of a verification link
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param   data     body    endpoints.VerifyEmailRequest     true        "data"
+// @Success 200 {object} endpoints.VerifyEmailResponse
+// @Failure 400 {object} middleware.Problem
+// @Router /user/v1/email/verify [post]
+func verifyEmailHandler(e endpoint.Endpoint, opts []kithttp.ServerOption) *kithttp.Server {
+	return kithttp.NewServer(
+		e,
+		decodeVerifyEmailRequest,
+		encodeResponse,
+		opts...,
+	)
+}
+
+// decodeJSON decodes the JSON request body into v, reporting malformed bodies
+// as ErrBadRequest.
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return ErrBadRequest
+	}
+	return nil
 }
 
 func decodeRegisterRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Nickname string `json:"nickname"`
+	var req endpoints.RegisterRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.LoginRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeUpdatePasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.UpdatePasswordRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeValidTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.ValidTokenEndpointRequest
+	if token := bearerToken(r); token != "" {
+		req.Token = token
+		return req, nil
+	}
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeRefreshRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.RefreshRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeLogoutRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.LogoutRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	if token := bearerToken(r); token != "" {
+		req.Token = token
+	}
+	return req, nil
+}
+
+func decodeRoleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.RoleRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeGetUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return endpoints.GetUserRequest{Username: mux.Vars(r)["username"]}, nil
+}
+
+func decodeListUsersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := endpoints.ListUsersRequest{
+		Cursor:         q.Get("cursor"),
+		UsernamePrefix: q.Get("prefix"),
+		SortBy:         q.Get("sort"),
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+		req.Limit = n
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		req.Descending = true
+	default:
+		return nil, ErrBadRequest
+	}
+	return req, nil
+}
+
+func decodeUpdateProfileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.UpdateProfileRequest
+	if err := decodeJSON(r, &req); err != nil {
 		return nil, err
 	}
+	req.Username = mux.Vars(r)["username"]
+	return req, nil
+}
+
+func decodeDeleteUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return endpoints.DeleteUserRequest{Username: mux.Vars(r)["username"]}, nil
+}
+
+func decodeUnlockUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return endpoints.UnlockUserRequest{Username: mux.Vars(r)["username"]}, nil
+}
+
+func decodeEnrollMFARequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return endpoints.EnrollMFARequest{}, nil
+}
+
+func decodeConfirmMFARequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.ConfirmMFARequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeVerifyMFARequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.VerifyMFARequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
 
-	return endpoints.RegisterRequest{
-		Username: body.Username,
-		Password: body.Password,
-		Nickname: body.Nickname,
-	}, nil
+func decodeRequestPasswordResetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.RequestPasswordResetRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeResetPasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.ResetPasswordRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func decodeVerifyEmailRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoints.VerifyEmailRequest
+	err := decodeJSON(r, &req)
+	return req, err
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func encodeJWKSResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	// keys rotate slowly, let verifiers cache the key set for a while
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return encodeResponse(ctx, w, response)
 }
 
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	if e, ok := response.(errorer); ok && e.error() != nil {
-		encodeError(ctx, e.error(), w)
+	if f, ok := response.(endpoint.Failer); ok && f.Failed() != nil {
+		middleware.ErrorEncoder(ctx, f.Failed(), w)
 		return nil
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
 }
-
-// encode errors from business-logic
-func encodeError(_ context.Context, err error, w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	switch err {
-	default:
-		w.WriteHeader(http.StatusInternalServerError)
-	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
-	})
-}
@@ -0,0 +1,95 @@
+package transports
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pascallin/go-kit-application/middleware"
+	"github.com/pascallin/go-kit-application/pkg"
+	"github.com/pascallin/go-kit-application/usersvc/endpoints"
+	"github.com/pascallin/go-kit-application/usersvc/services"
+)
+
+// TestMakeHandlerServesSet checks the routes call the endpoints of the set,
+// with the middlewares endpoints.New wired, rather than chains of their own.
+func TestMakeHandlerServesSet(t *testing.T) {
+	var got interface{}
+	set := endpoints.EndpointSet{
+		LoginEndpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+			got = request
+			return endpoints.LoginResponse{Token: "token"}, nil
+		},
+	}
+	handler := MakeHandler(set, nil, trace.NewNoopTracerProvider().Tracer(""), log.NewNopLogger())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/v1/login", strings.NewReader(`{"username":"alice","password":"secret"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if req, ok := got.(endpoints.LoginRequest); !ok || req.Username != "alice" {
+		t.Fatalf("expected the login request of alice, got %+v", got)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{ErrBadRequest, http.StatusBadRequest},
+		{services.ErrWrongUsernameOrPassword, http.StatusUnauthorized},
+		{services.ErrInvalidToken, http.StatusUnauthorized},
+		{fmt.Errorf("wrapped: %w", services.ErrInvalidToken), http.StatusUnauthorized},
+		{services.ErrExistedUsername, http.StatusConflict},
+		{middleware.ErrUnauthenticated, http.StatusUnauthorized},
+		{middleware.ErrForbidden, http.StatusForbidden},
+		{services.ErrUserNotFound, http.StatusNotFound},
+		{services.ErrInvalidCursor, http.StatusBadRequest},
+		{services.ErrAccountLocked, http.StatusLocked},
+		{services.ErrLoginThrottled, http.StatusTooManyRequests},
+		{services.ErrInvalidMFACode, http.StatusUnauthorized},
+		{services.ErrMFAAlreadyEnabled, http.StatusConflict},
+		{services.ErrInvalidAccountToken, http.StatusBadRequest},
+		{services.ErrExistedEmail, http.StatusConflict},
+		{&services.ValidationError{}, http.StatusBadRequest},
+		{services.ErrUpdatePasswordFailed, http.StatusInternalServerError},
+	} {
+		if code := pkg.HTTPStatus(tc.err); code != tc.code {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.code, code)
+		}
+	}
+}
+
+func TestEncodeValidationError(t *testing.T) {
+	err := &services.ValidationError{Violations: []services.FieldViolation{
+		{Field: "password", Code: services.ViolationTooShort, Message: "must be at least 8 characters"},
+		{Field: "password", Code: services.ViolationMissingDigit, Message: "must contain a digit"},
+	}}
+	w := httptest.NewRecorder()
+	middleware.ErrorEncoder(context.Background(), err, w)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != middleware.ProblemContentType {
+		t.Fatalf("expected a problem, got %q", ct)
+	}
+	var res middleware.Problem
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != http.StatusBadRequest || res.Code != "validation_failed" {
+		t.Fatalf("expected a validation_failed problem, got %+v", res)
+	}
+	if len(res.Fields) != 2 || res.Fields[1].Code != services.ViolationMissingDigit {
+		t.Fatalf("expected the violations in fields, got %+v", res.Fields)
+	}
+}